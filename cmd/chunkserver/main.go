@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/jiajunhuang/hfs/pkg/chunkserver"
+	"github.com/jiajunhuang/hfs/pkg/config"
 	"github.com/jiajunhuang/hfs/pkg/logger"
 	cli "gopkg.in/urfave/cli.v1"
 )
@@ -14,10 +15,32 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "chunkserver"
 	app.Usage = "Chunkserver for Huang's Distributed File System"
+	app.Flags = config.Flags()
 	app.Action = func(c *cli.Context) error {
+		if err := config.Setup(c); err != nil {
+			return err
+		}
 		chunkserver.StartChunkServer()
 		return nil
 	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "config",
+			Usage: "manage configurations",
+			Subcommands: []cli.Command{
+				{
+					Name:  "dump",
+					Usage: "print configurations in effect as TOML, it can be used as config file",
+					Action: func(c *cli.Context) error {
+						if err := config.Setup(c); err != nil {
+							return err
+						}
+						return config.Dump(os.Stdout)
+					},
+				},
+			},
+		},
+	}
 
 	err := app.Run(os.Args)
 	if err != nil {
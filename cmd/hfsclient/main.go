@@ -1,44 +1,180 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/auth"
 	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/crypt"
 	"github.com/jiajunhuang/hfs/pkg/hfsclient"
 	"github.com/jiajunhuang/hfs/pkg/logger"
-	"google.golang.org/grpc"
+	"github.com/jiajunhuang/hfs/pkg/metrics"
+	"github.com/jiajunhuang/hfs/pkg/tlsconfig"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
-func main() {
-	defer logger.Logger.Sync()
-	conn, err := grpc.Dial(config.GRPCAddr, grpc.WithInsecure(), grpc.WithMaxMsgSize(config.GRPCMaxMsgSize))
+// newClient create client with global flags, it's called by the commands which need it,
+// so that `--help` works without any server
+func newClient(c *cli.Context, extra ...hfsclient.Option) (*hfsclient.Client, error) {
+	if err := config.Setup(c); err != nil {
+		return nil, cli.NewExitError(err.Error(), 1)
+	}
+
+	// uploads and downloads of big files can be watched while they're running
+	if config.MetricsAddr != "" {
+		if err := metrics.Serve(config.MetricsAddr); err != nil {
+			return nil, cli.NewExitError(fmt.Sprintf("failed to serve metrics: %s", err), 1)
+		}
+	}
+
+	endpoints := []string{config.GRPCAddr}
+	if c.GlobalString("endpoints") != "" {
+		endpoints = strings.Split(c.GlobalString("endpoints"), ",")
+	}
+
+	opts := []hfsclient.Option{hfsclient.WithCluster(config.ClusterName), hfsclient.WithEndpoints(endpoints...)}
+	if c.GlobalBool("discover") {
+		opts = append(opts, hfsclient.WithDiscovery(config.EtcdEndpoints...))
+	}
+
+	if config.TLS {
+		cfg, err := tlsconfig.GRPC().Client(config.TLSServerName)
+		if err != nil {
+			return nil, cli.NewExitError(fmt.Sprintf("failed to load TLS configuration: %s", err), 1)
+		}
+		opts = append(opts, hfsclient.WithTLS(cfg))
+	}
+	if etcdTLS, err := tlsconfig.EtcdClient(); err != nil {
+		return nil, cli.NewExitError(fmt.Sprintf("failed to load TLS configuration of etcd: %s", err), 1)
+	} else if etcdTLS != nil {
+		opts = append(opts, hfsclient.WithEtcdTLS(etcdTLS))
+	}
+
+	// encrypted files can be read whenever there's a key, but only `upload --encrypt` encrypts
+	key, err := crypt.LoadKey(config.KeyFile)
+	if err != nil && (err != crypt.ErrNoKey || c.Bool("encrypt")) {
+		return nil, cli.NewExitError(fmt.Sprintf("failed to load encryption key: %s", err), 1)
+	} else if c.Bool("encrypt") {
+		opts = append(opts, hfsclient.WithEncryption(key))
+	} else if key != nil {
+		opts = append(opts, hfsclient.WithKey(key))
+	}
+
+	token, err := auth.LoadToken(config.TokenFile)
+	if err != nil {
+		return nil, cli.NewExitError(fmt.Sprintf("failed to load token: %s", err), 1)
+	} else if token != "" {
+		opts = append(opts, hfsclient.WithToken(token))
+	}
+
+	client, err := hfsclient.New(append(opts, extra...)...)
+	if err != nil {
+		return nil, cli.NewExitError(fmt.Sprintf("failed to connect to chunkservers: %s", err), 1)
+	}
+
+	return client, nil
+}
+
+// parsePermission parse --mode and --grant flags
+func parsePermission(c *cli.Context) (uint32, []*pb.Grant, error) {
+	mode, err := auth.ParsePerm(c.String("mode"))
+	if err != nil {
+		return 0, nil, cli.NewExitError(err.Error(), 1)
+	}
+
+	acl := []*pb.Grant{}
+	for _, s := range c.StringSlice("grant") {
+		g, err := auth.ParseGrant(s)
+		if err != nil {
+			return 0, nil, cli.NewExitError(err.Error(), 1)
+		}
+		acl = append(acl, g)
+	}
+
+	return mode, acl, nil
+}
+
+// parseBytes parse size like 10G, K, M, G and T are powers of 1024
+func parseBytes(s string) (int64, error) {
+	units := map[byte]int64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+
+	unit := int64(1)
+	if n := len(s); n > 0 && units[s[n-1]] != 0 {
+		unit, s = units[s[n-1]], s[:n-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		logger.Sugar.Fatalf("failed to connect to grpc server %s: %s", config.GRPCAddr, err)
+		return 0, fmt.Errorf("bad size %q, should be like 1024, 512M or 10G", s)
+	}
+	return n * unit, nil
+}
+
+// formatLimit format limit of quota, negative is unlimited
+func formatLimit(limit int64, format func(int64) string) string {
+	if limit < 0 {
+		return "unlimited"
 	}
-	defer conn.Close()
+	return format(limit)
+}
 
-	grpcClient := pb.NewChunkServerClient(conn)
+var permissionFlags = []cli.Flag{
+	cli.StringFlag{Name: "mode", Usage: "`PERM` of all the other users: r, w, rw, or empty for private"},
+	cli.StringSliceFlag{Name: "grant", Usage: "grant permissions to a user, like `alice:rw`, can be repeated"},
+}
+
+// newApp returns the cli application with all the commands
+func newApp() *cli.App {
+	ctx := context.Background()
 
 	app := cli.NewApp()
 	app.Name = "hfsclient"
 	app.Usage = "cli for Huang's Distributed File System"
+	app.Flags = append([]cli.Flag{
+		cli.StringFlag{Name: "endpoints", Usage: "comma separated addresses of chunkservers, default to GRPCAddr"},
+		cli.BoolFlag{Name: "discover", Usage: "discover live chunkservers in etcd instead of using --endpoints"},
+	}, config.Flags()...)
 	app.Commands = []cli.Command{
 		{
 			Name:  "upload",
-			Usage: "upload file",
+			Usage: "upload file, read from stdin if filepath is -",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{Name: "name", Value: "stdin", Usage: "file `NAME` to save as when reading from stdin"},
+				cli.StringFlag{Name: "codec", Usage: "compress chunks with `CODEC`: snappy, lz4, zstd or flate"},
+				cli.BoolFlag{Name: "encrypt", Usage: "encrypt file with key in KeyFile or " + crypt.KeyEnv},
+			}, append(permissionFlags, progressFlags...)...),
 			Action: func(c *cli.Context) error {
 				filePath := c.Args().First()
 				if filePath == "" {
-					fmt.Printf("Usage: $ hfsclient upload <filepath>\n")
+					fmt.Printf("Usage: $ hfsclient upload <filepath | ->\n")
 					return nil
 				}
 
-				if err := hfsclient.Upload(grpcClient, filePath); err != nil {
-					fmt.Printf("failed to upload: %s\n", err)
+				mode, acl, err := parsePermission(c)
+				if err != nil {
+					return err
+				}
+				client, err := newClient(c, hfsclient.WithCodec(c.String("codec")), hfsclient.WithPermission(mode, acl...))
+				if err != nil {
+					return err
 				}
+				defer client.Close()
+
+				r := newReporter(c)
+				var file *pb.File
+				if filePath == "-" {
+					file, err = client.Upload(ctx, os.Stdin, c.String("name"), -1, r.Progress())
+				} else {
+					file, err = client.UploadFile(ctx, filePath, r.Progress())
+				}
+				if err != nil {
+					return cli.NewExitError(fmt.Sprintf("failed to upload: %s", err), 1)
+				}
+				r.Done(fmt.Sprintf("file created, uuid is %s\n", file.UUID), file)
 
 				return nil
 			},
@@ -46,15 +182,81 @@ func main() {
 		{
 			Name:  "download",
 			Usage: "download file",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{Name: "output, o", Usage: "write to `PATH` instead of a file named by UUID"},
+				cli.BoolFlag{Name: "remote-name, O", Usage: "write to current directory with the origin file name"},
+			}, progressFlags...),
+			Action: func(c *cli.Context) error {
+				fileUUID := c.Args().First()
+				if fileUUID == "" {
+					fmt.Printf("Usage: $ hfsclient download <fileuuid> [-o <path> | -O]\n")
+					return nil
+				}
+
+				dstPath := fileUUID
+				if c.String("output") != "" {
+					dstPath = c.String("output")
+				} else if c.Bool("remote-name") {
+					dstPath = "."
+				}
+
+				client, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				r := newReporter(c)
+				file, path, err := client.Download(ctx, fileUUID, dstPath, r.Progress())
+				if err != nil {
+					return cli.NewExitError(fmt.Sprintf("failed to download: %s", err), 1)
+				}
+				r.Done(fmt.Sprintf("file with UUID %s download successful to %s! origin file name is %s\n", fileUUID, path, file.FileName), file)
+
+				return nil
+			},
+		},
+		{
+			Name:  "cat",
+			Usage: "write file to stdout",
 			Action: func(c *cli.Context) error {
 				fileUUID := c.Args().First()
 				if fileUUID == "" {
-					fmt.Printf("Usage: $ hfsclient download <fileuuid>\n")
+					fmt.Printf("Usage: $ hfsclient cat <fileuuid>\n")
 					return nil
 				}
 
-				if err := hfsclient.Download(grpcClient, fileUUID); err != nil {
-					fmt.Printf("failed to download: %s\n", err)
+				client, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				if _, err := client.Cat(ctx, fileUUID, os.Stdout, nil); err != nil {
+					return cli.NewExitError(fmt.Sprintf("failed to cat: %s", err), 1)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:  "list",
+			Usage: "list files",
+			Action: func(c *cli.Context) error {
+				client, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				files, err := client.List(ctx)
+				if err != nil {
+					fmt.Printf("failed to list files: %s\n", err)
+					return nil
+				}
+
+				for _, file := range files {
+					fmt.Printf("%s\t%d\t%s\n", file.UUID, file.Size, file.FileName)
 				}
 
 				return nil
@@ -66,21 +268,128 @@ func main() {
 			Action: func(c *cli.Context) error {
 				fileUUID := c.Args().First()
 				if fileUUID == "" {
-					fmt.Printf("Usage: $ hfsclient download <fileuuid>\n")
+					fmt.Printf("Usage: $ hfsclient delete <fileuuid>\n")
 					return nil
 				}
 
-				if err := hfsclient.Delete(grpcClient, fileUUID); err != nil {
-					fmt.Printf("failed to download: %s\n", err)
+				client, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				if err := client.Remove(ctx, fileUUID); err != nil {
+					fmt.Printf("failed to delete file %s: %s\n", fileUUID, err)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:  "chmod",
+			Usage: "replace permissions of file",
+			Flags: permissionFlags,
+			Action: func(c *cli.Context) error {
+				fileUUID := c.Args().First()
+				if fileUUID == "" {
+					fmt.Printf("Usage: $ hfsclient chmod <fileuuid> [--mode <perm>] [--grant <user:perm>...]\n")
+					return nil
+				}
+
+				mode, acl, err := parsePermission(c)
+				if err != nil {
+					return err
+				}
+				client, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				if err := client.Chmod(ctx, fileUUID, mode, acl...); err != nil {
+					fmt.Printf("failed to chmod file %s: %s\n", fileUUID, err)
 				}
 
+				return nil
+			},
+		},
+		{
+			Name:  "quota",
+			Usage: "show quota and usage of a user, default to yourself. admins set it with --max-bytes or --max-files",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "max-bytes", Usage: "`SIZE` of files the user can own, like 10G. 0 follows the default of chunkservers, -1 is unlimited"},
+				cli.Int64Flag{Name: "max-files", Usage: "`COUNT` of files the user can own. 0 follows the default of chunkservers, -1 is unlimited"},
+			},
+			Action: func(c *cli.Context) error {
+				owner := c.Args().First()
+				client, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				if c.IsSet("max-bytes") || c.IsSet("max-files") {
+					if owner == "" {
+						fmt.Printf("Usage: $ hfsclient quota <user> [--max-bytes <size>] [--max-files <count>]\n")
+						return nil
+					}
+					// the limit which is not given is left as is
+					var maxBytes, maxFiles *int64
+					if c.IsSet("max-bytes") {
+						n, err := parseBytes(c.String("max-bytes"))
+						if err != nil {
+							return cli.NewExitError(err.Error(), 1)
+						}
+						maxBytes = &n
+					}
+					if c.IsSet("max-files") {
+						n := c.Int64("max-files")
+						maxFiles = &n
+					}
+					if err := client.SetQuota(ctx, owner, maxBytes, maxFiles); err != nil {
+						return cli.NewExitError(fmt.Sprintf("failed to set quota of %s: %s", owner, err), 1)
+					}
+				}
+
+				q, err := client.Quota(ctx, owner)
+				if err != nil {
+					return cli.NewExitError(fmt.Sprintf("failed to get quota: %s", err), 1)
+				}
+				bytes := func(n int64) string { return humanBytes(float64(n)) }
+				count := func(n int64) string { return strconv.FormatInt(n, 10) }
+				fmt.Printf("%s\tbytes: %s of %s\tfiles: %d of %s\n", q.Owner, bytes(q.UsedBytes), formatLimit(q.MaxBytes, bytes), q.UsedFiles, formatLimit(q.MaxFiles, count))
+
+				return nil
+			},
+		},
+		{
+			Name:  "leader",
+			Usage: "show which chunkserver coordinates the cluster",
+			Action: func(c *cli.Context) error {
+				client, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+
+				leader, err := client.Leader(ctx)
+				if err != nil {
+					return cli.NewExitError(fmt.Sprintf("failed to get leader: %s", err), 1)
+				}
+				fmt.Printf("%s\t%s\tterm: %d\n", leader.Name, leader.Addr, leader.Term)
+
 				return nil
 			},
 		},
 	}
 
-	err = app.Run(os.Args)
-	if err != nil {
+	return app
+}
+
+func main() {
+	defer logger.Logger.Sync()
+
+	if err := newApp().Run(os.Args); err != nil {
 		logger.Sugar.Fatal(err)
 	}
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jiajunhuang/hfs/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// fakeServer keeps files and chunks in memory, it only serves what upload, download and cat need
+type fakeServer struct {
+	pb.ChunkServerServer
+
+	mu     sync.Mutex
+	files  map[string]*pb.File
+	chunks map[string][]byte
+}
+
+func (s *fakeServer) CreateFile(stream pb.ChunkServer_CreateFileServer) error {
+	s.mu.Lock()
+	file := pb.File{UUID: fmt.Sprintf("file-%d", len(s.files)+1)}
+	s.mu.Unlock()
+
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		chunk := pb.Chunk{UUID: fmt.Sprintf("%s-%d", file.UUID, len(file.Chunks)), FileUUID: file.UUID, Used: int64(len(data.Data))}
+		s.mu.Lock()
+		s.chunks[chunk.UUID] = data.Data
+		s.mu.Unlock()
+		file.FileName = data.Msg
+		file.Size += chunk.Used
+		file.Chunks = append(file.Chunks, &chunk)
+	}
+
+	s.mu.Lock()
+	s.files[file.UUID] = &file
+	s.mu.Unlock()
+	return stream.SendAndClose(&pb.CreateFileResponse{File: &file})
+}
+
+func (s *fakeServer) GetFile(ctx context.Context, req *pb.ReadFileRequest) (*pb.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[req.FileUUID]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "file not exist")
+	}
+	return file, nil
+}
+
+func (s *fakeServer) ReadChunk(ctx context.Context, req *pb.ReadChunkRequest) (*pb.FileChunkData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.chunks[req.ChunkUUID]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "chunk not exist")
+	}
+	return &pb.FileChunkData{Data: data[req.Offset : req.Offset+req.Length]}, nil
+}
+
+// fakeCluster starts a fakeServer, it returns the server and it's address
+func fakeCluster(t *testing.T) (*fakeServer, string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	server := grpc.NewServer()
+	fake := &fakeServer{files: map[string]*pb.File{}, chunks: map[string][]byte{}}
+	pb.RegisterChunkServerServer(server, fake)
+	go server.Serve(lis)
+
+	return fake, lis.Addr().String(), server.Stop
+}
+
+// run runs hfsclient with args against addr, stdin of it is read from stdin. it returns what's
+// written to stdout, and exit code
+func run(t *testing.T, addr string, stdin string, args ...string) (string, int) {
+	dir, err := ioutil.TempDir("", "hfsclient-cli")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := dir+"/stdin", dir+"/stdout"
+	if err := ioutil.WriteFile(in, []byte(stdin), 0600); err != nil {
+		t.Fatalf("failed to write stdin: %s", err)
+	}
+	inFile, _ := os.Open(in)
+	defer inFile.Close()
+	outFile, _ := os.Create(out)
+	defer outFile.Close()
+
+	oldStdin, oldStdout, oldExiter, oldErrWriter := os.Stdin, os.Stdout, cli.OsExiter, cli.ErrWriter
+	defer func() {
+		os.Stdin, os.Stdout, cli.OsExiter, cli.ErrWriter = oldStdin, oldStdout, oldExiter, oldErrWriter
+	}()
+	code := 0
+	os.Stdin, os.Stdout, cli.OsExiter, cli.ErrWriter = inFile, outFile, func(c int) { code = c }, ioutil.Discard
+
+	newApp().Run(append([]string{"hfsclient", "--endpoints", addr, "--chunk-size", "4"}, args...))
+	b, _ := ioutil.ReadFile(out)
+	return string(b), code
+}
+
+func TestUploadFromStdin(t *testing.T) {
+	fake, addr, stop := fakeCluster(t)
+	defer stop()
+	data := "data from a pipe"
+
+	out, code := run(t, addr, data, "upload", "--quiet", "--name", "piped.txt", "-")
+	if code != 0 {
+		t.Fatalf("upload should succeed but exit with %d", code)
+	}
+	file := fake.files[strings.TrimSpace(out)]
+	if file == nil || file.FileName != "piped.txt" || file.Size != int64(len(data)) || len(file.Chunks) != 4 {
+		t.Fatalf("file of stdin should be uploaded as piped.txt in 4 chunks but got %+v, output: %q", file, out)
+	}
+
+	if out, code := run(t, addr, "", "cat", file.UUID); code != 0 || out != data {
+		t.Fatalf("should cat %q but got %q, exit code: %d", data, out, code)
+	}
+
+	// failures exit with 1, so that pipelines can tell
+	for _, args := range [][]string{{"upload", "not-exist"}, {"download", "not-exist"}, {"cat", "not-exist"}} {
+		if _, code := run(t, addr, "", args...); code != 1 {
+			t.Fatalf("%v should exit with 1 but got %d", args, code)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	fake, addr, stop := fakeCluster(t)
+	defer stop()
+	dir, err := ioutil.TempDir("", "hfsclient-download")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := "hello, hfs"
+	out, _ := run(t, addr, data, "upload", "--quiet", "--name", "hello.txt", "-")
+	fileUUID := strings.TrimSpace(out)
+
+	tests := []struct {
+		name string
+		args []string
+		path string // where the file should be
+	}{
+		{"to a chosen path", []string{"-o", dir + "/chosen.txt"}, dir + "/chosen.txt"},
+		{"to a directory with the origin name", []string{"-o", dir}, dir + "/hello.txt"},
+	}
+	for _, tt := range tests {
+		// bool flags are put last, otherwise the next argument is taken as their value
+		if _, code := run(t, addr, "", append(append([]string{"download", fileUUID}, tt.args...), "--quiet")...); code != 0 {
+			t.Fatalf("%s: download should succeed but exit with %d", tt.name, code)
+		}
+		if b, err := ioutil.ReadFile(tt.path); err != nil || string(b) != data {
+			t.Fatalf("%s: should download %q to %s but got %q, err: %v", tt.name, data, tt.path, b, err)
+		}
+	}
+
+	// a failed download exits with 1, and the existing file is left as is without temporary files
+	delete(fake.chunks, fileUUID+"-1")
+	for _, args := range [][]string{{"download", fileUUID, "-o", dir + "/chosen.txt"}, {"download", fileUUID, "-o", dir}, {"cat", fileUUID}} {
+		if _, code := run(t, addr, "", args...); code != 1 {
+			t.Fatalf("%v should exit with 1 but got %d", args, code)
+		}
+	}
+	if b, err := ioutil.ReadFile(dir + "/chosen.txt"); err != nil || string(b) != data {
+		t.Fatalf("failed download should not touch the existing file but got %q, err: %v", b, err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 2 {
+		t.Fatalf("failed download should not leave temporary files, but got %d files", len(entries))
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/hfsclient"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	barWidth       = 40
+	redrawInterval = 200 * time.Millisecond
+)
+
+// flags shared by commands which transfer data
+var progressFlags = []cli.Flag{
+	cli.BoolFlag{Name: "quiet, q", Usage: "do not show progress"},
+	cli.BoolFlag{Name: "json", Usage: "print progress and result as JSON lines, for scripts"},
+}
+
+// reporter renders progress of a transfer, as a progress bar in stderr, or as JSON lines in stdout
+type reporter struct {
+	quiet bool
+	json  bool
+	out   io.Writer
+
+	start    time.Time
+	lastDraw time.Time
+	drawn    bool
+}
+
+type progressEvent struct {
+	Event       string  `json:"event"`
+	Transferred int64   `json:"transferred"`
+	Total       int64   `json:"total"`
+	BytesPerSec float64 `json:"bytes_per_sec"`
+	ETASeconds  float64 `json:"eta_seconds"`
+}
+
+type resultEvent struct {
+	Event    string `json:"event"`
+	UUID     string `json:"uuid"`
+	FileName string `json:"file_name"`
+	Size     int64  `json:"size"`
+}
+
+func newReporter(c *cli.Context) *reporter {
+	r := &reporter{quiet: c.Bool("quiet"), json: c.Bool("json"), out: os.Stderr, start: time.Now()}
+	if r.json {
+		r.out = os.Stdout
+	}
+
+	return r
+}
+
+// Progress returns the callback which should be passed to hfsclient
+func (r *reporter) Progress() hfsclient.Progress {
+	if r.quiet {
+		return nil
+	}
+
+	return func(transferred, total int64) {
+		now := time.Now()
+		if now.Sub(r.lastDraw) < redrawInterval && transferred != total {
+			return
+		}
+		r.lastDraw = now
+
+		elapsed := now.Sub(r.start).Seconds()
+		var rate, eta float64
+		if elapsed > 0 {
+			rate = float64(transferred) / elapsed
+		}
+		if rate > 0 && total >= 0 {
+			eta = float64(total-transferred) / rate
+		}
+
+		if r.json {
+			b, _ := json.Marshal(progressEvent{"progress", transferred, total, rate, eta})
+			fmt.Fprintf(r.out, "%s\n", b)
+			return
+		}
+
+		r.drawn = true
+		if total <= 0 {
+			fmt.Fprintf(r.out, "\r%s %s/s", humanBytes(float64(transferred)), humanBytes(rate))
+			return
+		}
+		if eta < 0 {
+			eta = 0
+		}
+		fmt.Fprintf(
+			r.out, "\r%s %3.0f%% %s/%s %s/s ETA %s",
+			bar(transferred, total), 100*float64(clamp(transferred, 0, total))/float64(total),
+			humanBytes(float64(transferred)), humanBytes(float64(total)), humanBytes(rate),
+			time.Duration(eta*float64(time.Second)).Round(time.Second),
+		)
+	}
+}
+
+// bar returns progress bar of transferred bytes out of total, which should be positive. more
+// than total can be transferred if the file grows while it's uploaded
+func bar(transferred, total int64) string {
+	done := int(float64(barWidth) * float64(clamp(transferred, 0, total)) / float64(total))
+	return "[" + strings.Repeat("=", done) + strings.Repeat(" ", barWidth-done) + "]"
+}
+
+func clamp(n, min, max int64) int64 {
+	if n < min {
+		return min
+	} else if n > max {
+		return max
+	}
+	return n
+}
+
+// Done finishes the progress bar and print result of the transfer
+func (r *reporter) Done(msg string, file *pb.File) {
+	if r.drawn {
+		fmt.Fprintf(r.out, "\n")
+	}
+
+	switch {
+	case r.json:
+		b, _ := json.Marshal(resultEvent{"done", file.UUID, file.FileName, file.Size})
+		fmt.Printf("%s\n", b)
+	case r.quiet:
+		fmt.Printf("%s\n", file.UUID)
+	default:
+		fmt.Print(msg)
+	}
+}
+
+func humanBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBar(t *testing.T) {
+	tests := []struct {
+		transferred, total int64
+		done               int // count of "="
+	}{
+		{0, 100, 0},
+		{50, 100, barWidth / 2},
+		{100, 100, barWidth},
+		{150, 100, barWidth}, // the file grows while it's uploaded
+		{-1, 100, 0},
+	}
+	for _, tt := range tests {
+		got := bar(tt.transferred, tt.total)
+		if len(got) != barWidth+2 || strings.Count(got, "=") != tt.done {
+			t.Errorf("bar(%d, %d) should have %d of %d done but got %q", tt.transferred, tt.total, tt.done, barWidth, got)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		name               string
+		json               bool
+		transferred, total int64
+		want               string
+	}{
+		{"bar", false, 512, 1024, "512.0B/1.0KiB"},
+		{"grown file", false, 2048, 1024, " 100% 2.0KiB/1.0KiB"},
+		{"unknown size", false, 2048, -1, "\r2.0KiB "},
+		{"empty file", false, 0, 0, "\r0.0B "},
+		{"json", true, 2048, 1024, `{"event":"progress","transferred":2048,"total":1024,`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		r := &reporter{json: tt.json, out: &buf, start: time.Now().Add(-time.Second)}
+		r.Progress()(tt.transferred, tt.total)
+
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("%s: progress should contain %q but got %q", tt.name, tt.want, buf.String())
+		}
+	}
+
+	// progress is not drawn in quiet mode
+	if (&reporter{quiet: true}).Progress() != nil {
+		t.Errorf("progress should be nil in quiet mode")
+	}
+}
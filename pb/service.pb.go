@@ -29,6 +29,10 @@ type Chunk struct {
 	Used                 int64    `protobuf:"varint,3,opt,name=used,proto3" json:"used,omitempty"`
 	Replicas             []string `protobuf:"bytes,4,rep,name=replicas,proto3" json:"replicas,omitempty"`
 	FileUUID             string   `protobuf:"bytes,5,opt,name=FileUUID,proto3" json:"FileUUID,omitempty"`
+	Packed               bool     `protobuf:"varint,6,opt,name=packed,proto3" json:"packed,omitempty"`
+	Offset               int64    `protobuf:"varint,7,opt,name=offset,proto3" json:"offset,omitempty"`
+	Codec                string   `protobuf:"bytes,8,opt,name=codec,proto3" json:"codec,omitempty"`
+	CompressedSize       int64    `protobuf:"varint,9,opt,name=compressed_size,json=compressedSize,proto3" json:"compressed_size,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -38,7 +42,7 @@ func (m *Chunk) Reset()         { *m = Chunk{} }
 func (m *Chunk) String() string { return proto.CompactTextString(m) }
 func (*Chunk) ProtoMessage()    {}
 func (*Chunk) Descriptor() ([]byte, []int) {
-	return fileDescriptor_service_651b81b5a77b4f09, []int{0}
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{0}
 }
 func (m *Chunk) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Chunk.Unmarshal(m, b)
@@ -93,24 +97,56 @@ func (m *Chunk) GetFileUUID() string {
 	return ""
 }
 
+func (m *Chunk) GetPacked() bool {
+	if m != nil {
+		return m.Packed
+	}
+	return false
+}
+
+func (m *Chunk) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *Chunk) GetCodec() string {
+	if m != nil {
+		return m.Codec
+	}
+	return ""
+}
+
+func (m *Chunk) GetCompressedSize() int64 {
+	if m != nil {
+		return m.CompressedSize
+	}
+	return 0
+}
+
 type File struct {
-	UUID                 string   `protobuf:"bytes,1,opt,name=UUID,proto3" json:"UUID,omitempty"`
-	FileName             string   `protobuf:"bytes,2,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
-	Size                 int64    `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
-	ReplicaNum           int32    `protobuf:"varint,4,opt,name=replica_num,json=replicaNum,proto3" json:"replica_num,omitempty"`
-	CreatedAt            int64    `protobuf:"varint,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
-	UpdatedAt            int64    `protobuf:"varint,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
-	Chunks               []*Chunk `protobuf:"bytes,7,rep,name=chunks,proto3" json:"chunks,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	UUID                 string      `protobuf:"bytes,1,opt,name=UUID,proto3" json:"UUID,omitempty"`
+	FileName             string      `protobuf:"bytes,2,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	Size                 int64       `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	ReplicaNum           int32       `protobuf:"varint,4,opt,name=replica_num,json=replicaNum,proto3" json:"replica_num,omitempty"`
+	CreatedAt            int64       `protobuf:"varint,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt            int64       `protobuf:"varint,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Chunks               []*Chunk    `protobuf:"bytes,7,rep,name=chunks,proto3" json:"chunks,omitempty"`
+	Encryption           *Encryption `protobuf:"bytes,8,opt,name=encryption,proto3" json:"encryption,omitempty"`
+	Owner                string      `protobuf:"bytes,9,opt,name=owner,proto3" json:"owner,omitempty"`
+	Mode                 uint32      `protobuf:"varint,10,opt,name=mode,proto3" json:"mode,omitempty"`
+	Acl                  []*Grant    `protobuf:"bytes,11,rep,name=acl,proto3" json:"acl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
 }
 
 func (m *File) Reset()         { *m = File{} }
 func (m *File) String() string { return proto.CompactTextString(m) }
 func (*File) ProtoMessage()    {}
 func (*File) Descriptor() ([]byte, []int) {
-	return fileDescriptor_service_651b81b5a77b4f09, []int{1}
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{1}
 }
 func (m *File) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_File.Unmarshal(m, b)
@@ -179,88 +215,815 @@ func (m *File) GetChunks() []*Chunk {
 	return nil
 }
 
-type FileChunkData struct {
-	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
-	// msg it describe these data, may be file name, file uuid, chunk uuid, or something else.
-	// depends on what it need
-	Msg                  string   `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
+func (m *File) GetEncryption() *Encryption {
+	if m != nil {
+		return m.Encryption
+	}
+	return nil
+}
+
+func (m *File) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *File) GetMode() uint32 {
+	if m != nil {
+		return m.Mode
+	}
+	return 0
+}
+
+func (m *File) GetAcl() []*Grant {
+	if m != nil {
+		return m.Acl
+	}
+	return nil
+}
+
+// Grant gives permissions of a file to a user
+type Grant struct {
+	User                 string   `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Perm                 uint32   `protobuf:"varint,2,opt,name=perm,proto3" json:"perm,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Grant) Reset()         { *m = Grant{} }
+func (m *Grant) String() string { return proto.CompactTextString(m) }
+func (*Grant) ProtoMessage()    {}
+func (*Grant) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{2}
+}
+func (m *Grant) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Grant.Unmarshal(m, b)
+}
+func (m *Grant) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Grant.Marshal(b, m, deterministic)
+}
+func (dst *Grant) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Grant.Merge(dst, src)
+}
+func (m *Grant) XXX_Size() int {
+	return xxx_messageInfo_Grant.Size(m)
+}
+func (m *Grant) XXX_DiscardUnknown() {
+	xxx_messageInfo_Grant.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Grant proto.InternalMessageInfo
+
+func (m *Grant) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *Grant) GetPerm() uint32 {
+	if m != nil {
+		return m.Perm
+	}
+	return 0
+}
+
+// Encryption describes how a file is encrypted by client, chunkservers only see ciphertext
+type Encryption struct {
+	Scheme               string   `protobuf:"bytes,1,opt,name=scheme,proto3" json:"scheme,omitempty"`
+	KeyId                string   `protobuf:"bytes,2,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
+	WrappedKey           []byte   `protobuf:"bytes,3,opt,name=wrapped_key,json=wrappedKey,proto3" json:"wrapped_key,omitempty"`
+	NoncePrefix          []byte   `protobuf:"bytes,4,opt,name=nonce_prefix,json=noncePrefix,proto3" json:"nonce_prefix,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Encryption) Reset()         { *m = Encryption{} }
+func (m *Encryption) String() string { return proto.CompactTextString(m) }
+func (*Encryption) ProtoMessage()    {}
+func (*Encryption) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{3}
+}
+func (m *Encryption) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Encryption.Unmarshal(m, b)
+}
+func (m *Encryption) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Encryption.Marshal(b, m, deterministic)
+}
+func (dst *Encryption) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Encryption.Merge(dst, src)
+}
+func (m *Encryption) XXX_Size() int {
+	return xxx_messageInfo_Encryption.Size(m)
+}
+func (m *Encryption) XXX_DiscardUnknown() {
+	xxx_messageInfo_Encryption.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Encryption proto.InternalMessageInfo
+
+func (m *Encryption) GetScheme() string {
+	if m != nil {
+		return m.Scheme
+	}
+	return ""
+}
+
+func (m *Encryption) GetKeyId() string {
+	if m != nil {
+		return m.KeyId
+	}
+	return ""
+}
+
+func (m *Encryption) GetWrappedKey() []byte {
+	if m != nil {
+		return m.WrappedKey
+	}
+	return nil
+}
+
+func (m *Encryption) GetNoncePrefix() []byte {
+	if m != nil {
+		return m.NoncePrefix
+	}
+	return nil
+}
+
+type FileChunkData struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// msg it describe these data, may be file name, file uuid, chunk uuid, or something else.
+	// depends on what it need
+	Msg                  string      `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
+	Codec                string      `protobuf:"bytes,3,opt,name=codec,proto3" json:"codec,omitempty"`
+	Encryption           *Encryption `protobuf:"bytes,4,opt,name=encryption,proto3" json:"encryption,omitempty"`
+	Mode                 uint32      `protobuf:"varint,5,opt,name=mode,proto3" json:"mode,omitempty"`
+	Acl                  []*Grant    `protobuf:"bytes,6,rep,name=acl,proto3" json:"acl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *FileChunkData) Reset()         { *m = FileChunkData{} }
+func (m *FileChunkData) String() string { return proto.CompactTextString(m) }
+func (*FileChunkData) ProtoMessage()    {}
+func (*FileChunkData) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{4}
+}
+func (m *FileChunkData) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileChunkData.Unmarshal(m, b)
+}
+func (m *FileChunkData) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileChunkData.Marshal(b, m, deterministic)
+}
+func (dst *FileChunkData) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileChunkData.Merge(dst, src)
+}
+func (m *FileChunkData) XXX_Size() int {
+	return xxx_messageInfo_FileChunkData.Size(m)
+}
+func (m *FileChunkData) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileChunkData.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileChunkData proto.InternalMessageInfo
+
+func (m *FileChunkData) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *FileChunkData) GetMsg() string {
+	if m != nil {
+		return m.Msg
+	}
+	return ""
+}
+
+func (m *FileChunkData) GetCodec() string {
+	if m != nil {
+		return m.Codec
+	}
+	return ""
+}
+
+func (m *FileChunkData) GetEncryption() *Encryption {
+	if m != nil {
+		return m.Encryption
+	}
+	return nil
+}
+
+func (m *FileChunkData) GetMode() uint32 {
+	if m != nil {
+		return m.Mode
+	}
+	return 0
+}
+
+func (m *FileChunkData) GetAcl() []*Grant {
+	if m != nil {
+		return m.Acl
+	}
+	return nil
+}
+
+type ReadFileRequest struct {
+	FileUUID             string   `protobuf:"bytes,1,opt,name=FileUUID,proto3" json:"FileUUID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReadFileRequest) Reset()         { *m = ReadFileRequest{} }
+func (m *ReadFileRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadFileRequest) ProtoMessage()    {}
+func (*ReadFileRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{5}
+}
+func (m *ReadFileRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReadFileRequest.Unmarshal(m, b)
+}
+func (m *ReadFileRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReadFileRequest.Marshal(b, m, deterministic)
+}
+func (dst *ReadFileRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReadFileRequest.Merge(dst, src)
+}
+func (m *ReadFileRequest) XXX_Size() int {
+	return xxx_messageInfo_ReadFileRequest.Size(m)
+}
+func (m *ReadFileRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReadFileRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReadFileRequest proto.InternalMessageInfo
+
+func (m *ReadFileRequest) GetFileUUID() string {
+	if m != nil {
+		return m.FileUUID
+	}
+	return ""
+}
+
+type ReadChunkRequest struct {
+	ChunkUUID            string   `protobuf:"bytes,1,opt,name=ChunkUUID,proto3" json:"ChunkUUID,omitempty"`
+	Offset               int64    `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length               int64    `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	FileUUID             string   `protobuf:"bytes,4,opt,name=FileUUID,proto3" json:"FileUUID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReadChunkRequest) Reset()         { *m = ReadChunkRequest{} }
+func (m *ReadChunkRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadChunkRequest) ProtoMessage()    {}
+func (*ReadChunkRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{6}
+}
+func (m *ReadChunkRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReadChunkRequest.Unmarshal(m, b)
+}
+func (m *ReadChunkRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReadChunkRequest.Marshal(b, m, deterministic)
+}
+func (dst *ReadChunkRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReadChunkRequest.Merge(dst, src)
+}
+func (m *ReadChunkRequest) XXX_Size() int {
+	return xxx_messageInfo_ReadChunkRequest.Size(m)
+}
+func (m *ReadChunkRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReadChunkRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReadChunkRequest proto.InternalMessageInfo
+
+func (m *ReadChunkRequest) GetChunkUUID() string {
+	if m != nil {
+		return m.ChunkUUID
+	}
+	return ""
+}
+
+func (m *ReadChunkRequest) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *ReadChunkRequest) GetLength() int64 {
+	if m != nil {
+		return m.Length
+	}
+	return 0
+}
+
+func (m *ReadChunkRequest) GetFileUUID() string {
+	if m != nil {
+		return m.FileUUID
+	}
+	return ""
+}
+
+type RemoveChunkRequest struct {
+	ChunkUUID            string   `protobuf:"bytes,1,opt,name=ChunkUUID,proto3" json:"ChunkUUID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RemoveChunkRequest) Reset()         { *m = RemoveChunkRequest{} }
+func (m *RemoveChunkRequest) String() string { return proto.CompactTextString(m) }
+func (*RemoveChunkRequest) ProtoMessage()    {}
+func (*RemoveChunkRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{7}
+}
+func (m *RemoveChunkRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RemoveChunkRequest.Unmarshal(m, b)
+}
+func (m *RemoveChunkRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RemoveChunkRequest.Marshal(b, m, deterministic)
+}
+func (dst *RemoveChunkRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RemoveChunkRequest.Merge(dst, src)
+}
+func (m *RemoveChunkRequest) XXX_Size() int {
+	return xxx_messageInfo_RemoveChunkRequest.Size(m)
+}
+func (m *RemoveChunkRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RemoveChunkRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RemoveChunkRequest proto.InternalMessageInfo
+
+func (m *RemoveChunkRequest) GetChunkUUID() string {
+	if m != nil {
+		return m.ChunkUUID
+	}
+	return ""
+}
+
+type ReplicateChunkRequest struct {
+	ChunkUUID            string   `protobuf:"bytes,1,opt,name=ChunkUUID,proto3" json:"ChunkUUID,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReplicateChunkRequest) Reset()         { *m = ReplicateChunkRequest{} }
+func (m *ReplicateChunkRequest) String() string { return proto.CompactTextString(m) }
+func (*ReplicateChunkRequest) ProtoMessage()    {}
+func (*ReplicateChunkRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{8}
+}
+func (m *ReplicateChunkRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReplicateChunkRequest.Unmarshal(m, b)
+}
+func (m *ReplicateChunkRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReplicateChunkRequest.Marshal(b, m, deterministic)
+}
+func (dst *ReplicateChunkRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplicateChunkRequest.Merge(dst, src)
+}
+func (m *ReplicateChunkRequest) XXX_Size() int {
+	return xxx_messageInfo_ReplicateChunkRequest.Size(m)
+}
+func (m *ReplicateChunkRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReplicateChunkRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReplicateChunkRequest proto.InternalMessageInfo
+
+func (m *ReplicateChunkRequest) GetChunkUUID() string {
+	if m != nil {
+		return m.ChunkUUID
+	}
+	return ""
+}
+
+type ListFilesRequest struct {
+	StartAfter           string   `protobuf:"bytes,1,opt,name=start_after,json=startAfter,proto3" json:"start_after,omitempty"`
+	Limit                int64    `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListFilesRequest) Reset()         { *m = ListFilesRequest{} }
+func (m *ListFilesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListFilesRequest) ProtoMessage()    {}
+func (*ListFilesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{9}
+}
+func (m *ListFilesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFilesRequest.Unmarshal(m, b)
+}
+func (m *ListFilesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFilesRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListFilesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFilesRequest.Merge(dst, src)
+}
+func (m *ListFilesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListFilesRequest.Size(m)
+}
+func (m *ListFilesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFilesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFilesRequest proto.InternalMessageInfo
+
+func (m *ListFilesRequest) GetStartAfter() string {
+	if m != nil {
+		return m.StartAfter
+	}
+	return ""
+}
+
+func (m *ListFilesRequest) GetLimit() int64 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type ListFilesResponse struct {
+	Files                []*File  `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	More                 bool     `protobuf:"varint,2,opt,name=more,proto3" json:"more,omitempty"`
+	Last                 string   `protobuf:"bytes,3,opt,name=last,proto3" json:"last,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListFilesResponse) Reset()         { *m = ListFilesResponse{} }
+func (m *ListFilesResponse) String() string { return proto.CompactTextString(m) }
+func (*ListFilesResponse) ProtoMessage()    {}
+func (*ListFilesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{10}
+}
+func (m *ListFilesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFilesResponse.Unmarshal(m, b)
+}
+func (m *ListFilesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFilesResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListFilesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFilesResponse.Merge(dst, src)
+}
+func (m *ListFilesResponse) XXX_Size() int {
+	return xxx_messageInfo_ListFilesResponse.Size(m)
+}
+func (m *ListFilesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFilesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFilesResponse proto.InternalMessageInfo
+
+func (m *ListFilesResponse) GetFiles() []*File {
+	if m != nil {
+		return m.Files
+	}
+	return nil
+}
+
+func (m *ListFilesResponse) GetMore() bool {
+	if m != nil {
+		return m.More
+	}
+	return false
+}
+
+func (m *ListFilesResponse) GetLast() string {
+	if m != nil {
+		return m.Last
+	}
+	return ""
+}
+
+type ChmodRequest struct {
+	FileUUID             string   `protobuf:"bytes,1,opt,name=FileUUID,proto3" json:"FileUUID,omitempty"`
+	Mode                 uint32   `protobuf:"varint,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	Acl                  []*Grant `protobuf:"bytes,3,rep,name=acl,proto3" json:"acl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ChmodRequest) Reset()         { *m = ChmodRequest{} }
+func (m *ChmodRequest) String() string { return proto.CompactTextString(m) }
+func (*ChmodRequest) ProtoMessage()    {}
+func (*ChmodRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{11}
+}
+func (m *ChmodRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChmodRequest.Unmarshal(m, b)
+}
+func (m *ChmodRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChmodRequest.Marshal(b, m, deterministic)
+}
+func (dst *ChmodRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChmodRequest.Merge(dst, src)
+}
+func (m *ChmodRequest) XXX_Size() int {
+	return xxx_messageInfo_ChmodRequest.Size(m)
+}
+func (m *ChmodRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChmodRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChmodRequest proto.InternalMessageInfo
+
+func (m *ChmodRequest) GetFileUUID() string {
+	if m != nil {
+		return m.FileUUID
+	}
+	return ""
+}
+
+func (m *ChmodRequest) GetMode() uint32 {
+	if m != nil {
+		return m.Mode
+	}
+	return 0
+}
+
+func (m *ChmodRequest) GetAcl() []*Grant {
+	if m != nil {
+		return m.Acl
+	}
+	return nil
+}
+
+// Quota limits how many bytes and files a user can own, and tracks how many the user owns
+type Quota struct {
+	Owner                string   `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	MaxBytes             int64    `protobuf:"varint,2,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`
+	MaxFiles             int64    `protobuf:"varint,3,opt,name=max_files,json=maxFiles,proto3" json:"max_files,omitempty"`
+	UsedBytes            int64    `protobuf:"varint,4,opt,name=used_bytes,json=usedBytes,proto3" json:"used_bytes,omitempty"`
+	UsedFiles            int64    `protobuf:"varint,5,opt,name=used_files,json=usedFiles,proto3" json:"used_files,omitempty"`
+	KeepMaxBytes         bool     `protobuf:"varint,6,opt,name=keep_max_bytes,json=keepMaxBytes,proto3" json:"keep_max_bytes,omitempty"`
+	KeepMaxFiles         bool     `protobuf:"varint,7,opt,name=keep_max_files,json=keepMaxFiles,proto3" json:"keep_max_files,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Quota) Reset()         { *m = Quota{} }
+func (m *Quota) String() string { return proto.CompactTextString(m) }
+func (*Quota) ProtoMessage()    {}
+func (*Quota) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{12}
+}
+func (m *Quota) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Quota.Unmarshal(m, b)
+}
+func (m *Quota) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Quota.Marshal(b, m, deterministic)
+}
+func (dst *Quota) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Quota.Merge(dst, src)
+}
+func (m *Quota) XXX_Size() int {
+	return xxx_messageInfo_Quota.Size(m)
+}
+func (m *Quota) XXX_DiscardUnknown() {
+	xxx_messageInfo_Quota.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Quota proto.InternalMessageInfo
+
+func (m *Quota) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *Quota) GetMaxBytes() int64 {
+	if m != nil {
+		return m.MaxBytes
+	}
+	return 0
+}
+
+func (m *Quota) GetMaxFiles() int64 {
+	if m != nil {
+		return m.MaxFiles
+	}
+	return 0
+}
+
+func (m *Quota) GetUsedBytes() int64 {
+	if m != nil {
+		return m.UsedBytes
+	}
+	return 0
+}
+
+func (m *Quota) GetUsedFiles() int64 {
+	if m != nil {
+		return m.UsedFiles
+	}
+	return 0
+}
+
+func (m *Quota) GetKeepMaxBytes() bool {
+	if m != nil {
+		return m.KeepMaxBytes
+	}
+	return false
+}
+
+func (m *Quota) GetKeepMaxFiles() bool {
+	if m != nil {
+		return m.KeepMaxFiles
+	}
+	return false
+}
+
+type QuotaRequest struct {
+	Owner                string   `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QuotaRequest) Reset()         { *m = QuotaRequest{} }
+func (m *QuotaRequest) String() string { return proto.CompactTextString(m) }
+func (*QuotaRequest) ProtoMessage()    {}
+func (*QuotaRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{13}
+}
+func (m *QuotaRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QuotaRequest.Unmarshal(m, b)
+}
+func (m *QuotaRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QuotaRequest.Marshal(b, m, deterministic)
+}
+func (dst *QuotaRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QuotaRequest.Merge(dst, src)
+}
+func (m *QuotaRequest) XXX_Size() int {
+	return xxx_messageInfo_QuotaRequest.Size(m)
+}
+func (m *QuotaRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_QuotaRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QuotaRequest proto.InternalMessageInfo
+
+func (m *QuotaRequest) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+type LeaderRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LeaderRequest) Reset()         { *m = LeaderRequest{} }
+func (m *LeaderRequest) String() string { return proto.CompactTextString(m) }
+func (*LeaderRequest) ProtoMessage()    {}
+func (*LeaderRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{14}
+}
+func (m *LeaderRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LeaderRequest.Unmarshal(m, b)
+}
+func (m *LeaderRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LeaderRequest.Marshal(b, m, deterministic)
+}
+func (dst *LeaderRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LeaderRequest.Merge(dst, src)
+}
+func (m *LeaderRequest) XXX_Size() int {
+	return xxx_messageInfo_LeaderRequest.Size(m)
+}
+func (m *LeaderRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_LeaderRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LeaderRequest proto.InternalMessageInfo
+
+// Leader is the chunkserver which coordinates cluster-wide tasks
+type Leader struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Addr                 string   `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+	Term                 int64    `protobuf:"varint,3,opt,name=term,proto3" json:"term,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *FileChunkData) Reset()         { *m = FileChunkData{} }
-func (m *FileChunkData) String() string { return proto.CompactTextString(m) }
-func (*FileChunkData) ProtoMessage()    {}
-func (*FileChunkData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_service_651b81b5a77b4f09, []int{2}
+func (m *Leader) Reset()         { *m = Leader{} }
+func (m *Leader) String() string { return proto.CompactTextString(m) }
+func (*Leader) ProtoMessage()    {}
+func (*Leader) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{15}
 }
-func (m *FileChunkData) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_FileChunkData.Unmarshal(m, b)
+func (m *Leader) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Leader.Unmarshal(m, b)
 }
-func (m *FileChunkData) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_FileChunkData.Marshal(b, m, deterministic)
+func (m *Leader) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Leader.Marshal(b, m, deterministic)
 }
-func (dst *FileChunkData) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_FileChunkData.Merge(dst, src)
+func (dst *Leader) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Leader.Merge(dst, src)
 }
-func (m *FileChunkData) XXX_Size() int {
-	return xxx_messageInfo_FileChunkData.Size(m)
+func (m *Leader) XXX_Size() int {
+	return xxx_messageInfo_Leader.Size(m)
 }
-func (m *FileChunkData) XXX_DiscardUnknown() {
-	xxx_messageInfo_FileChunkData.DiscardUnknown(m)
+func (m *Leader) XXX_DiscardUnknown() {
+	xxx_messageInfo_Leader.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_FileChunkData proto.InternalMessageInfo
+var xxx_messageInfo_Leader proto.InternalMessageInfo
 
-func (m *FileChunkData) GetData() []byte {
+func (m *Leader) GetName() string {
 	if m != nil {
-		return m.Data
+		return m.Name
 	}
-	return nil
+	return ""
 }
 
-func (m *FileChunkData) GetMsg() string {
+func (m *Leader) GetAddr() string {
 	if m != nil {
-		return m.Msg
+		return m.Addr
 	}
 	return ""
 }
 
-type ReadFileRequest struct {
-	FileUUID             string   `protobuf:"bytes,1,opt,name=FileUUID,proto3" json:"FileUUID,omitempty"`
+func (m *Leader) GetTerm() int64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+// ErrorDetail is attached to gRPC status of errors returned by chunkservers
+type ErrorDetail struct {
+	Reason               string   `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	Resource             string   `protobuf:"bytes,2,opt,name=resource,proto3" json:"resource,omitempty"`
+	Node                 string   `protobuf:"bytes,3,opt,name=node,proto3" json:"node,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *ReadFileRequest) Reset()         { *m = ReadFileRequest{} }
-func (m *ReadFileRequest) String() string { return proto.CompactTextString(m) }
-func (*ReadFileRequest) ProtoMessage()    {}
-func (*ReadFileRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_service_651b81b5a77b4f09, []int{3}
+func (m *ErrorDetail) Reset()         { *m = ErrorDetail{} }
+func (m *ErrorDetail) String() string { return proto.CompactTextString(m) }
+func (*ErrorDetail) ProtoMessage()    {}
+func (*ErrorDetail) Descriptor() ([]byte, []int) {
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{16}
 }
-func (m *ReadFileRequest) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_ReadFileRequest.Unmarshal(m, b)
+func (m *ErrorDetail) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ErrorDetail.Unmarshal(m, b)
 }
-func (m *ReadFileRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_ReadFileRequest.Marshal(b, m, deterministic)
+func (m *ErrorDetail) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ErrorDetail.Marshal(b, m, deterministic)
 }
-func (dst *ReadFileRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_ReadFileRequest.Merge(dst, src)
+func (dst *ErrorDetail) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ErrorDetail.Merge(dst, src)
 }
-func (m *ReadFileRequest) XXX_Size() int {
-	return xxx_messageInfo_ReadFileRequest.Size(m)
+func (m *ErrorDetail) XXX_Size() int {
+	return xxx_messageInfo_ErrorDetail.Size(m)
 }
-func (m *ReadFileRequest) XXX_DiscardUnknown() {
-	xxx_messageInfo_ReadFileRequest.DiscardUnknown(m)
+func (m *ErrorDetail) XXX_DiscardUnknown() {
+	xxx_messageInfo_ErrorDetail.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_ReadFileRequest proto.InternalMessageInfo
+var xxx_messageInfo_ErrorDetail proto.InternalMessageInfo
 
-func (m *ReadFileRequest) GetFileUUID() string {
+func (m *ErrorDetail) GetReason() string {
 	if m != nil {
-		return m.FileUUID
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *ErrorDetail) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *ErrorDetail) GetNode() string {
+	if m != nil {
+		return m.Node
 	}
 	return ""
 }
@@ -277,7 +1040,7 @@ func (m *GenericResponse) Reset()         { *m = GenericResponse{} }
 func (m *GenericResponse) String() string { return proto.CompactTextString(m) }
 func (*GenericResponse) ProtoMessage()    {}
 func (*GenericResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_service_651b81b5a77b4f09, []int{4}
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{17}
 }
 func (m *GenericResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_GenericResponse.Unmarshal(m, b)
@@ -324,7 +1087,7 @@ func (m *CreateFileResponse) Reset()         { *m = CreateFileResponse{} }
 func (m *CreateFileResponse) String() string { return proto.CompactTextString(m) }
 func (*CreateFileResponse) ProtoMessage()    {}
 func (*CreateFileResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_service_651b81b5a77b4f09, []int{5}
+	return fileDescriptor_service_9cfba3f99adeb32f, []int{18}
 }
 func (m *CreateFileResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_CreateFileResponse.Unmarshal(m, b)
@@ -368,8 +1131,21 @@ func (m *CreateFileResponse) GetFile() *File {
 func init() {
 	proto.RegisterType((*Chunk)(nil), "pb.Chunk")
 	proto.RegisterType((*File)(nil), "pb.File")
+	proto.RegisterType((*Grant)(nil), "pb.Grant")
+	proto.RegisterType((*Encryption)(nil), "pb.Encryption")
 	proto.RegisterType((*FileChunkData)(nil), "pb.FileChunkData")
 	proto.RegisterType((*ReadFileRequest)(nil), "pb.ReadFileRequest")
+	proto.RegisterType((*ReadChunkRequest)(nil), "pb.ReadChunkRequest")
+	proto.RegisterType((*RemoveChunkRequest)(nil), "pb.RemoveChunkRequest")
+	proto.RegisterType((*ReplicateChunkRequest)(nil), "pb.ReplicateChunkRequest")
+	proto.RegisterType((*ListFilesRequest)(nil), "pb.ListFilesRequest")
+	proto.RegisterType((*ListFilesResponse)(nil), "pb.ListFilesResponse")
+	proto.RegisterType((*ChmodRequest)(nil), "pb.ChmodRequest")
+	proto.RegisterType((*Quota)(nil), "pb.Quota")
+	proto.RegisterType((*QuotaRequest)(nil), "pb.QuotaRequest")
+	proto.RegisterType((*LeaderRequest)(nil), "pb.LeaderRequest")
+	proto.RegisterType((*Leader)(nil), "pb.Leader")
+	proto.RegisterType((*ErrorDetail)(nil), "pb.ErrorDetail")
 	proto.RegisterType((*GenericResponse)(nil), "pb.GenericResponse")
 	proto.RegisterType((*CreateFileResponse)(nil), "pb.CreateFileResponse")
 }
@@ -390,6 +1166,15 @@ type ChunkServerClient interface {
 	RemoveFile(ctx context.Context, in *File, opts ...grpc.CallOption) (*GenericResponse, error)
 	ReadFile(ctx context.Context, in *ReadFileRequest, opts ...grpc.CallOption) (ChunkServer_ReadFileClient, error)
 	CreateChunk(ctx context.Context, in *FileChunkData, opts ...grpc.CallOption) (*GenericResponse, error)
+	GetFile(ctx context.Context, in *ReadFileRequest, opts ...grpc.CallOption) (*File, error)
+	ReadChunk(ctx context.Context, in *ReadChunkRequest, opts ...grpc.CallOption) (*FileChunkData, error)
+	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
+	RemoveChunk(ctx context.Context, in *RemoveChunkRequest, opts ...grpc.CallOption) (*GenericResponse, error)
+	Chmod(ctx context.Context, in *ChmodRequest, opts ...grpc.CallOption) (*GenericResponse, error)
+	GetQuota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*Quota, error)
+	SetQuota(ctx context.Context, in *Quota, opts ...grpc.CallOption) (*GenericResponse, error)
+	ReplicateChunk(ctx context.Context, in *ReplicateChunkRequest, opts ...grpc.CallOption) (*GenericResponse, error)
+	GetLeader(ctx context.Context, in *LeaderRequest, opts ...grpc.CallOption) (*Leader, error)
 }
 
 type chunkServerClient struct {
@@ -484,12 +1269,102 @@ func (c *chunkServerClient) CreateChunk(ctx context.Context, in *FileChunkData,
 	return out, nil
 }
 
+func (c *chunkServerClient) GetFile(ctx context.Context, in *ReadFileRequest, opts ...grpc.CallOption) (*File, error) {
+	out := new(File)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/GetFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) ReadChunk(ctx context.Context, in *ReadChunkRequest, opts ...grpc.CallOption) (*FileChunkData, error) {
+	out := new(FileChunkData)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/ReadChunk", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error) {
+	out := new(ListFilesResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/ListFiles", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) RemoveChunk(ctx context.Context, in *RemoveChunkRequest, opts ...grpc.CallOption) (*GenericResponse, error) {
+	out := new(GenericResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/RemoveChunk", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) Chmod(ctx context.Context, in *ChmodRequest, opts ...grpc.CallOption) (*GenericResponse, error) {
+	out := new(GenericResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/Chmod", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) GetQuota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*Quota, error) {
+	out := new(Quota)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/GetQuota", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) SetQuota(ctx context.Context, in *Quota, opts ...grpc.CallOption) (*GenericResponse, error) {
+	out := new(GenericResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/SetQuota", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) ReplicateChunk(ctx context.Context, in *ReplicateChunkRequest, opts ...grpc.CallOption) (*GenericResponse, error) {
+	out := new(GenericResponse)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/ReplicateChunk", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkServerClient) GetLeader(ctx context.Context, in *LeaderRequest, opts ...grpc.CallOption) (*Leader, error) {
+	out := new(Leader)
+	err := c.cc.Invoke(ctx, "/pb.ChunkServer/GetLeader", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChunkServerServer is the server API for ChunkServer service.
 type ChunkServerServer interface {
 	CreateFile(ChunkServer_CreateFileServer) error
 	RemoveFile(context.Context, *File) (*GenericResponse, error)
 	ReadFile(*ReadFileRequest, ChunkServer_ReadFileServer) error
 	CreateChunk(context.Context, *FileChunkData) (*GenericResponse, error)
+	GetFile(context.Context, *ReadFileRequest) (*File, error)
+	ReadChunk(context.Context, *ReadChunkRequest) (*FileChunkData, error)
+	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
+	RemoveChunk(context.Context, *RemoveChunkRequest) (*GenericResponse, error)
+	Chmod(context.Context, *ChmodRequest) (*GenericResponse, error)
+	GetQuota(context.Context, *QuotaRequest) (*Quota, error)
+	SetQuota(context.Context, *Quota) (*GenericResponse, error)
+	ReplicateChunk(context.Context, *ReplicateChunkRequest) (*GenericResponse, error)
+	GetLeader(context.Context, *LeaderRequest) (*Leader, error)
 }
 
 func RegisterChunkServerServer(s *grpc.Server, srv ChunkServerServer) {
@@ -579,6 +1454,168 @@ func _ChunkServer_CreateChunk_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ChunkServer_GetFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).GetFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/GetFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).GetFile(ctx, req.(*ReadFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_ReadChunk_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadChunkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).ReadChunk(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/ReadChunk",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).ReadChunk(ctx, req.(*ReadChunkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).ListFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/ListFiles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).ListFiles(ctx, req.(*ListFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_RemoveChunk_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveChunkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).RemoveChunk(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/RemoveChunk",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).RemoveChunk(ctx, req.(*RemoveChunkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_Chmod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChmodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).Chmod(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/Chmod",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).Chmod(ctx, req.(*ChmodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_GetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).GetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/GetQuota",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).GetQuota(ctx, req.(*QuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_SetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Quota)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).SetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/SetQuota",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).SetQuota(ctx, req.(*Quota))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_ReplicateChunk_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplicateChunkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).ReplicateChunk(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/ReplicateChunk",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).ReplicateChunk(ctx, req.(*ReplicateChunkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkServer_GetLeader_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkServerServer).GetLeader(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ChunkServer/GetLeader",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkServerServer).GetLeader(ctx, req.(*LeaderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _ChunkServer_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.ChunkServer",
 	HandlerType: (*ChunkServerServer)(nil),
@@ -591,6 +1628,42 @@ var _ChunkServer_serviceDesc = grpc.ServiceDesc{
 			MethodName: "CreateChunk",
 			Handler:    _ChunkServer_CreateChunk_Handler,
 		},
+		{
+			MethodName: "GetFile",
+			Handler:    _ChunkServer_GetFile_Handler,
+		},
+		{
+			MethodName: "ReadChunk",
+			Handler:    _ChunkServer_ReadChunk_Handler,
+		},
+		{
+			MethodName: "ListFiles",
+			Handler:    _ChunkServer_ListFiles_Handler,
+		},
+		{
+			MethodName: "RemoveChunk",
+			Handler:    _ChunkServer_RemoveChunk_Handler,
+		},
+		{
+			MethodName: "Chmod",
+			Handler:    _ChunkServer_Chmod_Handler,
+		},
+		{
+			MethodName: "GetQuota",
+			Handler:    _ChunkServer_GetQuota_Handler,
+		},
+		{
+			MethodName: "SetQuota",
+			Handler:    _ChunkServer_SetQuota_Handler,
+		},
+		{
+			MethodName: "ReplicateChunk",
+			Handler:    _ChunkServer_ReplicateChunk_Handler,
+		},
+		{
+			MethodName: "GetLeader",
+			Handler:    _ChunkServer_GetLeader_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -607,35 +1680,78 @@ var _ChunkServer_serviceDesc = grpc.ServiceDesc{
 	Metadata: "service.proto",
 }
 
-func init() { proto.RegisterFile("service.proto", fileDescriptor_service_651b81b5a77b4f09) }
-
-var fileDescriptor_service_651b81b5a77b4f09 = []byte{
-	// 427 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x53, 0xcd, 0x8e, 0xd3, 0x30,
-	0x10, 0xae, 0xd7, 0x69, 0x49, 0x26, 0xac, 0x16, 0x8c, 0x84, 0xa2, 0x00, 0x22, 0xe4, 0x94, 0xcb,
-	0x56, 0xa8, 0x08, 0xf6, 0xc0, 0x69, 0xd5, 0x0a, 0xc4, 0xa5, 0x07, 0xa3, 0x4a, 0xdc, 0x2a, 0x37,
-	0x19, 0x20, 0xa2, 0xf9, 0x21, 0x76, 0x7a, 0x80, 0x67, 0xe4, 0x45, 0x78, 0x0a, 0xe4, 0x49, 0x1a,
-	0xa0, 0xcd, 0x65, 0x6f, 0x9f, 0xbf, 0xb1, 0xe7, 0xfb, 0x51, 0x02, 0x97, 0x1a, 0x9b, 0x43, 0x9e,
-	0xe2, 0xbc, 0x6e, 0x2a, 0x53, 0x89, 0x8b, 0x7a, 0x17, 0xff, 0x84, 0xe9, 0xf2, 0x6b, 0x5b, 0x7e,
-	0x13, 0x02, 0x9c, 0xcd, 0xe6, 0xc3, 0x2a, 0x60, 0x11, 0x4b, 0x3c, 0x49, 0xd8, 0x72, 0x3a, 0xff,
-	0x81, 0xc1, 0x45, 0xc4, 0x12, 0x2e, 0x09, 0x5b, 0xae, 0xd5, 0x98, 0x05, 0xbc, 0xe3, 0x2c, 0x16,
-	0x21, 0xb8, 0x0d, 0xd6, 0xfb, 0x3c, 0x55, 0x3a, 0x70, 0x22, 0x9e, 0x78, 0x72, 0x38, 0xdb, 0xd9,
-	0xbb, 0x7c, 0x8f, 0xb4, 0x7b, 0x4a, 0xbb, 0x87, 0x73, 0xfc, 0x8b, 0x81, 0x63, 0x0f, 0xa3, 0xe2,
-	0x4f, 0xc0, 0xfb, 0x9c, 0xef, 0x71, 0x5b, 0xaa, 0xa2, 0x73, 0xe0, 0x49, 0xd7, 0x12, 0x6b, 0x55,
-	0xe0, 0xe0, 0x8c, 0xff, 0xe3, 0xec, 0x39, 0xf8, 0xbd, 0xea, 0xb6, 0x6c, 0x8b, 0xc0, 0x89, 0x58,
-	0x32, 0x95, 0xd0, 0x53, 0xeb, 0xb6, 0x10, 0xcf, 0x00, 0xd2, 0x06, 0x95, 0xc1, 0x6c, 0xab, 0x0c,
-	0x99, 0xe1, 0xd2, 0xeb, 0x99, 0x5b, 0x63, 0xc7, 0x6d, 0x9d, 0x1d, 0xc7, 0xb3, 0x6e, 0xdc, 0x33,
-	0xb7, 0x46, 0xbc, 0x80, 0x59, 0x6a, 0x9b, 0xd2, 0xc1, 0xbd, 0x88, 0x27, 0xfe, 0xc2, 0x9b, 0xd7,
-	0xbb, 0x39, 0x75, 0x27, 0xfb, 0x41, 0xfc, 0x1a, 0x2e, 0x6d, 0x1c, 0x22, 0x57, 0xca, 0x28, 0x6b,
-	0x33, 0x53, 0x46, 0x51, 0xae, 0xfb, 0x92, 0xb0, 0x78, 0x00, 0xbc, 0xd0, 0x5f, 0xfa, 0x44, 0x16,
-	0xc6, 0xd7, 0x70, 0x25, 0x51, 0x65, 0xf6, 0xa9, 0xc4, 0xef, 0x2d, 0x6a, 0xf3, 0x5f, 0x6b, 0xec,
-	0xa4, 0xb5, 0x1b, 0xb8, 0x7a, 0x8f, 0x25, 0x36, 0x79, 0x2a, 0x51, 0xd7, 0x55, 0xa9, 0xa9, 0x8e,
-	0xb4, 0xca, 0x90, 0xae, 0x72, 0x49, 0x78, 0x44, 0xe7, 0x13, 0x88, 0x25, 0xa5, 0xed, 0x94, 0xee,
-	0xf2, 0x56, 0x3c, 0x05, 0xc7, 0x96, 0x4f, 0x85, 0xfb, 0x0b, 0xd7, 0x66, 0xa7, 0x2d, 0xc4, 0x2e,
-	0x7e, 0x33, 0xf0, 0x29, 0xf5, 0x47, 0x6c, 0x0e, 0xd8, 0x88, 0xb7, 0x00, 0x7f, 0x95, 0xc4, 0xc3,
-	0xe3, 0xed, 0xa1, 0x98, 0xf0, 0x31, 0x95, 0x77, 0x66, 0x26, 0x9e, 0x24, 0x4c, 0x5c, 0x03, 0x48,
-	0x2c, 0xaa, 0x43, 0xf7, 0x78, 0x90, 0x0a, 0x1f, 0x59, 0x74, 0x92, 0x3c, 0x9e, 0x88, 0x37, 0xe0,
-	0x1e, 0xdb, 0x13, 0x74, 0xe5, 0xa4, 0xcb, 0xf0, 0x5c, 0x3e, 0x9e, 0xbc, 0x64, 0xe2, 0x06, 0xfc,
-	0xce, 0x40, 0xf7, 0xfd, 0x8f, 0x98, 0x1c, 0x17, 0xdc, 0xcd, 0xe8, 0xef, 0x79, 0xf5, 0x27, 0x00,
-	0x00, 0xff, 0xff, 0xe4, 0x51, 0x38, 0xe3, 0x4e, 0x03, 0x00, 0x00,
+func init() { proto.RegisterFile("service.proto", fileDescriptor_service_9cfba3f99adeb32f) }
+
+var fileDescriptor_service_9cfba3f99adeb32f = []byte{
+	// 1110 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0xdd, 0x6e, 0x1b, 0x45,
+	0x14, 0xce, 0x66, 0x6d, 0xc7, 0x7b, 0xec, 0xfc, 0x74, 0x68, 0xa3, 0xc5, 0x2d, 0xd4, 0x5d, 0x55,
+	0xc2, 0xa0, 0x36, 0x54, 0x41, 0x50, 0x09, 0xb8, 0x69, 0x93, 0x12, 0x45, 0x94, 0x0a, 0x36, 0x8a,
+	0x84, 0xd4, 0x0b, 0x6b, 0xb2, 0x7b, 0xd2, 0xac, 0xec, 0xfd, 0x61, 0x66, 0x9c, 0xc6, 0x15, 0x12,
+	0x2f, 0xc4, 0x63, 0xc0, 0x83, 0x70, 0xcb, 0x53, 0xa0, 0x39, 0x33, 0xfb, 0xe3, 0xc4, 0x16, 0xed,
+	0xdd, 0x39, 0xdf, 0xcc, 0x99, 0xf3, 0xff, 0xed, 0xc2, 0xa6, 0x44, 0x71, 0x99, 0x44, 0xb8, 0x57,
+	0x88, 0x5c, 0xe5, 0x6c, 0xbd, 0x38, 0x0b, 0xfe, 0x75, 0xa0, 0x7d, 0x70, 0x31, 0xcb, 0x26, 0x8c,
+	0x41, 0xeb, 0xf4, 0xf4, 0xf8, 0xd0, 0x77, 0x86, 0xce, 0xc8, 0x0b, 0x49, 0xd6, 0x98, 0x4c, 0xde,
+	0xa1, 0xbf, 0x3e, 0x74, 0x46, 0x6e, 0x48, 0xb2, 0xc6, 0x66, 0x12, 0x63, 0xdf, 0x35, 0x98, 0x96,
+	0xd9, 0x00, 0xba, 0x02, 0x8b, 0x69, 0x12, 0x71, 0xe9, 0xb7, 0x86, 0xee, 0xc8, 0x0b, 0x2b, 0x5d,
+	0x9f, 0xfd, 0x90, 0x4c, 0x91, 0xde, 0x6e, 0xd3, 0xdb, 0x95, 0xce, 0x76, 0xa1, 0x53, 0xf0, 0x68,
+	0x82, 0xb1, 0xdf, 0x19, 0x3a, 0xa3, 0x6e, 0x68, 0x35, 0x8d, 0xe7, 0xe7, 0xe7, 0x12, 0x95, 0xbf,
+	0x41, 0x5e, 0xac, 0xc6, 0x6e, 0x43, 0x3b, 0xca, 0x63, 0x8c, 0xfc, 0x2e, 0x3d, 0x64, 0x14, 0xf6,
+	0x19, 0x6c, 0x47, 0x79, 0x5a, 0x08, 0x94, 0x12, 0xe3, 0x31, 0x05, 0xec, 0x91, 0xd9, 0x56, 0x0d,
+	0x9f, 0x24, 0xef, 0x30, 0xf8, 0x6b, 0x1d, 0x5a, 0xda, 0xf7, 0xd2, 0x5c, 0xef, 0x82, 0x77, 0x9e,
+	0x4c, 0x71, 0x9c, 0xf1, 0xd4, 0x24, 0xec, 0x85, 0x5d, 0x0d, 0xbc, 0xe2, 0x29, 0x56, 0x85, 0x70,
+	0x1b, 0x85, 0xb8, 0x0f, 0x3d, 0x9b, 0xe4, 0x38, 0x9b, 0xa5, 0x7e, 0x6b, 0xe8, 0x8c, 0xda, 0x21,
+	0x58, 0xe8, 0xd5, 0x2c, 0x65, 0x9f, 0x00, 0x44, 0x02, 0xb9, 0xc2, 0x78, 0xcc, 0x15, 0xe5, 0xee,
+	0x86, 0x9e, 0x45, 0x9e, 0x29, 0x7d, 0x3c, 0x2b, 0xe2, 0xf2, 0xb8, 0x63, 0x8e, 0x2d, 0xf2, 0x4c,
+	0xb1, 0x07, 0xd0, 0x89, 0x74, 0x63, 0xa4, 0xbf, 0x31, 0x74, 0x47, 0xbd, 0x7d, 0x6f, 0xaf, 0x38,
+	0xdb, 0xa3, 0x56, 0x85, 0xf6, 0x80, 0xed, 0x01, 0x60, 0x16, 0x89, 0x79, 0xa1, 0x92, 0x3c, 0xa3,
+	0x9a, 0xf4, 0xf6, 0xb7, 0xf4, 0xb5, 0x17, 0x15, 0x1a, 0x36, 0x6e, 0xe8, 0xf2, 0xe5, 0x6f, 0x33,
+	0x14, 0x54, 0x1e, 0x2f, 0x34, 0x8a, 0xce, 0x2d, 0xcd, 0x63, 0xf4, 0x61, 0xe8, 0x8c, 0x36, 0x43,
+	0x92, 0xd9, 0x5d, 0x70, 0x79, 0x34, 0xf5, 0x7b, 0xb5, 0xe7, 0x23, 0xc1, 0x33, 0x15, 0x6a, 0x34,
+	0xf8, 0x12, 0xda, 0xa4, 0xd9, 0x51, 0x10, 0x65, 0x19, 0xb5, 0xac, 0xb1, 0x02, 0x45, 0x4a, 0x15,
+	0xdc, 0x0c, 0x49, 0x0e, 0xfe, 0x00, 0xa8, 0x23, 0xd2, 0xcd, 0x95, 0xd1, 0x05, 0xa6, 0x68, 0xed,
+	0xac, 0xc6, 0xee, 0x40, 0x67, 0x82, 0xf3, 0x71, 0x12, 0xdb, 0xea, 0xb7, 0x27, 0x38, 0x3f, 0x8e,
+	0x75, 0x99, 0xdf, 0x0a, 0x5e, 0x14, 0x18, 0x8f, 0x27, 0x38, 0xa7, 0x0e, 0xf4, 0x43, 0xb0, 0xd0,
+	0x8f, 0x38, 0x67, 0x0f, 0xa0, 0x9f, 0xe5, 0x59, 0x84, 0xe3, 0x42, 0xe0, 0x79, 0x72, 0x45, 0x8d,
+	0xe8, 0x87, 0x3d, 0xc2, 0x7e, 0x26, 0x28, 0xf8, 0xd3, 0x81, 0x4d, 0xdd, 0x78, 0x2a, 0xdf, 0x21,
+	0x57, 0x5c, 0x87, 0x19, 0x73, 0xc5, 0x29, 0x84, 0x7e, 0x48, 0x32, 0xdb, 0x01, 0x37, 0x95, 0x6f,
+	0xac, 0x77, 0x2d, 0xd6, 0xf3, 0xe6, 0x36, 0xe7, 0x6d, 0xb1, 0xec, 0xad, 0xff, 0x2d, 0x7b, 0x59,
+	0xe0, 0xf6, 0xcd, 0x02, 0x77, 0x96, 0x16, 0xf8, 0x31, 0x6c, 0x87, 0xc8, 0x63, 0x1d, 0x71, 0x88,
+	0xbf, 0xcd, 0x50, 0xaa, 0x85, 0x2d, 0x72, 0x16, 0xb7, 0x28, 0xf8, 0x1d, 0x76, 0xf4, 0x75, 0x33,
+	0x1b, 0xf6, 0xfe, 0x3d, 0xf0, 0x48, 0x6f, 0x18, 0xd4, 0x40, 0x63, 0xbf, 0xd6, 0x17, 0xf6, 0x6b,
+	0x17, 0x3a, 0x53, 0xcc, 0xde, 0xa8, 0x0b, 0x3b, 0xe8, 0x56, 0x5b, 0xf0, 0xde, 0xba, 0xe6, 0x7d,
+	0x1f, 0x58, 0x88, 0x69, 0x7e, 0x89, 0xef, 0xef, 0x3f, 0xf8, 0x1a, 0xee, 0x84, 0x66, 0x4f, 0xd4,
+	0x87, 0x98, 0x1d, 0xc3, 0xce, 0xcb, 0x44, 0x2a, 0xed, 0x5a, 0x96, 0x16, 0xf7, 0xa1, 0x27, 0x15,
+	0x17, 0x6a, 0xcc, 0xcf, 0x55, 0x35, 0x8a, 0x40, 0xd0, 0x33, 0x8d, 0xe8, 0x1e, 0x4e, 0x93, 0x34,
+	0x29, 0x53, 0x35, 0x4a, 0xf0, 0x1a, 0x6e, 0x35, 0x9e, 0x92, 0x45, 0x9e, 0x49, 0x64, 0x9f, 0x42,
+	0x5b, 0x6f, 0xbc, 0xf4, 0x1d, 0x6a, 0x4b, 0x57, 0xb7, 0x85, 0x9a, 0x60, 0x60, 0xd3, 0x48, 0x61,
+	0xd8, 0xa1, 0x1b, 0x92, 0xac, 0xb1, 0x29, 0x97, 0xca, 0x4e, 0x08, 0xc9, 0xc1, 0x6b, 0xe8, 0x1f,
+	0x5c, 0xa4, 0x79, 0xfc, 0x1e, 0xcd, 0xab, 0x86, 0x63, 0xfd, 0xe6, 0x70, 0xb8, 0x4b, 0x87, 0xe3,
+	0x1f, 0x07, 0xda, 0xbf, 0xcc, 0x72, 0xc5, 0xeb, 0x75, 0x76, 0x9a, 0xeb, 0x7c, 0x17, 0xbc, 0x94,
+	0x5f, 0x8d, 0xcf, 0xe6, 0x0a, 0xa5, 0xcd, 0xb9, 0x9b, 0xf2, 0xab, 0xe7, 0x5a, 0x2f, 0x0f, 0x4d,
+	0x96, 0x6e, 0x75, 0x48, 0x65, 0x20, 0x42, 0xd2, 0x0c, 0x6a, 0x4c, 0x5b, 0x96, 0x90, 0x24, 0xc6,
+	0xc6, 0xb6, 0x3c, 0x36, 0xc6, 0xed, 0xfa, 0xd8, 0x58, 0x3f, 0x84, 0xad, 0x09, 0x62, 0x31, 0xae,
+	0x9d, 0x1b, 0x4e, 0xef, 0x6b, 0xf4, 0xa7, 0x32, 0x80, 0xe6, 0x2d, 0xf3, 0xd0, 0xc6, 0xc2, 0x2d,
+	0x7a, 0x2b, 0x78, 0x08, 0x7d, 0x4a, 0xb1, 0x2c, 0xe0, 0xd2, 0x4c, 0x83, 0x6d, 0xd8, 0x7c, 0x89,
+	0x3c, 0x46, 0x61, 0xaf, 0x05, 0x87, 0xd0, 0x31, 0x80, 0xae, 0x2a, 0xf1, 0xb8, 0x65, 0xa6, 0xcc,
+	0x72, 0x38, 0x8f, 0x63, 0x61, 0xf7, 0x9b, 0x64, 0x8d, 0x29, 0xcd, 0x56, 0x96, 0xd7, 0xb5, 0x1c,
+	0x9c, 0x42, 0xef, 0x85, 0x10, 0xb9, 0x38, 0x44, 0xc5, 0x93, 0xa9, 0xde, 0x09, 0x81, 0x5c, 0xe6,
+	0x59, 0x49, 0x57, 0x46, 0x33, 0xdf, 0x3c, 0x99, 0xcf, 0x44, 0x54, 0x7d, 0x2e, 0x4a, 0x9d, 0xdc,
+	0xeb, 0xa6, 0xda, 0xa1, 0xd0, 0x72, 0xf0, 0x14, 0xb6, 0x8f, 0x30, 0x43, 0x91, 0x44, 0xd5, 0xbc,
+	0x31, 0x68, 0x69, 0x46, 0xa1, 0x87, 0xdd, 0x90, 0xe4, 0x9b, 0x24, 0x14, 0xfc, 0x0a, 0xec, 0x80,
+	0x3e, 0x1a, 0x86, 0x0f, 0x3e, 0xc4, 0x96, 0xdd, 0x83, 0x96, 0xae, 0x32, 0x05, 0xd2, 0x1c, 0x68,
+	0x42, 0xf7, 0xff, 0x6e, 0x43, 0x8f, 0xb6, 0xeb, 0x04, 0xc5, 0x25, 0x0a, 0xf6, 0x1d, 0x40, 0xed,
+	0x89, 0xdd, 0x2a, 0x6f, 0x57, 0xac, 0x39, 0xd8, 0xa5, 0x6f, 0xd0, 0x8d, 0x60, 0x82, 0xb5, 0x91,
+	0xc3, 0x1e, 0x03, 0x18, 0x1e, 0x20, 0xe3, 0xca, 0xd5, 0xe0, 0x23, 0x9a, 0xdf, 0xc5, 0xcc, 0x83,
+	0x35, 0xf6, 0x0d, 0x74, 0x4b, 0x8e, 0x63, 0x74, 0xe5, 0x1a, 0xe3, 0x0d, 0x6e, 0xba, 0x0f, 0xd6,
+	0x9e, 0x38, 0xec, 0x29, 0xf4, 0x4c, 0x00, 0x04, 0x2f, 0x0b, 0x72, 0x85, 0xc3, 0x2f, 0x60, 0xe3,
+	0x08, 0xd5, 0x6a, 0x7f, 0x55, 0xc4, 0x14, 0x9c, 0x57, 0x31, 0x2a, 0xbb, 0x5d, 0xde, 0x6e, 0x32,
+	0xd5, 0xd2, 0xf0, 0xd8, 0xb7, 0xe0, 0x55, 0xac, 0x62, 0xec, 0xae, 0xf3, 0xd5, 0xe0, 0xce, 0x35,
+	0xb4, 0x8a, 0xef, 0x7b, 0xe8, 0x35, 0x78, 0x94, 0xed, 0x1a, 0xaf, 0xd7, 0x89, 0x75, 0x55, 0x76,
+	0x4f, 0xf4, 0x6f, 0x5c, 0x9a, 0xc7, 0x6c, 0xc7, 0xfc, 0x26, 0xd4, 0xec, 0xb3, 0xca, 0xe2, 0x73,
+	0xe8, 0x1e, 0xa1, 0x32, 0x4c, 0x42, 0x46, 0xcd, 0x8d, 0x1b, 0x78, 0x15, 0x12, 0xac, 0xb1, 0x47,
+	0xd0, 0x3d, 0x29, 0xaf, 0xd6, 0x07, 0xab, 0x1e, 0x7e, 0x0e, 0x5b, 0x8b, 0xe4, 0xce, 0x3e, 0x36,
+	0xb9, 0x2c, 0x21, 0xfc, 0x55, 0x6f, 0x3c, 0x02, 0xef, 0x08, 0x95, 0x5d, 0x66, 0x2a, 0xf5, 0xc2,
+	0xa6, 0x0f, 0xa0, 0x86, 0x82, 0xb5, 0xb3, 0x0e, 0xfd, 0xcf, 0x7e, 0xf5, 0xdf, 0x00, 0x2a, 0x6d,
+	0x1c, 0x06, 0xe0, 0x0a, 0x00, 0x00,
 }
@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+/*
+package auth identify callers of chunkservers, and decide what they can do to files.
+
+users are identified by static tokens, or by subjects of their certificates under mutual TLS.
+chunkservers are identified the same way, by PeerTokenFile or PeerNames, they're members of
+cluster and the only callers of peer-only RPCs.
+
+owner of a file has all the permissions of it, other users have permissions in mode of file,
+plus the ones granted to them in ACL.
+*/
+
+// TokenEnv is the environment which holds token of client, it's used if there's no token file
+const TokenEnv = "HFS_TOKEN"
+
+// MetadataKey is the gRPC metadata which carries token of caller
+const MetadataKey = "hfs-token"
+
+// permissions of files
+const (
+	PermRead  uint32 = 4 // read content and metadata of file
+	PermWrite uint32 = 2 // remove file
+	PermAll          = PermRead | PermWrite
+)
+
+// error definitions
+var (
+	ErrUnauthenticated  = status.Error(codes.Unauthenticated, "caller is not authenticated")
+	ErrPermissionDenied = status.Error(codes.PermissionDenied, "permission denied")
+	ErrEmptyToken       = errors.New("token should not be empty")
+	ErrDuplicatedToken  = errors.New("token is shared by users")
+	ErrBadPerm          = errors.New("permission should be r, w, rw or empty")
+	ErrBadGrant         = errors.New("grant should be like user:rw")
+)
+
+// Identity is who makes a request
+type Identity struct {
+	Name string // empty if caller is anonymous
+	Peer bool   // caller is another chunkserver of cluster
+}
+
+func (id Identity) String() string {
+	switch {
+	case id.Peer && id.Name == "":
+		return "peer"
+	case id.Peer:
+		return "peer " + id.Name
+	case id.Name == "":
+		return "anonymous"
+	}
+	return id.Name
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx which carries id
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns identity carried by ctx, it's anonymous if there's none
+func FromContext(ctx context.Context) Identity {
+	id, _ := ctx.Value(contextKey{}).(Identity)
+	return id
+}
+
+// Options configures an Authenticator
+type Options struct {
+	Required  bool              // reject anonymous callers, and check permissions
+	Users     map[string]string // name of user -> token
+	PeerToken string            // token chunkservers present to each other
+	Peers     []string          // subjects of certificates of chunkservers
+	Admins    []string          // users who have all permissions of all files
+}
+
+// Authenticator identifies callers, and checks their permissions
+type Authenticator struct {
+	required  bool
+	users     map[[sha256.Size]byte]string // tokens are hashed so lookup doesn't leak them by timing
+	peerToken []byte
+	peers     map[string]bool
+	admins    map[string]bool
+}
+
+// New returns an Authenticator of opts
+func New(opts Options) (*Authenticator, error) {
+	a := &Authenticator{
+		required:  opts.Required,
+		users:     map[[sha256.Size]byte]string{},
+		peerToken: []byte(opts.PeerToken),
+		peers:     map[string]bool{},
+		admins:    map[string]bool{},
+	}
+
+	for name, token := range opts.Users {
+		if token == "" {
+			return nil, fmt.Errorf("%s: %s", ErrEmptyToken, name)
+		}
+		sum := sha256.Sum256([]byte(token))
+		if other, ok := a.users[sum]; ok {
+			return nil, fmt.Errorf("%s: %s and %s", ErrDuplicatedToken, name, other)
+		} else if token == opts.PeerToken {
+			return nil, fmt.Errorf("%s: %s and chunkservers", ErrDuplicatedToken, name)
+		}
+		a.users[sum] = name
+	}
+	for _, name := range opts.Peers {
+		a.peers[name] = true
+	}
+	for _, name := range opts.Admins {
+		a.admins[name] = true
+	}
+
+	return a, nil
+}
+
+// FromConfig returns an Authenticator of configurations
+func FromConfig() (*Authenticator, error) {
+	opts := Options{Required: config.Auth, Users: map[string]string{}, Peers: config.PeerNames, Admins: config.Admins}
+
+	if config.TokensFile != "" {
+		if _, err := toml.DecodeFile(config.TokensFile, &opts.Users); err != nil {
+			return nil, err
+		}
+	}
+	if config.PeerTokenFile != "" {
+		token, err := readToken(config.PeerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.PeerToken = token
+	}
+
+	return New(opts)
+}
+
+func readToken(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := string(bytes.TrimSpace(raw))
+	if token == "" {
+		return "", fmt.Errorf("%s: %s", ErrEmptyToken, path)
+	}
+	return token, nil
+}
+
+// LoadToken load token of client from file at path, or from TokenEnv if path is empty. it
+// returns an empty token if there's none
+func LoadToken(path string) (string, error) {
+	if path == "" {
+		return strings.TrimSpace(os.Getenv(TokenEnv)), nil
+	}
+	return readToken(path)
+}
+
+// PeerCredentials returns credentials chunkservers present to each other, it's nil if there's
+// no PeerToken, they're identified by their certificates then
+func (a *Authenticator) PeerCredentials() credentials.PerRPCCredentials {
+	if len(a.peerToken) == 0 {
+		return nil
+	}
+	return Token(string(a.peerToken))
+}
+
+// Identify returns identity of caller of ctx, by token in metadata, or by certificate under
+// mutual TLS
+func (a *Authenticator) Identify(ctx context.Context) (Identity, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if tokens := md.Get(MetadataKey); len(tokens) > 0 {
+			token := []byte(tokens[0])
+			if len(a.peerToken) > 0 && subtle.ConstantTimeCompare(token, a.peerToken) == 1 {
+				return Identity{Peer: true}, nil
+			}
+			if name, ok := a.users[sha256.Sum256(token)]; ok {
+				return Identity{Name: name}, nil
+			}
+			if a.required {
+				return Identity{}, ErrUnauthenticated
+			}
+		}
+	}
+
+	// certificates are only in VerifiedChains if they're signed by TLSCA
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			if name := info.State.VerifiedChains[0][0].Subject.CommonName; name != "" {
+				return Identity{Name: name, Peer: a.peers[name]}, nil
+			}
+		}
+	}
+
+	if a.required {
+		return Identity{}, ErrUnauthenticated
+	}
+	return Identity{}, nil
+}
+
+// IsMember returns whether id is a member of cluster, everyone is if authentication is not
+// required
+func (a *Authenticator) IsMember(id Identity) bool {
+	return !a.required || id.Peer
+}
+
+// IsAdmin returns whether id is an admin, everyone is if authentication is not required
+func (a *Authenticator) IsAdmin(id Identity) bool {
+	return !a.required || a.admins[id.Name]
+}
+
+// Owns returns whether id can change permissions of file
+func (a *Authenticator) Owns(id Identity, file *pb.File) bool {
+	return !a.required || id.Peer || a.admins[id.Name] || (id.Name != "" && id.Name == file.Owner)
+}
+
+// Can returns whether id has permissions perm of file
+func (a *Authenticator) Can(id Identity, file *pb.File, perm uint32) bool {
+	if a.Owns(id, file) {
+		return true
+	} else if id.Name == "" {
+		return false
+	}
+
+	granted := file.Mode
+	for _, g := range file.Acl {
+		if g.User == id.Name {
+			granted |= g.Perm
+		}
+	}
+	return granted&perm == perm
+}
+
+// ParsePerm parse permissions like rw
+func ParsePerm(s string) (uint32, error) {
+	var perm uint32
+	for _, c := range s {
+		switch {
+		case c == 'r' && perm&PermRead == 0:
+			perm |= PermRead
+		case c == 'w' && perm&PermWrite == 0:
+			perm |= PermWrite
+		default:
+			return 0, fmt.Errorf("%s: %q", ErrBadPerm, s)
+		}
+	}
+	return perm, nil
+}
+
+// FormatPerm is the reverse of ParsePerm, but no permission is formatted as -
+func FormatPerm(perm uint32) string {
+	s := ""
+	if perm&PermRead != 0 {
+		s += "r"
+	}
+	if perm&PermWrite != 0 {
+		s += "w"
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// ParseGrant parse grant like alice:rw
+func ParseGrant(s string) (*pb.Grant, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return nil, fmt.Errorf("%s: %q", ErrBadGrant, s)
+	}
+	perm, err := ParsePerm(s[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Grant{User: s[:i], Perm: perm}, nil
+}
+
+// Token returns credentials which present token in metadata of every RPC
+func Token(token string) credentials.PerRPCCredentials {
+	return tokenCredentials(token)
+}
+
+type tokenCredentials string
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{MetadataKey: string(t)}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials, tokens are allowed
+// without TLS, it's up to operators to enable TLS
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jiajunhuang/hfs/pb"
+	"google.golang.org/grpc/metadata"
+)
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, token))
+}
+
+func TestIdentify(t *testing.T) {
+	a, err := New(Options{Required: true, Users: map[string]string{"alice": "a-token", "bob": "b-token"}, PeerToken: "p-token"})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %s", err)
+	}
+
+	if id, err := a.Identify(withToken("a-token")); err != nil || id != (Identity{Name: "alice"}) {
+		t.Fatalf("should be alice but got %v, err: %v", id, err)
+	}
+	if id, err := a.Identify(withToken("p-token")); err != nil || !id.Peer || !a.IsMember(id) {
+		t.Fatalf("should be a peer but got %v, err: %v", id, err)
+	}
+	if _, err := a.Identify(withToken("wrong")); err != ErrUnauthenticated {
+		t.Fatalf("unknown token should be rejected but got %v", err)
+	}
+	if _, err := a.Identify(context.Background()); err != ErrUnauthenticated {
+		t.Fatalf("anonymous caller should be rejected but got %v", err)
+	}
+
+	// authentication is optional, but tokens are still recognized
+	optional, _ := New(Options{Users: map[string]string{"alice": "a-token"}})
+	if id, err := optional.Identify(context.Background()); err != nil || id.Name != "" || !optional.IsMember(id) {
+		t.Fatalf("anonymous caller should be allowed but got %v, err: %v", id, err)
+	}
+	if id, err := optional.Identify(withToken("a-token")); err != nil || id.Name != "alice" {
+		t.Fatalf("should be alice but got %v, err: %v", id, err)
+	}
+
+	if _, err := New(Options{Users: map[string]string{"alice": "same", "bob": "same"}}); err == nil {
+		t.Fatalf("token shared by users should be rejected")
+	}
+}
+
+func TestCan(t *testing.T) {
+	a, _ := New(Options{Required: true, Admins: []string{"root"}})
+	file := &pb.File{Owner: "alice", Mode: PermRead, Acl: []*pb.Grant{{User: "bob", Perm: PermWrite}}}
+
+	for _, c := range []struct {
+		id   Identity
+		perm uint32
+		can  bool
+	}{
+		{Identity{Name: "alice"}, PermAll, true},
+		{Identity{Name: "root"}, PermAll, true},
+		{Identity{Name: "bob"}, PermAll, true},
+		{Identity{Name: "carol"}, PermRead, true},
+		{Identity{Name: "carol"}, PermWrite, false},
+		{Identity{}, PermRead, false},
+	} {
+		if can := a.Can(c.id, file, c.perm); can != c.can {
+			t.Fatalf("%s should be %v to get %s but got %v", c.id, c.can, FormatPerm(c.perm), can)
+		}
+	}
+
+	if a.Owns(Identity{Name: "bob"}, file) || !a.Owns(Identity{Name: "root"}, file) {
+		t.Fatalf("only owner and admins can change permissions")
+	}
+	// files created without authentication have no owner
+	if a.Can(Identity{Name: "carol"}, &pb.File{}, PermRead) {
+		t.Fatalf("file without owner should be private")
+	}
+}
+
+func TestParseGrant(t *testing.T) {
+	if g, err := ParseGrant("alice:rw"); err != nil || g.User != "alice" || g.Perm != PermAll {
+		t.Fatalf("should grant rw to alice but got %v, err: %v", g, err)
+	}
+	for _, s := range []string{"alice", ":r", "alice:x", "alice:rr"} {
+		if _, err := ParseGrant(s); err == nil {
+			t.Fatalf("%q should be rejected", s)
+		}
+	}
+	if perm, err := ParsePerm(""); err != nil || perm != 0 || FormatPerm(perm) != "-" {
+		t.Fatalf("should be no permission but got %d, err: %v", perm, err)
+	}
+}
@@ -4,37 +4,88 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/google/uuid"
 	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/auth"
+	"github.com/jiajunhuang/hfs/pkg/codec"
 	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/crypt"
 	"github.com/jiajunhuang/hfs/pkg/files"
-	"github.com/jiajunhuang/hfs/pkg/hfsclient"
 	"github.com/jiajunhuang/hfs/pkg/logger"
+	"github.com/jiajunhuang/hfs/pkg/metrics"
 	"github.com/jiajunhuang/hfs/pkg/selection"
+	"github.com/jiajunhuang/hfs/pkg/tlsconfig"
 	"github.com/jiajunhuang/hfs/pkg/utils"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// error definitions, they're gRPC status with ErrorDetail, so clients can tell why it fails
 var (
-	ErrFailedWrite     = errors.New("failed to write file or chunk")
-	ErrFailedWriteMeta = errors.New("failed to sync metadata of file or chunk")
-	ErrFailedGetFile   = errors.New("failed to get file or chunk")
-	ErrFileNotExist    = errors.New("file or chunk not exist")
-	ErrAlreadyExist    = errors.New("file or chunk already exist")
+	ErrFailedWrite     = newError(codes.Unavailable, "WriteFailed", "", "failed to write file or chunk")
+	ErrFailedWriteMeta = newError(codes.Unavailable, "MetadataWriteFailed", "", "failed to sync metadata of file or chunk")
+	ErrFailedGetFile   = newError(codes.Unavailable, "ReadFailed", "", "failed to get file or chunk")
+	ErrFileNotExist    = newError(codes.NotFound, "NotFound", "", "file or chunk not exist")
+	ErrAlreadyExist    = newError(codes.AlreadyExists, "AlreadyExists", "", "file or chunk already exist")
+	ErrBadRequest      = newError(codes.InvalidArgument, "BadRequest", "", "bad request")
+	ErrWrongCluster    = newError(codes.FailedPrecondition, "WrongCluster", "", "request is for another cluster")
+	ErrCorrupted       = newError(codes.DataLoss, "Corrupted", "", "chunk is corrupted or truncated")
+	ErrNoSpace         = newError(codes.ResourceExhausted, "NoSpace", "", "no disk has enough free space")
 )
 
+// newError returns a gRPC status error of code, with reason and resource in ErrorDetail
+func newError(code codes.Code, reason string, resource string, msg string) error {
+	st, err := status.New(code, msg).WithDetails(&pb.ErrorDetail{Reason: reason, Resource: resource})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+// pickError returns error of failing to pick a disk for new chunk
+func pickError(err error) error {
+	if err == files.ErrNoSpace {
+		return ErrNoSpace
+	}
+	return ErrFailedWrite
+}
+
 type ChunkServer struct {
 	name       string
 	addr       string
 	etcdClient *clientv3.Client
+	disks      *files.Disks
+	pack       pack
+	dialOption grpc.DialOption // credentials to talk to other chunkservers
+	auth       *auth.Authenticator
+	session    *Session // liveness of this chunkserver
+	election   *Election
+	tasks      sync.WaitGroup // background tasks, they're waited for at shutdown
+}
+
+// proxiedMetadataKey is the gRPC metadata which carries name of chunkserver which proxies the
+// request
+const proxiedMetadataKey = "hfs-proxied-by"
+
+// RPCs which are only called by other chunkservers
+var peerOnly = map[string]bool{
+	"/pb.ChunkServer/CreateChunk":    true,
+	"/pb.ChunkServer/RemoveChunk":    true,
+	"/pb.ChunkServer/ReplicateChunk": true,
 }
 
 func (s *ChunkServer) CreateFile(stream pb.ChunkServer_CreateFileServer) error {
@@ -46,9 +97,32 @@ func (s *ChunkServer) CreateFile(stream pb.ChunkServer_CreateFileServer) error {
 		CreatedAt:  time.Now().Unix(),
 		UpdatedAt:  time.Now().Unix(),
 		// Chunks
+		Owner: auth.FromContext(stream.Context()).Name,
 	}
 	var size int64
-	var kvClient = clientv3.NewKV(s.etcdClient)
+	// the first piece is held back until we know whether the file is small enough to be packed
+	var first *pb.FileChunkData
+
+	// quota is checked as data arrives, so that a runaway upload is stopped early. it's checked
+	// again when the file is committed, as others may upload meanwhile
+	var quota *pb.Quota
+	if file.Owner != "" {
+		var err error
+		if quota, _, err = s.loadQuota(stream.Context(), file.Owner); err != nil {
+			return ErrFailedGetFile
+		}
+		if err := checkQuota(quota, 0, 1); err != nil {
+			return err
+		}
+	}
+
+	// chunks written so far are discarded unless the file is committed, e.g. the client aborts
+	committed := false
+	defer func() {
+		if !committed {
+			s.discardChunks(&file)
+		}
+	}()
 
 	for {
 		fileChunkData, err := stream.Recv()
@@ -59,55 +133,137 @@ func (s *ChunkServer) CreateFile(stream pb.ChunkServer_CreateFileServer) error {
 			return ErrFailedWrite
 		}
 		file.FileName = fileChunkData.Msg
-		dataSize := int64(len(fileChunkData.Data))
-		size += dataSize
-
-		c := pb.Chunk{
-			UUID:     uuid.New().String(),
-			Size:     int64(config.ChunkSize), // for now
-			Used:     dataSize,
-			Replicas: []string{s.name},
-			FileUUID: file.UUID,
-		}
-
-		chunkPath := config.ChunkBasePath + c.UUID
-		zeros := make([]byte, config.ChunkSize-len(fileChunkData.Data))
-		data := append(fileChunkData.Data, zeros...)
-		if err := files.Append(chunkPath, bytes.NewReader(data)); err != nil {
-			logger.Sugar.Errorf("failed to write data into chunk %s: %s", c.UUID, err)
-			return ErrFailedWrite
+		if fileChunkData.Encryption != nil {
+			// chunks are encrypted by client, it's only kept for client to decrypt them
+			file.Encryption = fileChunkData.Encryption
+		}
+		if fileChunkData.Mode != 0 || len(fileChunkData.Acl) > 0 {
+			file.Mode, file.Acl = fileChunkData.Mode, fileChunkData.Acl
+		}
+		if !codec.Valid(fileChunkData.Codec) || !validPerm(file.Mode, file.Acl) {
+			return ErrBadRequest
+		}
+		size += int64(len(fileChunkData.Data))
+		if quota != nil {
+			if err := checkQuota(quota, size, 1); err != nil {
+				return err
+			}
 		}
 
-		// sync metadata
-		v, err := utils.ToJSONString(c)
-		if err != nil {
-			logger.Sugar.Errorf("failed to sync metadata of chunk %s", c.UUID)
-			return ErrFailedWriteMeta
+		if first == nil && len(file.Chunks) == 0 {
+			first = fileChunkData
+			continue
+		}
+		if first != nil {
+			if err := s.addChunk(&file, first.Codec, first.Data); err != nil {
+				return err
+			}
+			first = nil
+		}
+		if err := s.addChunk(&file, fileChunkData.Codec, fileChunkData.Data); err != nil {
+			return err
+		}
+	}
+
+	if first != nil {
+		var err error
+		if len(first.Data) < config.PackThreshold {
+			err = s.addPacked(&file, first.Codec, first.Data)
+		} else {
+			err = s.addChunk(&file, first.Codec, first.Data)
 		}
-		_, err = kvClient.Put(context.Background(), chunkPath, v)
 		if err != nil {
-			logger.Sugar.Errorf("failed to sync metadata of chunk %s", c.UUID)
-			return ErrFailedWriteMeta
+			return err
 		}
-		file.Chunks = append(file.Chunks, &c)
 	}
 
 	// sync metadata of file
 	file.Size = size
-	v, err := utils.ToJSONString(file)
+	if err := s.commitFile(context.Background(), &file); err != nil {
+		return err
+	}
+	committed = true
+
+	logger.Sugar.Infof("file %s created", file.UUID)
+	return stream.SendAndClose(&pb.CreateFileResponse{Code: 0, File: &file})
+}
+
+// addChunk write data into a new chunk of file, compressed by codecName
+func (s *ChunkServer) addChunk(file *pb.File, codecName string, data []byte) error {
+	c := pb.Chunk{
+		UUID:     uuid.New().String(),
+		Size:     int64(config.ChunkSize), // for now
+		Used:     int64(len(data)),
+		Replicas: []string{s.name},
+		FileUUID: file.UUID,
+	}
+
+	codecName, data, err := codec.Compress(codecName, data)
+	if err != nil {
+		logger.Sugar.Errorf("failed to compress chunk %s: %s", c.UUID, err)
+		return ErrFailedWrite
+	}
+	if codecName != codec.None {
+		// compressed chunks are not padded, or the saved space is wasted
+		c.Codec, c.CompressedSize = codecName, int64(len(data))
+	} else {
+		zeros := make([]byte, config.ChunkSize-len(data))
+		data = append(data, zeros...)
+	}
+
+	disk, err := s.disks.Pick(int64(config.ChunkSize))
+	if err != nil {
+		logger.Sugar.Errorf("failed to pick a disk for chunk %s: %s", c.UUID, err)
+		return pickError(err)
+	}
+	// data must be persisted before metadata is committed
+	if err := disk.Store.Put(c.UUID, bytes.NewReader(data), int64(len(data))); err != nil {
+		logger.Sugar.Errorf("failed to write data into chunk %s: %s", c.UUID, err)
+		s.disks.Fail(disk, err)
+		return ErrFailedWrite
+	}
+	s.disks.Succeed(disk)
+	writtenBytes.Add(float64(len(data)))
+
+	// sync metadata
+	v, err := utils.ToJSONString(c)
 	if err != nil {
-		logger.Sugar.Errorf("failed to sync metadata of file %s", file.UUID)
+		logger.Sugar.Errorf("failed to sync metadata of chunk %s", c.UUID)
 		return ErrFailedWriteMeta
 	}
-	filePath := config.FileBasePath + file.UUID
-	_, err = kvClient.Put(context.Background(), filePath, v)
+	_, err = s.etcdClient.Put(context.Background(), config.ChunkBasePath+c.UUID, v)
 	if err != nil {
-		logger.Sugar.Errorf("failed to sync metadata of chunk %s", file.UUID)
+		logger.Sugar.Errorf("failed to sync metadata of chunk %s", c.UUID)
+		if err := disk.Store.Delete(c.UUID); err != nil {
+			logger.Sugar.Errorf("failed to delete chunk %s without metadata: %s", c.UUID, err)
+		}
 		return ErrFailedWriteMeta
 	}
+	file.Chunks = append(file.Chunks, &c)
 
-	logger.Sugar.Infof("file %s created", file.UUID)
-	return stream.SendAndClose(&pb.CreateFileResponse{Code: 0, File: &file})
+	return nil
+}
+
+// addPacked append data of a small file into the open pack, compressed by codecName
+func (s *ChunkServer) addPacked(file *pb.File, codecName string, data []byte) error {
+	used := int64(len(data))
+	codecName, data, err := codec.Compress(codecName, data)
+	if err != nil {
+		logger.Sugar.Errorf("failed to compress file %s: %s", file.UUID, err)
+		return ErrFailedWrite
+	}
+
+	c, err := s.appendPacked(file.UUID, data)
+	if err != nil {
+		logger.Sugar.Errorf("failed to pack file %s: %s", file.UUID, err)
+		return pickError(err)
+	}
+	if codecName != codec.None {
+		c.Codec, c.CompressedSize, c.Used = codecName, c.Used, used
+	}
+	file.Chunks = append(file.Chunks, c)
+
+	return nil
 }
 
 func (s *ChunkServer) RemoveFile(ctx context.Context, file *pb.File) (*pb.GenericResponse, error) {
@@ -128,63 +284,117 @@ func (s *ChunkServer) RemoveFile(ctx context.Context, file *pb.File) (*pb.Generi
 	}
 
 	if err := json.Unmarshal(resp.Kvs[0].Value, &file); err != nil {
-		return nil, err
+		logger.Sugar.Errorf("bad metadata of file %s: %s", filePath, err)
+		return nil, ErrFailedGetFile
+	}
+	if !s.auth.Can(auth.FromContext(ctx), file, auth.PermWrite) {
+		return nil, auth.ErrPermissionDenied
 	}
 	chunks := file.Chunks
 
 	for _, c := range chunks {
-		// remove all replicas of chunk
-		for _, dialURL := range c.Replicas {
-			// get gRPC ready
-			conn, err := grpc.Dial(dialURL, grpc.WithInsecure(), grpc.WithMaxMsgSize(config.GRPCMaxMsgSize))
-			if err != nil {
-				logger.Sugar.Fatalf("failed to connect to grpc server %s: %s", config.GRPCAddr, err)
-			}
-			defer conn.Close()
-
-			grpcClient := pb.NewChunkServerClient(conn)
-			chunkUUID := c.UUID
-			if err := hfsclient.Delete(grpcClient, chunkUUID); err != nil {
-				logger.Sugar.Errorf("failed to delete chunk %s of node %s", chunkUUID, dialURL)
-			} else {
-				logger.Sugar.Infof("chunk %s of node %s delete success!", chunkUUID, dialURL)
+		if c.Packed {
+			// pack is shared with other files, space of the file is reclaimed by compaction
+			if _, err := kvClient.Delete(context.Background(), config.PackBasePath+c.UUID+"/"+file.UUID); err != nil {
+				logger.Sugar.Errorf("failed to delete file %s from pack %s: %s", file.UUID, c.UUID, err)
 			}
+			continue
 		}
+		s.removeChunk(c.UUID, c.Replicas)
 	}
 
-	if _, err := kvClient.Delete(context.Background(), config.FileBasePath+file.UUID); err != nil {
+	// chunks are gone, so metadata is retried hard, or the file is left broken
+	if err := retry(retries, func() error { return s.deleteFile(context.Background(), file.UUID) }); err != nil {
 		logger.Sugar.Errorf("failed to delete metadata of file %s: %s", file.UUID, err)
+		return nil, ErrFailedWriteMeta
 	}
 
 	logger.Sugar.Infof("file %s removed", file.UUID)
 	return &pb.GenericResponse{Code: 0, Msg: "success"}, nil
 }
 
-func (s *ChunkServer) CreateChunk(ctx context.Context, file *pb.FileChunkData) (*pb.GenericResponse, error) {
-	chunkUUID := file.Msg
-	chunkPath := config.ChunkBasePath + chunkUUID
+// removeChunk remove chunk from all of its replicas, and then the metadata of it. replicas are
+// read from metadata of chunk, or the given ones if it's not found
+func (s *ChunkServer) removeChunk(chunkUUID string, replicas []string) {
+	if chunk, err := utils.GetChunkMeta(s.etcdClient, chunkUUID); err == nil {
+		replicas = chunk.Replicas
+	}
+
+	for _, node := range replicas {
+		if node == s.name {
+			if _, err := s.RemoveChunk(context.Background(), &pb.RemoveChunkRequest{ChunkUUID: chunkUUID}); err != nil {
+				logger.Sugar.Errorf("failed to delete chunk %s of node %s: %s", chunkUUID, node, err)
+			}
+			continue
+		}
+
+		dialURL, err := utils.GetWorkerAddr(s.etcdClient, node)
+		if err != nil {
+			logger.Sugar.Errorf("failed to get IP of worker %s: %s", node, err)
+			continue
+		}
+		conn, err := s.dial(dialURL)
+		if err != nil {
+			logger.Sugar.Errorf("failed to connect to grpc server %s: %s", dialURL, err)
+			continue
+		}
+
+		grpcClient := pb.NewChunkServerClient(conn)
+		if _, err := grpcClient.RemoveChunk(context.Background(), &pb.RemoveChunkRequest{ChunkUUID: chunkUUID}); err != nil {
+			logger.Sugar.Errorf("failed to delete chunk %s of node %s: %s", chunkUUID, node, err)
+		} else {
+			logger.Sugar.Infof("chunk %s of node %s delete success!", chunkUUID, node)
+		}
+		conn.Close()
+	}
+
+	if _, err := s.etcdClient.Delete(context.Background(), config.ChunkBasePath+chunkUUID); err != nil {
+		logger.Sugar.Errorf("failed to delete metadata of chunk %s: %s", chunkUUID, err)
+	}
+}
 
-	f, err := files.Create(chunkPath)
+// RemoveChunk remove the local replica of chunk
+func (s *ChunkServer) RemoveChunk(ctx context.Context, req *pb.RemoveChunkRequest) (*pb.GenericResponse, error) {
+	disk, err := s.disks.Locate(req.ChunkUUID)
 	if err != nil {
-		logger.Sugar.Errorf("failed to create chunk %s: %s", chunkPath, err)
+		return nil, ErrFileNotExist
+	}
+
+	if err := disk.Store.Delete(req.ChunkUUID); os.IsNotExist(err) {
+		return nil, ErrFileNotExist
+	} else if err != nil {
+		logger.Sugar.Errorf("failed to delete chunk %s: %s", req.ChunkUUID, err)
+		s.disks.Fail(disk, err)
 		return nil, ErrFailedWrite
 	}
-	f.Close()
+	logger.Sugar.Infof("chunk %s has been removed", req.ChunkUUID)
 
-	if err := files.Append(chunkPath, bytes.NewReader(file.Data)); err != nil {
+	return &pb.GenericResponse{Code: 0, Msg: req.ChunkUUID}, nil
+}
+
+func (s *ChunkServer) CreateChunk(ctx context.Context, file *pb.FileChunkData) (*pb.GenericResponse, error) {
+	chunkUUID := file.Msg
+	disk, err := s.disks.Pick(int64(len(file.Data)))
+	if err != nil {
+		logger.Sugar.Errorf("failed to pick a disk for chunk %s: %s", chunkUUID, err)
+		return nil, pickError(err)
+	}
+	if err := disk.Store.Put(chunkUUID, bytes.NewReader(file.Data), int64(len(file.Data))); err != nil {
 		logger.Sugar.Errorf("failed to create chunk %s: %s", chunkUUID, err)
+		s.disks.Fail(disk, err)
 		return nil, ErrFailedWrite
 	}
+	s.disks.Succeed(disk)
+	writtenBytes.Add(float64(len(file.Data)))
 	logger.Sugar.Infof("chunk %s has been create", chunkUUID)
 
 	return &pb.GenericResponse{Code: 0, Msg: chunkUUID}, nil
 }
 
 func (s *ChunkServer) ReadFile(req *pb.ReadFileRequest, stream pb.ChunkServer_ReadFileServer) error {
-	kvClient := clientv3.NewKV(s.etcdClient)
 	filePath := config.FileBasePath + req.FileUUID
 
-	resp, err := kvClient.Get(context.Background(), filePath)
+	resp, err := s.etcdClient.Get(context.Background(), filePath)
 	if err != nil {
 		logger.Sugar.Errorf("failed to get metadata of file %s", filePath)
 		return ErrFailedGetFile
@@ -199,27 +409,41 @@ func (s *ChunkServer) ReadFile(req *pb.ReadFileRequest, stream pb.ChunkServer_Re
 
 	var file pb.File
 	if err := json.Unmarshal(resp.Kvs[0].Value, &file); err != nil {
-		return err
+		logger.Sugar.Errorf("bad metadata of file %s: %s", filePath, err)
+		return ErrFailedGetFile
+	}
+	if !s.auth.Can(auth.FromContext(stream.Context()), &file, auth.PermRead) {
+		return auth.ErrPermissionDenied
 	}
-	chunks := file.Chunks
 
-	for i, c := range chunks {
-		// read chunk from local file system. TODO: read it from one of it's replica
-		chunkPath := config.ChunkBasePath + c.UUID
-		f, err := os.Open(chunkPath)
+	for i, c := range file.Chunks {
+		stored := c.Used
+		if c.Codec != codec.None {
+			stored = c.CompressedSize
+		}
+		// chunks which are not here are read from their replicas, like ReadChunk
+		chunkReq := &pb.ReadChunkRequest{ChunkUUID: c.UUID, Offset: c.Offset, Length: stored, FileUUID: file.UUID}
+		chunkData, err := s.readLocal(chunkReq)
+		if err == ErrFileNotExist {
+			chunkData, err = s.proxyReadChunk(stream.Context(), chunkReq)
+		}
 		if err != nil {
 			logger.Sugar.Errorf("failed to read %dth chunk %s: %s", i, c.UUID, err)
 			return err
 		}
+		if int64(len(chunkData.Data)) < stored {
+			logger.Sugar.Errorf("%dth chunk %s is truncated", i, c.UUID)
+			return ErrCorrupted
+		}
+		data, err := codec.Decompress(c.Codec, chunkData.Data, c.Used)
+		if err != nil {
+			logger.Sugar.Errorf("failed to decompress %dth chunk %s: %s", i, c.UUID, err)
+			return ErrCorrupted
+		}
 
-		buf := make([]byte, config.ChunkSize)
-		for {
-			_, err := f.Read(buf)
-			if err == io.EOF {
-				break
-			}
-			// write it to stream
-			stream.Send(&pb.FileChunkData{Data: buf[:c.Used], Msg: file.FileName})
+		// write it to stream
+		if err := stream.Send(&pb.FileChunkData{Data: data, Msg: file.FileName}); err != nil {
+			return err
 		}
 	}
 
@@ -227,52 +451,380 @@ func (s *ChunkServer) ReadFile(req *pb.ReadFileRequest, stream pb.ChunkServer_Re
 	return nil
 }
 
-func (s *ChunkServer) KeepAlive() {
-	kvClient := clientv3.NewKV(s.etcdClient)
+func (s *ChunkServer) GetFile(ctx context.Context, req *pb.ReadFileRequest) (*pb.File, error) {
+	file, err := utils.GetFileMeta(s.etcdClient, req.FileUUID)
+	if err == utils.ErrBadMetaData {
+		return nil, ErrFileNotExist
+	} else if err != nil {
+		return nil, ErrFailedGetFile
+	}
+	if !s.auth.Can(auth.FromContext(ctx), file, auth.PermRead) {
+		return nil, auth.ErrPermissionDenied
+	}
 
-	for {
-		lease := clientv3.NewLease(s.etcdClient)
-		grantResp, err := lease.Grant(context.TODO(), 10)
-		if err != nil {
-			logger.Sugar.Errorf("failed to grant lease: %s", err)
+	return file, nil
+}
+
+func (s *ChunkServer) ReadChunk(ctx context.Context, req *pb.ReadChunkRequest) (*pb.FileChunkData, error) {
+	if req.Offset < 0 || req.Length < 0 || req.Length > int64(config.ChunkSize) {
+		return nil, ErrBadRequest
+	}
+	if id := auth.FromContext(ctx); !s.auth.IsMember(id) {
+		if err := s.checkChunk(id, req); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := s.readLocal(req)
+	// clients pick any chunkserver, so chunks which are not here are read from their replicas
+	if err == ErrFileNotExist && !isProxied(ctx) {
+		return s.proxyReadChunk(ctx, req)
+	} else if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readLocal read chunk of req from disks of this chunkserver
+func (s *ChunkServer) readLocal(req *pb.ReadChunkRequest) (*pb.FileChunkData, error) {
+	disk, err := s.disks.Locate(req.ChunkUUID)
+	if err != nil {
+		return nil, ErrFileNotExist
+	}
+	buf := make([]byte, req.Length)
+	n, err := disk.Store.ReadAt(req.ChunkUUID, buf, req.Offset)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotExist
+	} else if err != nil && err != io.EOF {
+		logger.Sugar.Errorf("failed to read chunk %s: %s", req.ChunkUUID, err)
+		s.disks.Fail(disk, err)
+		return nil, ErrFailedGetFile
+	}
+
+	readBytes.Add(float64(n))
+	return &pb.FileChunkData{Data: buf[:n], Msg: req.ChunkUUID}, nil
+}
+
+// isProxied returns whether the request is proxied by another chunkserver, it must not be
+// proxied again
+func isProxied(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(proxiedMetadataKey)) > 0
+}
+
+// replicasOf returns replicas of chunk in req. open packs have no metadata of chunk yet, they
+// are found in metadata of file
+func (s *ChunkServer) replicasOf(req *pb.ReadChunkRequest) ([]string, error) {
+	chunk, err := utils.GetChunkMeta(s.etcdClient, req.ChunkUUID)
+	if err == nil {
+		return chunk.Replicas, nil
+	} else if err != utils.ErrBadMetaData || req.FileUUID == "" {
+		return nil, err
+	}
+
+	file, err := utils.GetFileMeta(s.etcdClient, req.FileUUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range file.Chunks {
+		if c.UUID == req.ChunkUUID {
+			return c.Replicas, nil
+		}
+	}
+	return nil, utils.ErrBadMetaData
+}
+
+// proxyReadChunk read chunk of req from it's replicas, the next replica is tried if one fails
+func (s *ChunkServer) proxyReadChunk(ctx context.Context, req *pb.ReadChunkRequest) (*pb.FileChunkData, error) {
+	replicas, err := s.replicasOf(req)
+	if err == utils.ErrBadMetaData {
+		return nil, ErrFileNotExist
+	} else if err != nil {
+		return nil, ErrFailedGetFile
+	}
+
+	// it's not found only if all the replicas say so
+	err = ErrFileNotExist
+	ctx = metadata.AppendToOutgoingContext(ctx, proxiedMetadataKey, s.name, config.ClusterMetadataKey, config.ClusterName)
+	for _, node := range replicas {
+		if node == s.name {
+			continue
+		}
+		addr, aerr := utils.GetWorkerAddr(s.etcdClient, node)
+		if aerr != nil {
+			logger.Sugar.Warnf("replica %s of chunk %s is not available: %s", node, req.ChunkUUID, aerr)
+			err = ErrFailedGetFile
+			continue
+		}
+		conn, derr := s.dial(addr)
+		if derr != nil {
+			logger.Sugar.Errorf("failed to connect to grpc server %s: %s", addr, derr)
+			err = ErrFailedGetFile
+			continue
+		}
+		data, rerr := pb.NewChunkServerClient(conn).ReadChunk(ctx, req)
+		conn.Close()
+		if rerr == nil {
+			return data, nil
+		}
+		logger.Sugar.Warnf("failed to read chunk %s from replica %s: %s", req.ChunkUUID, node, rerr)
+		if status.Code(rerr) != codes.NotFound {
+			err = ErrFailedGetFile
+		}
+	}
+
+	return nil, err
+}
+
+// checkChunk returns error if id can't read the file of req, or what's requested is not part of it.
+// packs are shared by files, so a file must not read data of others in it
+func (s *ChunkServer) checkChunk(id auth.Identity, req *pb.ReadChunkRequest) error {
+	file, err := utils.GetFileMeta(s.etcdClient, req.FileUUID)
+	if err == utils.ErrBadMetaData {
+		return ErrFileNotExist
+	} else if err != nil {
+		return ErrFailedGetFile
+	}
+	if !s.auth.Can(id, file, auth.PermRead) {
+		return auth.ErrPermissionDenied
+	}
+
+	for _, c := range file.Chunks {
+		stored := c.Used
+		if c.Codec != codec.None {
+			stored = c.CompressedSize
+		}
+		if c.UUID == req.ChunkUUID && req.Offset >= c.Offset && req.Offset+req.Length <= c.Offset+stored {
+			return nil
+		}
+	}
+	return auth.ErrPermissionDenied
+}
+
+func (s *ChunkServer) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	opts := []clientv3.OpOption{clientv3.WithRange(clientv3.GetPrefixRangeEnd(config.FileBasePath))}
+	if req.Limit > 0 {
+		opts = append(opts, clientv3.WithLimit(req.Limit))
+	}
+
+	// "\x00" is the smallest suffix, so the range starts right after StartAfter
+	startKey := config.FileBasePath
+	if req.StartAfter != "" {
+		startKey = config.FileBasePath + req.StartAfter + "\x00"
+	}
+
+	resp, err := s.etcdClient.Get(ctx, startKey, opts...)
+	if err != nil {
+		logger.Sugar.Errorf("failed to list metadata of files: %s", err)
+		return nil, ErrFailedGetFile
+	}
+
+	id := auth.FromContext(ctx)
+	files := make([]*pb.File, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		file := pb.File{}
+		if err := json.Unmarshal(kv.Value, &file); err != nil {
+			logger.Sugar.Errorf("failed to load metadata of file %s: %s", kv.Key, err)
+			continue
+		}
+		if !s.auth.Can(id, &file, auth.PermRead) {
 			continue
 		}
-		_, err = kvClient.Put(context.Background(), config.WorkerBasePath+s.name, s.addr, clientv3.WithLease(grantResp.ID))
+		files = append(files, &file)
+	}
+
+	last := ""
+	if len(resp.Kvs) > 0 {
+		last = strings.TrimPrefix(string(resp.Kvs[len(resp.Kvs)-1].Key), config.FileBasePath)
+	}
+	return &pb.ListFilesResponse{Files: files, More: resp.More, Last: last}, nil
+}
+
+// Chmod replace mode and ACL of file, only owner of file and admins can do it
+func (s *ChunkServer) Chmod(ctx context.Context, req *pb.ChmodRequest) (*pb.GenericResponse, error) {
+	if !validPerm(req.Mode, req.Acl) {
+		return nil, ErrBadRequest
+	}
+	filePath := config.FileBasePath + req.FileUUID
+
+	// metadata of file may be rewritten by compaction meanwhile, so it's updated in a transaction
+	for retries := 0; retries < 3; retries++ {
+		resp, err := s.etcdClient.Get(ctx, filePath)
 		if err != nil {
-			logger.Sugar.Errorf("failed to put %s to %s: %s", s.name, s.addr, err)
-		} else {
-			logger.Sugar.Infof("refresh chunkserver %s to address %s in KV %+v", s.name, s.addr, kvClient)
+			logger.Sugar.Errorf("failed to get metadata of file %s: %s", filePath, err)
+			return nil, ErrFailedGetFile
+		} else if resp.Count == 0 {
+			return nil, ErrFileNotExist
+		}
+
+		var file pb.File
+		if err := json.Unmarshal(resp.Kvs[0].Value, &file); err != nil {
+			logger.Sugar.Errorf("bad metadata of file %s: %s", filePath, err)
+			return nil, ErrFailedGetFile
+		}
+		if !s.auth.Owns(auth.FromContext(ctx), &file) {
+			return nil, auth.ErrPermissionDenied
+		}
+
+		file.Mode, file.Acl = req.Mode, req.Acl
+		file.UpdatedAt = time.Now().Unix()
+		v, err := utils.ToJSONString(file)
+		if err != nil {
+			return nil, ErrFailedWriteMeta
+		}
+		txn, err := s.etcdClient.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(filePath), "=", resp.Kvs[0].ModRevision)).
+			Then(clientv3.OpPut(filePath, v)).
+			Commit()
+		if err != nil {
+			logger.Sugar.Errorf("failed to save metadata of file %s: %s", filePath, err)
+			return nil, ErrFailedWriteMeta
+		} else if txn.Succeeded {
+			logger.Sugar.Infof("permissions of file %s changed to %s", req.FileUUID, auth.FormatPerm(req.Mode))
+			return &pb.GenericResponse{Code: 0, Msg: "success"}, nil
+		}
+	}
+
+	return nil, ErrFailedWriteMeta
+}
+
+// validPerm returns whether mode and acl only contain known permissions
+func validPerm(mode uint32, acl []*pb.Grant) bool {
+	if mode&^auth.PermAll != 0 {
+		return false
+	}
+	for _, g := range acl {
+		if g == nil || g.User == "" || g.Perm&^auth.PermAll != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// register put this chunkserver in WorkerBasePath under lease of session, so that it's removed
+// once the chunkserver is gone
+func (s *ChunkServer) register(ctx context.Context, lease clientv3.LeaseID) error {
+	if _, err := s.etcdClient.Put(ctx, config.WorkerBasePath+s.name, s.addr, clientv3.WithLease(lease)); err != nil {
+		return fmt.Errorf("failed to put %s to %s: %s", s.name, s.addr, err)
+	}
+	logger.Sugar.Infof("chunkserver %s registered at address %s", s.name, s.addr)
+	return nil
+}
+
+// dial connect to another chunkserver at addr
+func (s *ChunkServer) dial(addr string) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{
+		s.dialOption,
+		grpc.WithMaxMsgSize(config.GRPCMaxMsgSize),
+		grpc.WithUnaryInterceptor(metrics.ClientRPC.UnaryClientInterceptor()),
+	}
+	if creds := s.auth.PeerCredentials(); creds != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(creds))
+	}
+	return grpc.Dial(addr, opts...)
+}
+
+// loadDiskKeys load keys which chunks at rest are encrypted by
+func loadDiskKeys() (*files.Keyring, error) {
+	current, err := crypt.LoadKey(config.DiskKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	old := []*crypt.Key{}
+	for _, path := range config.OldDiskKeyFiles {
+		key, err := crypt.LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		old = append(old, key)
+	}
+
+	return files.NewKeyring(current, old...), nil
+}
+
+// Rekeyer encrypt plaintext chunks and chunks encrypted by old keys with DiskKeyFile, so that
+// old keys can be thrown away once it's done
+func (s *ChunkServer) Rekeyer(ctx context.Context) error {
+	for {
+		n, failed := s.disks.Rekey()
+		if failed > 0 {
+			logger.Sugar.Errorf("failed to re-encrypt %d chunks, %d are done", failed, n)
+		} else if n > 0 {
+			logger.Sugar.Infof("%d chunks are re-encrypted", n)
+		}
+		if !sleep(ctx, config.RekeyInterval) {
+			return nil
 		}
-		time.Sleep(time.Second * 7)
 	}
 }
 
-func (s *ChunkServer) SyncChunk(chunkUUID string) {
+// SegmentCompactor reclaim space of deleted chunks in segment stores every CompactInterval
+func (s *ChunkServer) SegmentCompactor(ctx context.Context) error {
+	for {
+		if !sleep(ctx, config.CompactInterval) {
+			return nil
+		}
+		if n := s.disks.Compact(config.CompactGarbage); n > 0 {
+			logger.Sugar.Infof("%d bytes of segments are reclaimed", n)
+		}
+	}
+}
+
+// replicaNumOf returns how many replicas chunk should have, packs are shared by files so they
+// follow ReplicaNum
+func (s *ChunkServer) replicaNumOf(chunk *pb.Chunk) (int, error) {
+	if chunk.Packed {
+		return config.ReplicaNum, nil
+	}
+	file, err := utils.GetFileMeta(s.etcdClient, chunk.FileUUID)
+	if err != nil {
+		return 0, err
+	}
+	return int(file.ReplicaNum), nil
+}
+
+// liveReplicas returns replicas of chunk which are in workers
+func liveReplicas(chunk *pb.Chunk, workers []string) []string {
+	live := []string{}
+	for _, node := range chunk.Replicas {
+		if contains(workers, node) {
+			live = append(live, node)
+		}
+	}
+	return live
+}
+
+// SyncChunk replicate chunk in this chunkserver to other nodes, until it has as many live
+// replicas as it should
+func (s *ChunkServer) SyncChunk(chunkUUID string) error {
 	// get metadata of chunk
 	chunk, err := utils.GetChunkMeta(s.etcdClient, chunkUUID)
 	if err != nil {
 		logger.Sugar.Errorf("failed to sync chunk %s: %s", chunkUUID, err)
-		return
+		return err
 	}
-
-	// get metadata of file
-	file, err := utils.GetFileMeta(s.etcdClient, chunk.FileUUID)
+	replicaNum, err := s.replicaNumOf(chunk)
 	if err != nil {
 		logger.Sugar.Errorf("failed to sync chunk %s: %s", chunkUUID, err)
-		return
+		return err
 	}
 
 	// get workers
 	workers, err := utils.GetWorkersMeta(s.etcdClient)
 	if err != nil {
 		logger.Sugar.Errorf("failed to sync chunk %s: %s", chunkUUID, err)
-		return
+		return err
 	}
 
-	syncTo := selection.Random(workers, s.name, file.ReplicaNum)
+	missing := replicaNum - len(liveReplicas(chunk, workers))
+	if missing <= 0 {
+		return nil
+	}
+	syncTo := selection.Pick(workers, append([]string{s.name}, chunk.Replicas...), missing)
 	if len(syncTo) == 0 {
 		logger.Sugar.Warnf("do not find any scheduable node for chunk %s, so quit", chunkUUID)
-		return
+		return nil
 	}
 
 	succeed := []string{}
@@ -283,17 +835,21 @@ func (s *ChunkServer) SyncChunk(chunkUUID string) {
 			continue
 		}
 		// get gRPC ready
-		conn, err := grpc.Dial(dialURL, grpc.WithInsecure(), grpc.WithMaxMsgSize(config.GRPCMaxMsgSize))
+		conn, err := s.dial(dialURL)
 		if err != nil {
-			logger.Sugar.Fatalf("failed to connect to grpc server %s: %s", config.GRPCAddr, err)
+			logger.Sugar.Errorf("failed to connect to grpc server %s: %s", dialURL, err)
+			continue
 		}
-		defer conn.Close()
 
 		grpcClient := pb.NewChunkServerClient(conn)
-		if err := hfsclient.UploadChunk(grpcClient, chunkUUID); err != nil {
+		err = s.uploadChunk(grpcClient, chunkUUID)
+		conn.Close()
+		if err != nil {
 			logger.Sugar.Errorf("failed to sync chunk %s to node %s: %s", chunkUUID, node, err)
+			syncs.WithLabelValues("failure").Inc()
 			continue
 		}
+		syncs.WithLabelValues("success").Inc()
 
 		logger.Sugar.Infof("chunk %s sync to node %s success!", chunkUUID, node)
 		succeed = append(succeed, node)
@@ -301,28 +857,98 @@ func (s *ChunkServer) SyncChunk(chunkUUID string) {
 
 	if len(succeed) < 1 {
 		logger.Sugar.Infof("chunk %s sync failed!", chunkUUID)
-		return
+		return ErrFailedWrite
 	}
 
-	// TODO: reread metadata of chunk
-	// NOTE: here should start a transaction? for data safe
-	chunk.Replicas = append(chunk.Replicas, succeed...)
+	if err := retry(retries, func() error { return s.addReplicas(chunkUUID, succeed) }); err != nil {
+		logger.Sugar.Errorf("failed to save metadata of chunk %s: %s", chunkUUID, err)
+		return err
+	}
+
+	logger.Sugar.Infof("metadata of chunk %s updated!", chunkUUID)
+	return nil
+}
+
+// addReplicas add nodes to replicas of chunk, metadata of chunk is reread so that concurrent
+// updates are not overwritten
+func (s *ChunkServer) addReplicas(chunkUUID string, nodes []string) error {
+	chunkPath := config.ChunkBasePath + chunkUUID
+	resp, err := s.etcdClient.Get(context.Background(), chunkPath)
+	if err != nil {
+		return err
+	} else if len(resp.Kvs) == 0 {
+		// chunk is removed meanwhile, replicas will be removed by nobody, but nothing refers them
+		logger.Sugar.Warnf("chunk %s is removed while it's synced", chunkUUID)
+		return nil
+	}
+
+	var chunk pb.Chunk
+	if err := json.Unmarshal(resp.Kvs[0].Value, &chunk); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if !contains(chunk.Replicas, node) {
+			chunk.Replicas = append(chunk.Replicas, node)
+		}
+	}
 	v, err := utils.ToJSONString(chunk)
 	if err != nil {
-		logger.Sugar.Fatalf("failed to save metadata of chunk %s: %s", chunkUUID, err)
+		return err
 	}
-	_, err = s.etcdClient.Put(context.Background(), config.ChunkBasePath+chunkUUID, v)
+
+	txn, err := s.etcdClient.Txn(context.Background()).If(
+		clientv3.Compare(clientv3.ModRevision(chunkPath), "=", resp.Kvs[0].ModRevision),
+	).Then(
+		clientv3.OpPut(chunkPath, v),
+	).Commit()
 	if err != nil {
-		logger.Sugar.Fatalf("failed to save metadata of chunk %s: %s", chunkUUID, err)
+		return err
+	} else if !txn.Succeeded {
+		return fmt.Errorf("metadata of chunk %s is updated meanwhile", chunkUUID)
 	}
+	return nil
+}
 
-	logger.Sugar.Infof("metadata of chunk %s updated!", chunkUUID)
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
 }
 
-func (s *ChunkServer) ChunkWatcher() {
-	chunkChan := s.etcdClient.Watch(context.Background(), config.ChunkBasePath, clientv3.WithPrefix())
+// uploadChunk send local chunk with chunkUUID to the peer behind client
+func (s *ChunkServer) uploadChunk(client pb.ChunkServerClient, chunkUUID string) error {
+	disk, err := s.disks.Locate(chunkUUID)
+	if err != nil {
+		logger.Sugar.Errorf("failed to locate chunk %s: %s", chunkUUID, err)
+		return err
+	}
+	data, err := disk.Store.Get(chunkUUID)
+	if err != nil {
+		logger.Sugar.Errorf("failed to read chunk %s: %s", chunkUUID, err)
+		s.disks.Fail(disk, err)
+		return err
+	}
+
+	if _, err := client.CreateChunk(context.Background(), &pb.FileChunkData{Data: data, Msg: chunkUUID}); err != nil {
+		logger.Sugar.Errorf("failed to sync chunk %s: %s", chunkUUID, err)
+		return err
+	}
+
+	return nil
+}
+
+// ChunkWatcher watch new chunks, and replicate the ones created at this chunkserver. it fails
+// if the watch is closed before ctx is done, so that it's restarted
+func (s *ChunkServer) ChunkWatcher(ctx context.Context) error {
+	chunkChan := s.etcdClient.Watch(ctx, config.ChunkBasePath, clientv3.WithPrefix())
 
 	for resp := range chunkChan {
+		if err := resp.Err(); err != nil {
+			return err
+		}
 		for _, ev := range resp.Events {
 			switch ev.Type {
 			case mvccpb.PUT:
@@ -340,24 +966,150 @@ func (s *ChunkServer) ChunkWatcher() {
 					if chunk.Replicas[0] != s.name {
 						logger.Sugar.Infof("chunk %s is not created at %s, so it will not responsible for sync it", chunk.UUID, s.name)
 					} else {
-						go s.SyncChunk(chunk.UUID)
+						s.tasks.Add(1)
+						go s.syncChunk(chunk.UUID)
 					}
 				}
 			case mvccpb.DELETE:
 				logger.Sugar.Infof("chunk %s deleted: %s\n", ev.Kv.Key, ev.Kv.Value)
 			default:
-				logger.Sugar.Fatalf("watcher: should not be here")
+				logger.Sugar.Warnf("watcher: unknown event %s of %s", ev.Type, ev.Kv.Key)
 			}
 		}
 	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("watch of %s is closed", config.ChunkBasePath)
+}
+
+// syncChunk is SyncChunk in background, failures are retried. s.tasks should be added for it
+func (s *ChunkServer) syncChunk(chunkUUID string) {
+	defer s.tasks.Done()
+	syncQueue.Add(1)
+	defer syncQueue.Add(-1)
+
+	if err := retry(retries, func() error { return s.SyncChunk(chunkUUID) }); err != nil {
+		logger.Sugar.Errorf("give up syncing chunk %s: %s", chunkUUID, err)
+	}
+}
+
+// checkCluster rejects requests for other clusters, requests which don't tell cluster are accepted
+func checkCluster(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	if clusters := md.Get(config.ClusterMetadataKey); len(clusters) > 0 && clusters[0] != config.ClusterName {
+		logger.Sugar.Warnf("reject request for cluster %s, this is cluster %s", clusters[0], config.ClusterName)
+		return ErrWrongCluster
+	}
+
+	return nil
+}
+
+// authenticate identify caller of method, it returns a context which carries the identity
+func (s *ChunkServer) authenticate(ctx context.Context, method string) (context.Context, error) {
+	id, err := s.auth.Identify(ctx)
+	if err != nil {
+		logger.Sugar.Warnf("reject unauthenticated request of %s", method)
+		return nil, err
+	}
+	if peerOnly[method] && !s.auth.IsMember(id) {
+		logger.Sugar.Warnf("reject request of %s from %s, it's not a member of cluster", method, id)
+		return nil, auth.ErrPermissionDenied
+	}
+
+	return auth.NewContext(ctx, id), nil
+}
+
+// serverStream overrides context of stream, so that handlers see identity of caller
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// only one interceptor can be installed, so it does all the checks in order. panic of handler
+// fails the request instead of the whole chunkserver
+func (s *ChunkServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := checkCluster(ctx); err != nil {
+		return nil, s.annotate(err)
+	}
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, s.annotate(err)
+	}
+
+	return metrics.ServerRPC.UnaryServerInterceptor()(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		var resp interface{}
+		err := recovered(func() (err error) {
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, s.annotate(err)
+	})
+}
+
+func (s *ChunkServer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := checkCluster(ss.Context()); err != nil {
+		return s.annotate(err)
+	}
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return s.annotate(err)
+	}
+
+	return metrics.ServerRPC.StreamServerInterceptor()(srv, &serverStream{ServerStream: ss, ctx: ctx}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return s.annotate(recovered(func() error {
+			return handler(srv, ss)
+		}))
+	})
+}
+
+// annotate convert err into gRPC status with ErrorDetail, which tells which chunkserver returns
+// it. errors which are not gRPC status are internal errors
+func (s *ChunkServer) annotate(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		st = status.New(codes.Internal, err.Error())
+	}
+
+	detail := &pb.ErrorDetail{Reason: st.Code().String()}
+	for _, d := range st.Details() {
+		if d, ok := d.(*pb.ErrorDetail); ok {
+			detail = d
+		}
+	}
+	detail.Node = s.name
+
+	annotated, derr := status.New(st.Code(), st.Message()).WithDetails(detail)
+	if derr != nil {
+		return st.Err()
+	}
+	return annotated.Err()
 }
 
 // StartChunkServer works as it's name
 func StartChunkServer() {
+	etcdTLS, err := tlsconfig.EtcdClient()
+	if err != nil {
+		logger.Sugar.Fatalf("failed to load TLS configuration of etcd: %s", err)
+	}
 	etcdClient, err := clientv3.New(
 		clientv3.Config{
 			Endpoints:   config.EtcdEndpoints,
-			DialTimeout: 2 * time.Second,
+			DialTimeout: config.EtcdDialTimeout,
+			TLS:         etcdTLS,
+			DialOptions: []grpc.DialOption{grpc.WithUnaryInterceptor(metrics.EtcdRPC.UnaryClientInterceptor())},
 		},
 	)
 
@@ -367,9 +1119,65 @@ func StartChunkServer() {
 
 	defer etcdClient.Close()
 
-	chunkServer := ChunkServer{config.ChunkServerName, config.ChunkServerAddr, etcdClient}
-	go chunkServer.KeepAlive()
-	go chunkServer.ChunkWatcher()
+	opts := files.WriteOptions{Durability: files.Durability(config.Durability), Fallocate: config.Fallocate, DirectIO: config.DirectIO}
+	disks, err := files.NewDisks(config.DataDirs, config.ChunkStore, opts)
+	if err != nil {
+		logger.Sugar.Fatalf("failed to open data directories %s: %s", config.DataDirs, err)
+	}
+	if config.DiskKeyFile != "" {
+		keys, err := loadDiskKeys()
+		if err != nil {
+			logger.Sugar.Fatalf("failed to load keys of disks: %s", err)
+		}
+		disks.Encrypt(keys)
+	}
+
+	dialOption, err := tlsconfig.DialOption()
+	if err != nil {
+		logger.Sugar.Fatalf("failed to load TLS configuration: %s", err)
+	}
+	authenticator, err := auth.FromConfig()
+	if err != nil {
+		logger.Sugar.Fatalf("failed to load tokens: %s", err)
+	}
+
+	chunkServer := ChunkServer{name: config.ChunkServerName, addr: config.ChunkServerAddr, etcdClient: etcdClient, session: NewSession(etcdClient, config.WorkerTTL), disks: disks, dialOption: dialOption, auth: authenticator}
+	chunkServer.election = NewElection(etcdClient, chunkServer.session, config.LeaderBasePath, chunkServer.name)
+	serverOptions := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(config.GRPCMaxMsgSize),
+		grpc.MaxSendMsgSize(config.GRPCMaxMsgSize),
+		grpc.UnaryInterceptor(chunkServer.unaryInterceptor),
+		grpc.StreamInterceptor(chunkServer.streamInterceptor),
+	}
+	if creds, err := tlsconfig.ServerOption(); err != nil {
+		logger.Sugar.Fatalf("failed to load TLS configuration: %s", err)
+	} else if creds != nil {
+		serverOptions = append(serverOptions, creds)
+	}
+
+	logger.Sugar.Infof("chunkserver %s joins cluster %s", config.ChunkServerName, config.ClusterName)
+	ctx, cancel := context.WithCancel(context.Background())
+	chunkServer.session.OnGrant(chunkServer.register)
+	chunkServer.supervise(ctx, "Session", chunkServer.session.Run)
+	chunkServer.supervise(ctx, "Coordinator", chunkServer.Coordinator)
+	chunkServer.supervise(ctx, "ChunkWatcher", chunkServer.ChunkWatcher)
+	chunkServer.supervise(ctx, "PackSealer", chunkServer.PackSealer)
+	chunkServer.supervise(ctx, "PackRecoverer", chunkServer.PackRecoverer)
+	if config.DiskKeyFile != "" {
+		chunkServer.supervise(ctx, "Rekeyer", chunkServer.Rekeyer)
+	}
+	if config.ChunkStore == files.StoreSegment && config.CompactInterval > 0 {
+		chunkServer.supervise(ctx, "SegmentCompactor", chunkServer.SegmentCompactor)
+	}
+
+	if config.MetricsAddr != "" {
+		exposeDisks(disks)
+		chunkServer.supervise(ctx, "ChunkCounter", chunkServer.ChunkCounter)
+		if err := metrics.Serve(config.MetricsAddr); err != nil {
+			logger.Sugar.Fatalf("failed to serve metrics: %s", err)
+		}
+		logger.Sugar.Infof("metrics are served at %s/metrics", config.MetricsAddr)
+	}
 
 	// grpc server
 	lis, err := net.Listen("tcp", config.GRPCAddr)
@@ -377,8 +1185,61 @@ func StartChunkServer() {
 		logger.Sugar.Fatalf("failed to listen: %s", err)
 	}
 
-	grpcServer := grpc.NewServer(grpc.MaxRecvMsgSize(config.GRPCMaxMsgSize), grpc.MaxSendMsgSize(config.GRPCMaxMsgSize))
+	grpcServer := grpc.NewServer(serverOptions...)
 	pb.RegisterChunkServerServer(grpcServer, &chunkServer)
 	logger.Sugar.Infof("listen at %s", config.GRPCAddr)
-	grpcServer.Serve(lis)
+
+	served := make(chan error, 1)
+	go func() { served <- grpcServer.Serve(lis) }()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case sig := <-signals:
+		logger.Sugar.Infof("received %s, shutting down", sig)
+	case err := <-served:
+		logger.Sugar.Errorf("grpc server stopped, shutting down: %s", err)
+	}
+	chunkServer.shutdown(grpcServer, cancel)
+}
+
+// shutdown drain chunkserver. it's deregistered first so that clients and other chunkservers
+// stop picking it, then in-flight requests are waited for. background tasks are canceled only
+// after that, so chunks created by those requests are still replicated, and then they're waited
+// for up to ShutdownTimeout
+func (s *ChunkServer) shutdown(grpcServer *grpc.Server, cancel context.CancelFunc) {
+	deadline := time.Now().Add(config.ShutdownTimeout)
+	s.session.Close()
+	logger.Sugar.Infof("chunkserver %s deregistered", s.name)
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		logger.Sugar.Infof("in-flight requests are done")
+	case <-time.After(time.Until(deadline)):
+		logger.Sugar.Warnf("in-flight requests are not done in %s, cancel them", config.ShutdownTimeout)
+		grpcServer.Stop()
+	}
+
+	cancel()
+
+	// nothing appends to the open pack now, seal it and replicate it here, ChunkWatcher is
+	// stopped already
+	s.pack.mu.Lock()
+	packUUID := s.pack.uuid
+	s.sealPack()
+	s.pack.mu.Unlock()
+	if packUUID != "" {
+		s.tasks.Add(1)
+		go s.syncChunk(packUUID)
+	}
+
+	if !s.waitTasks(time.Until(deadline)) {
+		logger.Sugar.Warnf("background tasks are not done in %s, exit anyway", config.ShutdownTimeout)
+	}
+	logger.Sugar.Infof("chunkserver %s stopped", s.name)
 }
@@ -0,0 +1,385 @@
+package chunkserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/auth"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/files"
+	"github.com/jiajunhuang/hfs/pkg/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer returns a chunkserver named name with a memory disk, it serves gRPC and is
+// registered in etcd
+func newTestServer(t *testing.T, name string, etcdClient *clientv3.Client) (*ChunkServer, func()) {
+	dir, err := ioutil.TempDir("", "hfs-chunkserver")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	disks, err := files.NewDisks([]string{dir}, files.StoreMemory, files.WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to open disks: %s", err)
+	}
+	authenticator, _ := auth.New(auth.Options{})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	s := &ChunkServer{name: name, addr: lis.Addr().String(), etcdClient: etcdClient, disks: disks, dialOption: grpc.WithInsecure(), auth: authenticator}
+	server := grpc.NewServer(grpc.UnaryInterceptor(s.unaryInterceptor), grpc.StreamInterceptor(s.streamInterceptor))
+	pb.RegisterChunkServerServer(server, s)
+	go server.Serve(lis)
+
+	if _, err := etcdClient.Put(context.Background(), config.WorkerBasePath+name, s.addr); err != nil {
+		t.Fatalf("failed to register %s: %s", name, err)
+	}
+
+	return s, func() {
+		server.Stop()
+		disks.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// putChunk store data as chunk in s, and write metadata of it
+func putChunk(t *testing.T, s *ChunkServer, chunkUUID string, data []byte, replicas ...string) {
+	disk, err := s.disks.Pick(0)
+	if err != nil {
+		t.Fatalf("failed to pick disk: %s", err)
+	}
+	if err := disk.Store.Put(chunkUUID, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("failed to put chunk: %s", err)
+	}
+	v, _ := utils.ToJSONString(pb.Chunk{UUID: chunkUUID, Size: int64(len(data)), Used: int64(len(data)), Replicas: replicas})
+	if _, err := s.etcdClient.Put(context.Background(), config.ChunkBasePath+chunkUUID, v); err != nil {
+		t.Fatalf("failed to put metadata of chunk: %s", err)
+	}
+}
+
+func TestReadChunkFromReplica(t *testing.T) {
+	etcdClient, _ := newFakeEtcd()
+	picked, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	replica, stopReplica := newTestServer(t, "node-2", etcdClient)
+	defer stopReplica()
+	ctx := context.Background()
+
+	// the first replica is gone, the chunk is read from the second one
+	putChunk(t, replica, "chunk-1", []byte("hello, hfs"), "node-0", "node-2")
+
+	data, err := picked.ReadChunk(ctx, &pb.ReadChunkRequest{ChunkUUID: "chunk-1", Offset: 7, Length: 3})
+	if err != nil || string(data.Data) != "hfs" {
+		t.Fatalf("should read hfs from replica but got %v, err: %v", data, err)
+	}
+
+	if _, err := picked.ReadChunk(ctx, &pb.ReadChunkRequest{ChunkUUID: "chunk-2", Length: 3}); status.Code(err) != codes.NotFound {
+		t.Fatalf("chunk without metadata should be not found but got %v", err)
+	}
+
+	// replicas only claim it, nobody has it
+	v, _ := utils.ToJSONString(pb.Chunk{UUID: "chunk-3", Replicas: []string{"node-1", "node-2"}})
+	etcdClient.Put(ctx, config.ChunkBasePath+"chunk-3", v)
+	if _, err := picked.ReadChunk(ctx, &pb.ReadChunkRequest{ChunkUUID: "chunk-3", Length: 3}); status.Code(err) != codes.NotFound {
+		t.Fatalf("chunk which is lost should be not found but got %v", err)
+	}
+
+	// the replica is registered but it's down
+	stopReplica()
+	if _, err := picked.ReadChunk(ctx, &pb.ReadChunkRequest{ChunkUUID: "chunk-1", Length: 3}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("chunk should be unavailable but got %v", err)
+	}
+}
+
+func TestReadFileFromReplica(t *testing.T) {
+	etcdClient, kv := newFakeEtcd()
+	picked, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	replica, stopReplica := newTestServer(t, "node-2", etcdClient)
+	defer stopReplica()
+	conn, err := grpc.Dial(picked.addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer conn.Close()
+
+	// the second chunk is only in the other chunkserver
+	putChunk(t, picked, "chunk-1", []byte("hello, "), "node-1")
+	putChunk(t, replica, "chunk-2", []byte("hfs"), "node-2")
+	v, _ := utils.ToJSONString(pb.File{UUID: "file-1", FileName: "hello.txt", Size: 10, Chunks: []*pb.Chunk{
+		{UUID: "chunk-1", Used: 7, Replicas: []string{"node-1"}},
+		{UUID: "chunk-2", Used: 3, Replicas: []string{"node-2"}},
+	}})
+	kv.set(config.FileBasePath+"file-1", v)
+	kv.set(config.FileBasePath+"file-2", "{bad json")
+
+	readFile := func(fileUUID string) (string, error) {
+		stream, err := pb.NewChunkServerClient(conn).ReadFile(context.Background(), &pb.ReadFileRequest{FileUUID: fileUUID})
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		for {
+			data, err := stream.Recv()
+			if err == io.EOF {
+				return buf.String(), nil
+			} else if err != nil {
+				return buf.String(), err
+			}
+			buf.Write(data.Data)
+		}
+	}
+
+	if data, err := readFile("file-1"); err != nil || data != "hello, hfs" {
+		t.Fatalf("should read hello, hfs but got %q, err: %v", data, err)
+	}
+	if _, err := readFile("file-2"); status.Code(err) != status.Code(ErrFailedGetFile) {
+		t.Fatalf("bad metadata should fail to get file but got %v", err)
+	}
+	stopReplica()
+	if _, err := readFile("file-1"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("file should be unavailable but got %v", err)
+	}
+}
+
+func TestChmod(t *testing.T) {
+	etcdClient, kv := newFakeEtcd()
+	s, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	ctx := context.Background()
+
+	v, _ := utils.ToJSONString(pb.File{UUID: "file-1", Mode: auth.PermAll})
+	kv.set(config.FileBasePath+"file-1", v)
+	if _, err := s.Chmod(ctx, &pb.ChmodRequest{FileUUID: "file-1", Mode: auth.PermRead}); err != nil {
+		t.Fatalf("failed to chmod: %s", err)
+	}
+	file, err := utils.GetFileMeta(etcdClient, "file-1")
+	if err != nil || file.Mode != auth.PermRead {
+		t.Fatalf("mode should be changed but got %+v, err: %v", file, err)
+	}
+
+	if _, err := s.Chmod(ctx, &pb.ChmodRequest{FileUUID: "file-2", Mode: auth.PermRead}); err != ErrFileNotExist {
+		t.Fatalf("absent file should not exist but got %v", err)
+	}
+	kv.set(config.FileBasePath+"file-3", "{bad json")
+	if _, err := s.Chmod(ctx, &pb.ChmodRequest{FileUUID: "file-3", Mode: auth.PermRead}); err != ErrFailedGetFile {
+		t.Fatalf("bad metadata should fail to get file but got %v", err)
+	}
+}
+
+func TestSetQuota(t *testing.T) {
+	etcdClient, _ := newFakeEtcd()
+	s, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	ctx := context.Background()
+
+	if _, err := s.SetQuota(ctx, &pb.Quota{Owner: "alice", MaxBytes: 100, MaxFiles: 10}); err != nil {
+		t.Fatalf("failed to set quota: %s", err)
+	}
+	// only the limit which is given is written, the other one isn't replaced by its effective value
+	if _, err := s.SetQuota(ctx, &pb.Quota{Owner: "alice", MaxBytes: 200, KeepMaxFiles: true}); err != nil {
+		t.Fatalf("failed to set quota: %s", err)
+	}
+	if _, err := s.SetQuota(ctx, &pb.Quota{Owner: "bob", KeepMaxBytes: true, MaxFiles: 5}); err != nil {
+		t.Fatalf("failed to set quota: %s", err)
+	}
+
+	for owner, want := range map[string][2]int64{"alice": {200, 10}, "bob": {0, 5}} {
+		q, _, err := s.loadQuota(ctx, owner)
+		if err != nil || q.MaxBytes != want[0] || q.MaxFiles != want[1] {
+			t.Fatalf("quota of %s should be %v but got %+v, err: %v", owner, want, q, err)
+		}
+	}
+}
+
+func TestCreateFileDiscarded(t *testing.T) {
+	defer withChunkSize(8)()
+	etcdClient, _ := newFakeEtcd()
+	s, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	conn, err := grpc.Dial(s.addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer conn.Close()
+
+	// chunks returns how many chunks are in etcd and the disk
+	chunks := func() (int, int) {
+		resp, err := etcdClient.Get(context.Background(), config.ChunkBasePath, clientv3.WithPrefix())
+		if err != nil {
+			t.Fatalf("failed to list chunks: %s", err)
+		}
+		disk, _ := s.disks.Pick(0)
+		uuids, _ := disk.Store.List()
+		return len(resp.Kvs), len(uuids)
+	}
+
+	tests := []struct {
+		name   string
+		last   *pb.FileChunkData // sent after 2 chunks, nil to abort
+		chunks int               // how many chunks are left
+	}{
+		{"aborted", nil, 0},
+		{"bad request", &pb.FileChunkData{Data: []byte("data"), Codec: "bad"}, 0},
+		{"committed", &pb.FileChunkData{Data: []byte("data")}, 3},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := pb.NewChunkServerClient(conn).CreateFile(ctx)
+		if err != nil {
+			t.Fatalf("%s: failed to create file: %s", tt.name, err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := stream.Send(&pb.FileChunkData{Data: []byte("12345678"), Msg: "file"}); err != nil {
+				t.Fatalf("%s: failed to send: %s", tt.name, err)
+			}
+		}
+		// the first chunk is written once the second one arrives
+		deadline := time.Now().Add(5 * time.Second)
+		for n, _ := chunks(); n == 0; n, _ = chunks() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: the first chunk should be written", tt.name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if tt.last == nil {
+			cancel()
+		} else {
+			stream.Send(tt.last)
+			stream.CloseAndRecv()
+		}
+
+		for {
+			meta, data := chunks()
+			if meta == tt.chunks && data == tt.chunks {
+				break
+			} else if time.Now().After(deadline) {
+				t.Fatalf("%s: %d chunks should be left but got %d in etcd and %d in disk", tt.name, tt.chunks, meta, data)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	defer withChunkSize(8)()
+	defer func(timeout time.Duration) { config.ShutdownTimeout = timeout }(config.ShutdownTimeout)
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		finish  bool // whether the in-flight upload finishes
+	}{
+		{"drained", 5 * time.Second, true},
+		{"timed out", 200 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		config.ShutdownTimeout = tt.timeout
+		etcdClient, kv := newFakeEtcd()
+		s, cleanup := newTestServer(t, "node-1", etcdClient)
+		defer cleanup()
+
+		// it's shut down by shutdown instead of cleanup
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("%s: failed to listen: %s", tt.name, err)
+		}
+		server := grpc.NewServer(grpc.UnaryInterceptor(s.unaryInterceptor), grpc.StreamInterceptor(s.streamInterceptor))
+		pb.RegisterChunkServerServer(server, s)
+		go server.Serve(lis)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		s.session = NewSession(etcdClient, time.Second)
+		s.session.OnGrant(s.register)
+		s.supervise(ctx, "Session", s.session.Run)
+		canceled := make(chan struct{})
+		s.supervise(ctx, "Task", func(ctx context.Context) error {
+			<-ctx.Done()
+			close(canceled)
+			return nil
+		})
+		if _, err := s.session.Current(ctx); err != nil {
+			t.Fatalf("%s: failed to start session: %s", tt.name, err)
+		}
+
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		if err != nil {
+			t.Fatalf("%s: failed to dial: %s", tt.name, err)
+		}
+		defer conn.Close()
+		stream, err := pb.NewChunkServerClient(conn).CreateFile(context.Background())
+		if err != nil {
+			t.Fatalf("%s: failed to create file: %s", tt.name, err)
+		}
+		if err := stream.Send(&pb.FileChunkData{Data: []byte("12345678"), Msg: "file"}); err != nil {
+			t.Fatalf("%s: failed to send: %s", tt.name, err)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			s.shutdown(server, cancel)
+			close(done)
+		}()
+
+		// it's deregistered at once, and stops accepting connections
+		deadline := time.Now().Add(5 * time.Second)
+		for kv.value(config.WorkerBasePath+"node-1") != nil {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: chunkserver should be deregistered", tt.name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if _, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(100*time.Millisecond)); err == nil {
+			t.Fatalf("%s: new connections should be refused", tt.name)
+		}
+
+		if tt.finish {
+			// background tasks are kept until in-flight requests are done
+			select {
+			case <-done:
+				t.Fatalf("%s: shutdown should wait for in-flight requests", tt.name)
+			case <-canceled:
+				t.Fatalf("%s: background tasks should be kept until in-flight requests are done", tt.name)
+			default:
+			}
+			stream.Send(&pb.FileChunkData{Data: []byte("data")})
+			if resp, err := stream.CloseAndRecv(); err != nil || resp.File.Size != 12 {
+				t.Fatalf("%s: in-flight upload should finish but got %v, err: %v", tt.name, resp, err)
+			}
+		}
+
+		select {
+		case <-done:
+		case <-time.After(tt.timeout + 5*time.Second):
+			t.Fatalf("%s: shutdown should return", tt.name)
+		}
+		// they're not waited for once the deadline is passed
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: background tasks should be canceled", tt.name)
+		}
+		if !tt.finish {
+			if _, err := stream.CloseAndRecv(); err == nil {
+				t.Fatalf("%s: upload should be canceled after timeout", tt.name)
+			}
+		}
+		if kv.liveLeases() != 0 {
+			t.Fatalf("%s: lease should be revoked", tt.name)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package chunkserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/logger"
+	"github.com/jiajunhuang/hfs/pkg/utils"
+	"google.golang.org/grpc/codes"
+)
+
+/*
+the leader of chunkservers coordinates cluster-wide tasks, which would duplicate or race with
+each other if every chunkserver did them. they're started once a chunkserver is elected, and
+stopped once it loses leadership, then another chunkserver takes over.
+*/
+
+// leaderTask is a cluster-wide task run by the leader every interval
+type leaderTask struct {
+	name     string
+	interval time.Duration // 0 disables it
+	run      func(ctx context.Context) error
+}
+
+// leaderTasks returns tasks of a new term, they don't share states with the previous term
+func (s *ChunkServer) leaderTasks(term int64) []leaderTask {
+	return []leaderTask{
+		{"Repair", config.RepairInterval, s.newRepairer(term)},
+		{"Compact", config.CompactInterval, s.compact},
+	}
+}
+
+// Coordinator campaigns for leadership, and runs leaderTasks while this chunkserver is the leader
+func (s *ChunkServer) Coordinator(ctx context.Context) error {
+	isLeader.Set(0)
+	for {
+		term, lost, err := s.election.Campaign(ctx)
+		if ctx.Err() != nil || err == ErrSessionClosed {
+			return nil
+		} else if err == ErrSessionLost {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		logger.Sugar.Infof("chunkserver %s is the leader of term %d", s.name, term)
+		isLeader.Set(1)
+		leaderCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		for _, task := range s.leaderTasks(term) {
+			if task.interval == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(task leaderTask) {
+				defer wg.Done()
+				for sleep(leaderCtx, task.interval) {
+					if err := recovered(func() error { return task.run(leaderCtx) }); err != nil {
+						logger.Sugar.Errorf("leader task %s failed: %s", task.name, err)
+					}
+				}
+			}(task)
+		}
+
+		select {
+		case <-lost:
+		case <-ctx.Done():
+		}
+		cancel()
+		wg.Wait()
+		isLeader.Set(0)
+		if ctx.Err() != nil {
+			return nil
+		}
+		logger.Sugar.Warnf("chunkserver %s lost leadership of term %d", s.name, term)
+	}
+}
+
+// bounds of repairing, chunks which don't fit in the queue are left to the next round
+const (
+	repairWorkers   = 8    // how many chunks are repaired at the same time
+	repairQueueSize = 1024 // how many chunks wait for workers at most
+)
+
+// repairer replicates chunks having fewer live replicas than they should by a pool of workers.
+// a chunk is queued at most once until it's repaired
+type repairer struct {
+	s        *ChunkServer
+	since    int64 // chunks changed after it are skipped, they may be being synced by their creators
+	queue    chan repairJob
+	start    sync.Once
+	mu       sync.Mutex
+	inFlight map[string]bool // chunks which are queued or being repaired
+}
+
+type repairJob struct {
+	chunkUUID string
+	holders   []string // live replicas of chunk
+}
+
+// newRepairer returns task which queues chunks having fewer live replicas than they should,
+// workers are started in the first round, and stopped once ctx of it is done. chunks changed
+// before revision since are repaired in the first round
+func (s *ChunkServer) newRepairer(since int64) func(ctx context.Context) error {
+	r := &repairer{s: s, since: since, queue: make(chan repairJob, repairQueueSize), inFlight: map[string]bool{}}
+	return r.run
+}
+
+func (r *repairer) run(ctx context.Context) error {
+	r.start.Do(func() {
+		for i := 0; i < repairWorkers; i++ {
+			r.s.tasks.Add(1)
+			go r.work(ctx)
+		}
+	})
+
+	workers, err := utils.GetWorkersMeta(r.s.etcdClient)
+	if err != nil {
+		return err
+	}
+	resp, err := r.s.etcdClient.Get(ctx, config.ChunkBasePath, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	queued := 0
+	for _, kv := range resp.Kvs {
+		if kv.ModRevision > r.since {
+			continue
+		}
+		var chunk pb.Chunk
+		if err := json.Unmarshal(kv.Value, &chunk); err != nil {
+			logger.Sugar.Errorf("failed to unmarshal chunk %s: %s", kv.Key, err)
+			continue
+		}
+		replicaNum, err := r.s.replicaNumOf(&chunk)
+		if err != nil {
+			continue // file is removed meanwhile
+		}
+
+		live := liveReplicas(&chunk, workers)
+		if len(live) >= replicaNum || len(live) >= len(workers) {
+			continue
+		} else if len(live) == 0 {
+			logger.Sugar.Warnf("chunk %s has no live replica, it's lost until one of %s is back", chunk.UUID, chunk.Replicas)
+			continue
+		}
+
+		if r.enqueue(repairJob{chunk.UUID, live}) {
+			queued++
+		}
+	}
+
+	r.since = resp.Header.Revision
+	if queued > 0 {
+		logger.Sugar.Infof("%d chunks which lost replicas are queued to be repaired", queued)
+	}
+	return nil
+}
+
+// enqueue returns false if chunk is already queued or being repaired, or the queue is full
+func (r *repairer) enqueue(job repairJob) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.inFlight[job.chunkUUID] {
+		return false
+	}
+	select {
+	case r.queue <- job:
+		r.inFlight[job.chunkUUID] = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *repairer) work(ctx context.Context) {
+	defer r.s.tasks.Done()
+
+	for {
+		select {
+		case job := <-r.queue:
+			if err := recovered(func() error { return r.s.replicate(ctx, job.chunkUUID, job.holders) }); err != nil {
+				logger.Sugar.Errorf("failed to repair chunk %s: %s", job.chunkUUID, err)
+			}
+			r.mu.Lock()
+			delete(r.inFlight, job.chunkUUID)
+			r.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replicate ask one of holders of chunk to replicate it, it's done by this chunkserver itself
+// if it's one of them
+func (s *ChunkServer) replicate(ctx context.Context, chunkUUID string, holders []string) error {
+	if contains(holders, s.name) {
+		s.tasks.Add(1)
+		s.syncChunk(chunkUUID)
+		return nil
+	}
+
+	var err error
+	for _, node := range holders {
+		var dialURL string
+		if dialURL, err = utils.GetWorkerAddr(s.etcdClient, node); err != nil {
+			continue
+		}
+		conn, derr := s.dial(dialURL)
+		if err = derr; err != nil {
+			continue
+		}
+		_, err = pb.NewChunkServerClient(conn).ReplicateChunk(ctx, &pb.ReplicateChunkRequest{ChunkUUID: chunkUUID})
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// ReplicateChunk replicate chunk in this chunkserver to other nodes in background, it's called
+// by the leader for chunks which lost replicas
+func (s *ChunkServer) ReplicateChunk(ctx context.Context, req *pb.ReplicateChunkRequest) (*pb.GenericResponse, error) {
+	if req.ChunkUUID == "" {
+		return nil, ErrBadRequest
+	}
+	if _, err := s.disks.Locate(req.ChunkUUID); err != nil {
+		return nil, ErrFileNotExist
+	}
+
+	s.tasks.Add(1)
+	go s.syncChunk(req.ChunkUUID)
+	return &pb.GenericResponse{Code: 0, Msg: "success"}, nil
+}
+
+// GetLeader returns the chunkserver which coordinates the cluster
+func (s *ChunkServer) GetLeader(ctx context.Context, req *pb.LeaderRequest) (*pb.Leader, error) {
+	leader, err := s.election.Leader(ctx)
+	if err == ErrNoLeader {
+		return nil, newError(codes.Unavailable, "NoLeader", "", "there's no leader, it's being elected")
+	} else if err != nil {
+		logger.Sugar.Errorf("failed to get leader: %s", err)
+		return nil, newError(codes.Unavailable, "ReadFailed", "", "failed to get leader")
+	}
+	return leader, nil
+}
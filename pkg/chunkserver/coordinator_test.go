@@ -0,0 +1,80 @@
+package chunkserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/utils"
+)
+
+func TestRepair(t *testing.T) {
+	etcdClient, kv := newFakeEtcd()
+	holder, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	leader, cleanup := newTestServer(t, "node-2", etcdClient)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// node-0 which held the other replica is gone
+	v, _ := utils.ToJSONString(pb.File{UUID: "file-1", ReplicaNum: 2})
+	kv.set(config.FileBasePath+"file-1", v)
+	putChunk(t, holder, "chunk-1", []byte("hello, hfs"), "node-1", "node-0")
+	v, _ = utils.ToJSONString(pb.Chunk{UUID: "chunk-1", FileUUID: "file-1", Size: 10, Used: 10, Replicas: []string{"node-1", "node-0"}})
+	kv.set(config.ChunkBasePath+"chunk-1", v)
+
+	// the term starts after chunk-1 is changed, so it's repaired in the first round, while
+	// chunk-2 which is changed after that is skipped until the next round
+	resp, _ := etcdClient.Get(ctx, config.ChunkBasePath+"chunk-1")
+	run := leader.newRepairer(resp.Header.Revision)
+	putChunk(t, holder, "chunk-2", []byte("hello, hfs"), "node-1", "node-0")
+	v, _ = utils.ToJSONString(pb.Chunk{UUID: "chunk-2", FileUUID: "file-1", Size: 10, Used: 10, Replicas: []string{"node-1", "node-0"}})
+	kv.set(config.ChunkBasePath+"chunk-2", v)
+	if err := run(ctx); err != nil {
+		t.Fatalf("failed to repair: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		chunk, err := utils.GetChunkMeta(etcdClient, "chunk-1")
+		if err == nil && contains(chunk.Replicas, "node-2") {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("chunk should be replicated to node-2 but got %+v, err: %v", chunk, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := leader.disks.Locate("chunk-1"); err != nil {
+		t.Fatalf("chunk should be stored in node-2: %s", err)
+	}
+	if chunk, err := utils.GetChunkMeta(etcdClient, "chunk-2"); err != nil || contains(chunk.Replicas, "node-2") {
+		t.Fatalf("chunk changed after the term starts should be skipped but got %+v, err: %v", chunk, err)
+	}
+
+	cancel()
+	if !leader.waitTasks(time.Second) {
+		t.Fatalf("workers should stop once the term is over")
+	}
+}
+
+func TestRepairQueue(t *testing.T) {
+	r := &repairer{queue: make(chan repairJob, 2), inFlight: map[string]bool{}}
+
+	if !r.enqueue(repairJob{chunkUUID: "chunk-1"}) {
+		t.Fatalf("chunk-1 should be queued")
+	}
+	if r.enqueue(repairJob{chunkUUID: "chunk-1"}) {
+		t.Fatalf("chunk-1 should be queued only once")
+	}
+	for i := 2; i <= 3; i++ {
+		if queued := r.enqueue(repairJob{chunkUUID: fmt.Sprintf("chunk-%d", i)}); queued != (i == 2) {
+			t.Fatalf("chunk-%d should be queued: %v, the queue holds 2 chunks", i, i == 2)
+		}
+	}
+	if len(r.queue) != 2 || len(r.inFlight) != 2 {
+		t.Fatalf("2 chunks should be in flight but got %d queued, %v", len(r.queue), r.inFlight)
+	}
+}
@@ -0,0 +1,95 @@
+package chunkserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/logger"
+	"github.com/jiajunhuang/hfs/pkg/utils"
+)
+
+/*
+leader is elected by concurrency.Election of etcd. every candidate puts a key under
+LeaderBasePath, attached to it's session. the candidate whose key has the smallest create
+revision is the leader, and create revision of the key is the term of it. a key is deleted once
+it's session is lost or closed, then the next candidate takes over.
+*/
+
+// error definitions
+var (
+	ErrNoLeader    = errors.New("there's no leader")
+	ErrSessionLost = errors.New("session is lost while campaigning")
+)
+
+// Election elects a leader among chunkservers
+type Election struct {
+	client  *clientv3.Client
+	session *Session
+	prefix  string // concurrency.Election puts keys under prefix + "/"
+	name    string // value of key of this candidate
+}
+
+// NewElection returns an election under prefix, candidates are identified by name
+func NewElection(client *clientv3.Client, session *Session, prefix string, name string) *Election {
+	return &Election{client: client, session: session, prefix: strings.TrimSuffix(prefix, "/"), name: name}
+}
+
+// Campaign waits until this candidate is elected, or ctx is done. it returns the term, and a
+// channel which is closed once the leadership is lost
+func (e *Election) Campaign(ctx context.Context) (int64, <-chan struct{}, error) {
+	session, err := e.session.Current(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	election := concurrency.NewElection(session, e.prefix)
+
+	// Campaign of etcd keeps waiting for candidates before this one even if the session is lost
+	campaignCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-campaignCtx.Done():
+		}
+	}()
+
+	// followers log changes of leadership while they wait
+	go func() {
+		for resp := range election.Observe(campaignCtx) {
+			if kv := resp.Kvs[0]; string(kv.Value) != e.name {
+				logger.Sugar.Infof("chunkserver %s is the leader of term %d", kv.Value, kv.CreateRevision)
+			}
+		}
+	}()
+
+	if err := election.Campaign(campaignCtx, e.name); err != nil {
+		if ctx.Err() == nil && campaignCtx.Err() != nil {
+			return 0, nil, ErrSessionLost
+		}
+		return 0, nil, err
+	}
+	return election.Rev(), session.Done(), nil
+}
+
+// Leader returns the current leader, ErrNoLeader if there's none. it's read directly instead of
+// by concurrency.Election, which needs a live session
+func (e *Election) Leader(ctx context.Context) (*pb.Leader, error) {
+	resp, err := e.client.Get(ctx, e.prefix+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return nil, err
+	} else if len(resp.Kvs) == 0 {
+		return nil, ErrNoLeader
+	}
+
+	leader := &pb.Leader{Name: string(resp.Kvs[0].Value), Term: resp.Kvs[0].CreateRevision}
+	// address is only informative, the leader may be leaving
+	if addr, err := utils.GetWorkerAddr(e.client, leader.Name); err == nil {
+		leader.Addr = addr
+	}
+	return leader, nil
+}
@@ -0,0 +1,367 @@
+package chunkserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// fakeKV is an in-memory clientv3.KV, it supports what chunkservers use: ranges, prefixes,
+// transactions which compare revisions or values, and keys attached to leases of fakeLease
+type fakeKV struct {
+	mu     sync.Mutex
+	rev    int64
+	kvs    map[string]*mvccpb.KeyValue
+	fail   bool // all the requests fail if it's set
+	leases map[clientv3.LeaseID]chan struct{}
+	grants int // how many leases are granted or tried to
+}
+
+var errFakeKV = errors.New("etcd is down")
+
+// newFakeEtcd returns an etcd client backed by fakeKV, only KV and Lease work
+func newFakeEtcd() (*clientv3.Client, *fakeKV) {
+	kv := &fakeKV{rev: 1, kvs: map[string]*mvccpb.KeyValue{}, leases: map[clientv3.LeaseID]chan struct{}{}}
+	return &clientv3.Client{KV: kv, Lease: &fakeLease{kv}}, kv
+}
+
+// keys returns keys of op in order
+func (kv *fakeKV) keys(op clientv3.Op) []string {
+	key, end := string(op.KeyBytes()), string(op.RangeBytes())
+	if end == "" {
+		if _, ok := kv.kvs[key]; ok {
+			return []string{key}
+		}
+		return nil
+	}
+
+	keys := []string{}
+	for k := range kv.kvs {
+		if k >= key && (end == "\x00" || k < end) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// value returns value of key, or nil if it doesn't exist
+func (kv *fakeKV) value(key string) []byte {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if v, ok := kv.kvs[key]; ok {
+		return v.Value
+	}
+	return nil
+}
+
+func (kv *fakeKV) set(key string, value string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.put(key, value, 0)
+}
+
+func (kv *fakeKV) put(key string, value string, lease int64) {
+	kv.rev++
+	v, ok := kv.kvs[key]
+	if !ok {
+		v = &mvccpb.KeyValue{Key: []byte(key), CreateRevision: kv.rev}
+		kv.kvs[key] = v
+	}
+	v.Value, v.ModRevision, v.Lease = []byte(value), kv.rev, lease
+	v.Version++
+}
+
+// expire lease as if it's not renewed in time, keys attached to it are deleted
+func (kv *fakeKV) expire(lease clientv3.LeaseID) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.revoke(lease)
+}
+
+func (kv *fakeKV) revoke(lease clientv3.LeaseID) bool {
+	expired, ok := kv.leases[lease]
+	if !ok {
+		return false
+	}
+	close(expired)
+	delete(kv.leases, lease)
+
+	for k, v := range kv.kvs {
+		if v.Lease == int64(lease) {
+			delete(kv.kvs, k)
+		}
+	}
+	kv.rev++
+	return true
+}
+
+// liveLeases returns how many leases are neither expired nor revoked
+func (kv *fakeKV) liveLeases() int {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	return len(kv.leases)
+}
+
+func (kv *fakeKV) apply(op clientv3.Op) *pb.ResponseOp {
+	header := &pb.ResponseHeader{Revision: kv.rev}
+	switch {
+	case op.IsPut():
+		// lease of op is not exported
+		kv.put(string(op.KeyBytes()), string(op.ValueBytes()), reflect.ValueOf(op).FieldByName("leaseID").Int())
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: &pb.PutResponse{Header: header}}}
+	case op.IsDelete():
+		keys := kv.keys(op)
+		for _, k := range keys {
+			delete(kv.kvs, k)
+		}
+		if len(keys) > 0 {
+			kv.rev++
+		}
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: &pb.DeleteRangeResponse{Header: header, Deleted: int64(len(keys))}}}
+	default:
+		resp := &pb.RangeResponse{Header: header}
+		for _, k := range kv.keys(op) {
+			v := *kv.kvs[k]
+			resp.Kvs = append(resp.Kvs, &v)
+		}
+		resp.Count = int64(len(resp.Kvs))
+		return &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{ResponseRange: resp}}
+	}
+}
+
+func (kv *fakeKV) do(op clientv3.Op) (*pb.ResponseOp, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if kv.fail {
+		return nil, errFakeKV
+	}
+	return kv.apply(op), nil
+}
+
+func (kv *fakeKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	resp, err := kv.do(clientv3.OpPut(key, val, opts...))
+	if err != nil {
+		return nil, err
+	}
+	return (*clientv3.PutResponse)(resp.GetResponsePut()), nil
+}
+
+func (kv *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp, err := kv.do(clientv3.OpGet(key, opts...))
+	if err != nil {
+		return nil, err
+	}
+	return (*clientv3.GetResponse)(resp.GetResponseRange()), nil
+}
+
+func (kv *fakeKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	resp, err := kv.do(clientv3.OpDelete(key, opts...))
+	if err != nil {
+		return nil, err
+	}
+	return (*clientv3.DeleteResponse)(resp.GetResponseDeleteRange()), nil
+}
+
+func (kv *fakeKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (kv *fakeKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	return clientv3.OpResponse{}, errors.New("not implemented")
+}
+
+func (kv *fakeKV) Txn(ctx context.Context) clientv3.Txn {
+	return &fakeTxn{kv: kv}
+}
+
+// fakeTxn is a transaction of fakeKV
+type fakeTxn struct {
+	kv      *fakeKV
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+}
+
+func (t *fakeTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *fakeTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thenOps = append(t.thenOps, ops...)
+	return t
+}
+
+func (t *fakeTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elseOps = append(t.elseOps, ops...)
+	return t
+}
+
+func (t *fakeTxn) Commit() (*clientv3.TxnResponse, error) {
+	t.kv.mu.Lock()
+	defer t.kv.mu.Unlock()
+
+	if t.kv.fail {
+		return nil, errFakeKV
+	}
+
+	succeeded := true
+	for _, c := range t.cmps {
+		succeeded = succeeded && t.kv.compare(c)
+	}
+	ops := t.thenOps
+	if !succeeded {
+		ops = t.elseOps
+	}
+
+	resp := &clientv3.TxnResponse{Succeeded: succeeded}
+	for _, op := range ops {
+		resp.Responses = append(resp.Responses, t.kv.apply(op))
+	}
+	resp.Header = &pb.ResponseHeader{Revision: t.kv.rev}
+	return resp, nil
+}
+
+// compare evaluates c, a key which doesn't exist has zero revisions and empty value
+func (kv *fakeKV) compare(c clientv3.Cmp) bool {
+	cmp := pb.Compare(c)
+	v, ok := kv.kvs[string(cmp.Key)]
+	if !ok {
+		v = &mvccpb.KeyValue{}
+	}
+
+	var result int
+	switch cmp.Target {
+	case pb.Compare_VALUE:
+		result = bytes.Compare(v.Value, cmp.GetValue())
+	case pb.Compare_VERSION:
+		result = compareInt(v.Version, cmp.GetVersion())
+	case pb.Compare_CREATE:
+		result = compareInt(v.CreateRevision, cmp.GetCreateRevision())
+	case pb.Compare_MOD:
+		result = compareInt(v.ModRevision, cmp.GetModRevision())
+	default:
+		return false
+	}
+
+	switch cmp.Result {
+	case pb.Compare_EQUAL:
+		return result == 0
+	case pb.Compare_NOT_EQUAL:
+		return result != 0
+	case pb.Compare_GREATER:
+		return result > 0
+	default:
+		return result < 0
+	}
+}
+
+func compareInt(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// fakeLease is clientv3.Lease of fakeKV. leases don't expire by time, KeepAlive renews them
+// every fakeRenewInterval until they're expired by fakeKV.expire or revoked
+type fakeLease struct {
+	kv *fakeKV
+}
+
+const fakeRenewInterval = 10 * time.Millisecond
+
+var errFakeLeaseNotFound = errors.New("lease not found")
+
+func (l *fakeLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	l.kv.mu.Lock()
+	defer l.kv.mu.Unlock()
+
+	l.kv.grants++
+	if l.kv.fail {
+		return nil, errFakeKV
+	}
+	l.kv.rev++
+	id := clientv3.LeaseID(l.kv.rev)
+	l.kv.leases[id] = make(chan struct{})
+	return &clientv3.LeaseGrantResponse{ID: id, TTL: ttl}, nil
+}
+
+func (l *fakeLease) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	l.kv.mu.Lock()
+	defer l.kv.mu.Unlock()
+
+	if l.kv.fail {
+		return nil, errFakeKV
+	}
+	if !l.kv.revoke(id) {
+		return nil, errFakeLeaseNotFound
+	}
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func (l *fakeLease) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (l *fakeLease) Leases(ctx context.Context) (*clientv3.LeaseLeasesResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (l *fakeLease) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	l.kv.mu.Lock()
+	expired, ok := l.kv.leases[id]
+	l.kv.mu.Unlock()
+	if !ok {
+		return nil, errFakeLeaseNotFound
+	}
+
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(fakeRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case ch <- &clientv3.LeaseKeepAliveResponse{ID: id}:
+			case <-expired:
+				return
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-expired:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (l *fakeLease) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (l *fakeLease) Close() error {
+	return nil
+}
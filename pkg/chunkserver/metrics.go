@@ -0,0 +1,75 @@
+package chunkserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/jiajunhuang/hfs/pkg/files"
+	"github.com/jiajunhuang/hfs/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics of chunkserver, RPCs and etcd calls are counted by interceptors in package metrics
+var (
+	writtenBytes  = metrics.NewCounter("hfs_chunkserver_written_bytes_total", "bytes of chunks written to disks, including replicas from other chunkservers")
+	readBytes     = metrics.NewCounter("hfs_chunkserver_read_bytes_total", "bytes of chunks read by clients")
+	syncQueue     = metrics.NewGauge("hfs_chunkserver_sync_queue", "chunks being replicated to other chunkservers")
+	syncs         = metrics.NewCounterVec("hfs_chunkserver_syncs_total", "replications of chunks to other chunkservers by result", "result")
+	sessionsLost  = metrics.NewCounter("hfs_chunkserver_sessions_lost_total", "leases of session which expired before they're renewed")
+	leaseRenewals = metrics.NewCounter("hfs_chunkserver_lease_renewals_total", "keepalive responses of lease of session")
+	isLeader      = metrics.NewGauge("hfs_chunkserver_leader", "1 if this chunkserver is the leader of cluster, otherwise 0")
+	taskRestarts  = metrics.NewCounterVec("hfs_chunkserver_task_restarts_total", "restarts of background tasks after they fail", "task")
+)
+
+// chunks are counted by listing all of them, so it's done on a slow timer instead of at scrape
+const chunkCountInterval = time.Minute
+
+// descriptions of metrics of disks, they're collected by diskCollector
+var (
+	diskFreeBytes  = prometheus.NewDesc("hfs_chunkserver_disk_free_bytes", "free bytes of data directories", []string{"disk"}, nil)
+	diskTotalBytes = prometheus.NewDesc("hfs_chunkserver_disk_total_bytes", "total bytes of data directories", []string{"disk"}, nil)
+	diskFailed     = prometheus.NewDesc("hfs_chunkserver_disk_failed", "1 if data directory is taken out of service after IO errors", []string{"disk"}, nil)
+	diskChunks     = prometheus.NewDesc("hfs_chunkserver_chunks", "chunks stored in data directories, as of the last count", []string{"disk"}, nil)
+)
+
+// diskCollector collects usage of disks when metrics are scraped
+type diskCollector struct {
+	disks *files.Disks
+}
+
+func (c diskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- diskFreeBytes
+	ch <- diskTotalBytes
+	ch <- diskFailed
+	ch <- diskChunks
+}
+
+func (c diskCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stat := range c.disks.Stats() {
+		failed := 0.0
+		if stat.Failed {
+			failed = 1
+		}
+		ch <- prometheus.MustNewConstMetric(diskFreeBytes, prometheus.GaugeValue, float64(stat.Free), stat.Path)
+		ch <- prometheus.MustNewConstMetric(diskTotalBytes, prometheus.GaugeValue, float64(stat.Total), stat.Path)
+		ch <- prometheus.MustNewConstMetric(diskFailed, prometheus.GaugeValue, failed, stat.Path)
+	}
+	for path, n := range c.disks.Chunks() {
+		ch <- prometheus.MustNewConstMetric(diskChunks, prometheus.GaugeValue, float64(n), path)
+	}
+}
+
+// exposeDisks add metrics of usage of disks, they're collected when metrics are scraped
+func exposeDisks(disks *files.Disks) {
+	metrics.Default.MustRegister(diskCollector{disks})
+}
+
+// ChunkCounter counts chunks in disks every chunkCountInterval for metrics
+func (s *ChunkServer) ChunkCounter(ctx context.Context) error {
+	for {
+		s.disks.CountChunks()
+		if !sleep(ctx, chunkCountInterval) {
+			return nil
+		}
+	}
+}
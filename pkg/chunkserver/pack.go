@@ -0,0 +1,412 @@
+package chunkserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/google/uuid"
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/files"
+	"github.com/jiajunhuang/hfs/pkg/logger"
+	"github.com/jiajunhuang/hfs/pkg/utils"
+)
+
+/*
+small files are appended into a pack chunk shared by them, instead of a padded chunk each.
+
+- a file in pack is recorded at PackBasePath/<pack>/<file> as packEntry
+- a pack is sealed once it's full or PackSealInterval passed, metadata of it is written to
+  PackBasePath/<pack> and ChunkBasePath/<pack>, the latter makes it replicated
+- removing a file only removes it's entry, compaction moves live files of packs which have too
+  much garbage into the open pack, and marks their entries moved. an old pack is removed by a
+  later round once packs it's files are moved into are replicated. it's done by the leader, so
+  that packs whose creators are gone are compacted too
+- packs left open by crash are committed by their creators once they're back
+*/
+
+// errMoveConflict means a file is changed while it's moved out of a pack
+var errMoveConflict = errors.New("file is changed while it's moved")
+
+// packEntry is where a file lives in pack
+type packEntry struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+	// pack the file is moved into by compaction, the entry is kept until that pack is replicated
+	MovedTo string `json:"moved_to,omitempty"`
+}
+
+// pack is the open pack which small files are appended to
+type pack struct {
+	mu       sync.Mutex
+	uuid     string // empty if there's no open pack
+	disk     *files.Disk
+	size     int64
+	openedAt time.Time
+}
+
+// appendPacked append data of file into the open pack, a new pack is opened if there's none or
+// the current one is full
+func (s *ChunkServer) appendPacked(fileUUID string, data []byte) (*pb.Chunk, error) {
+	s.pack.mu.Lock()
+	defer s.pack.mu.Unlock()
+
+	if s.pack.uuid != "" && s.pack.size+int64(len(data)) > int64(config.ChunkSize) {
+		s.sealPack()
+	}
+	if s.pack.uuid == "" {
+		disk, err := s.disks.Pick(int64(config.ChunkSize))
+		if err != nil {
+			return nil, err
+		}
+		s.pack.uuid, s.pack.disk, s.pack.size, s.pack.openedAt = uuid.New().String(), disk, 0, time.Now()
+		logger.Sugar.Infof("pack %s opened", s.pack.uuid)
+	}
+
+	offset, err := s.pack.disk.Store.Append(s.pack.uuid, data)
+	if err != nil {
+		s.disks.Fail(s.pack.disk, err)
+		// files already in it are kept, but nothing will be appended to it
+		s.sealPack()
+		return nil, err
+	}
+	s.disks.Succeed(s.pack.disk)
+	writtenBytes.Add(float64(len(data)))
+	s.pack.size = offset + int64(len(data))
+
+	v, err := utils.ToJSONString(packEntry{Offset: offset, Length: int64(len(data))})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.etcdClient.Put(context.Background(), config.PackBasePath+s.pack.uuid+"/"+fileUUID, v); err != nil {
+		return nil, err
+	}
+
+	return &pb.Chunk{
+		UUID:     s.pack.uuid,
+		Size:     int64(config.ChunkSize),
+		Used:     int64(len(data)),
+		Replicas: []string{s.name},
+		FileUUID: fileUUID,
+		Packed:   true,
+		Offset:   offset,
+	}, nil
+}
+
+// sealPack stop appending to the open pack and commit it, s.pack.mu must be held
+func (s *ChunkServer) sealPack() {
+	if s.pack.uuid == "" {
+		return
+	}
+
+	packUUID, size := s.pack.uuid, s.pack.size
+	s.pack.uuid, s.pack.disk = "", nil
+	s.commitPack(packUUID, size)
+}
+
+// commitPack write metadata of pack, so that it will be replicated and compacted. packs which
+// failed to commit will be committed by compaction later
+func (s *ChunkServer) commitPack(packUUID string, size int64) {
+	v, err := utils.ToJSONString(pb.Chunk{UUID: packUUID, Size: size, Used: size, Replicas: []string{s.name}, Packed: true})
+	if err != nil {
+		logger.Sugar.Errorf("failed to commit pack %s: %s", packUUID, err)
+		return
+	}
+
+	_, err = s.etcdClient.Txn(context.Background()).Then(
+		clientv3.OpPut(config.PackBasePath+packUUID, v),
+		clientv3.OpPut(config.ChunkBasePath+packUUID, v),
+	).Commit()
+	if err != nil {
+		logger.Sugar.Errorf("failed to commit pack %s: %s", packUUID, err)
+		return
+	}
+
+	logger.Sugar.Infof("pack %s sealed with %d bytes", packUUID, size)
+}
+
+// PackSealer seal the open pack if it's not full after PackSealInterval
+func (s *ChunkServer) PackSealer(ctx context.Context) error {
+	for sleep(ctx, config.PackSealInterval/2) {
+		s.pack.mu.Lock()
+		if s.pack.uuid != "" && time.Since(s.pack.openedAt) >= config.PackSealInterval {
+			s.sealPack()
+		}
+		s.pack.mu.Unlock()
+	}
+	return nil
+}
+
+// packInfo is a pack and files in it
+type packInfo struct {
+	chunk   *pb.Chunk            // nil if it's not committed
+	entries map[string]packEntry // file uuid -> entry
+}
+
+func (s *ChunkServer) loadPacks() (map[string]*packInfo, error) {
+	resp, err := s.etcdClient.Get(context.Background(), config.PackBasePath, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	packs := map[string]*packInfo{}
+	for _, kv := range resp.Kvs {
+		parts := strings.SplitN(strings.TrimPrefix(string(kv.Key), config.PackBasePath), "/", 2)
+		info, ok := packs[parts[0]]
+		if !ok {
+			info = &packInfo{entries: map[string]packEntry{}}
+			packs[parts[0]] = info
+		}
+
+		if len(parts) == 1 {
+			info.chunk = &pb.Chunk{}
+			if err := json.Unmarshal(kv.Value, info.chunk); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var entry packEntry
+		if err := json.Unmarshal(kv.Value, &entry); err != nil {
+			return nil, err
+		}
+		info.entries[parts[1]] = entry
+	}
+
+	return packs, nil
+}
+
+// PackRecoverer commit packs left open by crash every CompactInterval
+func (s *ChunkServer) PackRecoverer(ctx context.Context) error {
+	if config.CompactInterval == 0 {
+		return nil
+	}
+
+	for sleep(ctx, config.CompactInterval) {
+		packs, err := s.loadPacks()
+		if err != nil {
+			logger.Sugar.Errorf("failed to load packs: %s", err)
+			continue
+		}
+		for packUUID, info := range packs {
+			if info.chunk == nil {
+				s.recoverPack(packUUID)
+			}
+		}
+	}
+	return nil
+}
+
+// compact packs which have at least CompactGarbage percent of garbage, and remove packs whose
+// files are all moved or removed. it's a task of the leader
+func (s *ChunkServer) compact(ctx context.Context) error {
+	packs, err := s.loadPacks()
+	if err != nil {
+		return err
+	}
+
+	for packUUID, info := range packs {
+		// packs which are not committed are still open, or left open by crash
+		if info.chunk == nil || info.chunk.Used == 0 {
+			continue
+		}
+
+		var live int64
+		files, movedTo := 0, []string{}
+		for _, entry := range info.entries {
+			if entry.MovedTo != "" {
+				movedTo = append(movedTo, entry.MovedTo)
+				continue
+			}
+			files++
+			live += entry.Length
+		}
+
+		if files == 0 {
+			if ok, err := s.replicated(packs, movedTo); err != nil {
+				logger.Sugar.Errorf("failed to check replicas of packs moved from %s: %s", packUUID, err)
+				continue
+			} else if !ok {
+				continue
+			}
+			if err := s.removePack(packUUID, info); err != nil {
+				logger.Sugar.Errorf("failed to remove pack %s: %s", packUUID, err)
+				continue
+			}
+			logger.Sugar.Infof("pack %s removed", packUUID)
+			continue
+		}
+
+		if (info.chunk.Used-live)*100 < int64(config.CompactGarbage)*info.chunk.Used {
+			continue
+		}
+		if err := s.compactPack(ctx, packUUID, info); err != nil {
+			logger.Sugar.Errorf("failed to compact pack %s: %s", packUUID, err)
+			continue
+		}
+		logger.Sugar.Infof("pack %s compacted, %d of %d bytes are moved", packUUID, live, info.chunk.Used)
+	}
+
+	return nil
+}
+
+// replicated returns whether packs have ReplicaNum replicas. packs which are gone are removed
+// by compaction, so files moved into them are dead or replicated elsewhere
+func (s *ChunkServer) replicated(packs map[string]*packInfo, packUUIDs []string) (bool, error) {
+	for _, packUUID := range packUUIDs {
+		info, ok := packs[packUUID]
+		if !ok {
+			continue
+		}
+		if info.chunk == nil {
+			return false, nil // still open
+		}
+
+		chunk, err := utils.GetChunkMeta(s.etcdClient, packUUID)
+		if err != nil {
+			return false, err
+		}
+		if len(chunk.Replicas) < config.ReplicaNum {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// removePack remove pack and all the entries of it
+func (s *ChunkServer) removePack(packUUID string, info *packInfo) error {
+	s.removeChunk(packUUID, info.chunk.Replicas)
+	_, err := s.etcdClient.Txn(context.Background()).Then(
+		clientv3.OpDelete(config.PackBasePath+packUUID),
+		clientv3.OpDelete(config.PackBasePath+packUUID+"/", clientv3.WithPrefix()),
+	).Commit()
+	return err
+}
+
+// recoverPack commit pack which was left open by crash, packs not in this chunkserver are open
+// packs of others
+func (s *ChunkServer) recoverPack(packUUID string) {
+	s.pack.mu.Lock()
+	defer s.pack.mu.Unlock()
+
+	if packUUID == s.pack.uuid {
+		return
+	}
+	disk, err := s.disks.Locate(packUUID)
+	if err != nil {
+		return
+	}
+	info, err := disk.Store.Stat(packUUID)
+	if err != nil {
+		return
+	}
+
+	s.commitPack(packUUID, info.Size)
+}
+
+// compactPack move live files in pack into the open pack. the pack is kept until the open pack
+// is replicated, it's removed by a later round of compaction
+func (s *ChunkServer) compactPack(ctx context.Context, packUUID string, info *packInfo) error {
+	for fileUUID, entry := range info.entries {
+		if entry.MovedTo != "" {
+			continue
+		}
+		if err := retry(retries, func() error { return s.movePacked(ctx, packUUID, fileUUID, entry) }); err != nil {
+			return err
+		}
+	}
+
+	// sealed so that it's replicated
+	s.pack.mu.Lock()
+	s.sealPack()
+	s.pack.mu.Unlock()
+
+	return nil
+}
+
+// readPacked read data of entry in pack, from local disks or from replicas of pack
+func (s *ChunkServer) readPacked(ctx context.Context, packUUID string, entry packEntry) ([]byte, error) {
+	req := &pb.ReadChunkRequest{ChunkUUID: packUUID, Offset: entry.Offset, Length: entry.Length}
+	data, err := s.readLocal(req)
+	if err == ErrFileNotExist {
+		data, err = s.proxyReadChunk(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data.Data)) != entry.Length {
+		return nil, ErrCorrupted
+	}
+	return data.Data, nil
+}
+
+// movePacked copy file in pack to the open pack, point metadata of file to the copy and mark the
+// entry moved. it returns errMoveConflict if the file is changed meanwhile
+func (s *ChunkServer) movePacked(ctx context.Context, packUUID string, fileUUID string, entry packEntry) error {
+	fileKey := config.FileBasePath + fileUUID
+	entryKey := config.PackBasePath + packUUID + "/" + fileUUID
+
+	resp, err := s.etcdClient.Get(context.Background(), fileKey)
+	if err != nil {
+		return err
+	}
+	if resp.Count == 0 {
+		// the file is removed, but it failed to remove the entry
+		_, err := s.etcdClient.Delete(context.Background(), entryKey)
+		return err
+	}
+	var file pb.File
+	if err := json.Unmarshal(resp.Kvs[0].Value, &file); err != nil {
+		return err
+	}
+
+	data, err := s.readPacked(ctx, packUUID, entry)
+	if err != nil {
+		return err
+	}
+	c, err := s.appendPacked(fileUUID, data)
+	if err != nil {
+		return err
+	}
+
+	for i, old := range file.Chunks {
+		if old.UUID == packUUID {
+			c.Codec, c.CompressedSize, c.Used = old.Codec, old.CompressedSize, old.Used
+			file.Chunks[i] = c
+		}
+	}
+	v, err := utils.ToJSONString(file)
+	if err != nil {
+		return err
+	}
+	entry.MovedTo = c.UUID
+	ev, err := utils.ToJSONString(entry)
+	if err != nil {
+		return err
+	}
+
+	// the file may be changed or removed meanwhile
+	txnResp, err := s.etcdClient.Txn(context.Background()).If(
+		clientv3.Compare(clientv3.ModRevision(fileKey), "=", resp.Kvs[0].ModRevision),
+	).Then(
+		clientv3.OpPut(fileKey, v),
+		clientv3.OpPut(entryKey, ev),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		if _, err := s.etcdClient.Delete(context.Background(), config.PackBasePath+c.UUID+"/"+fileUUID); err != nil {
+			return err
+		}
+		return errMoveConflict
+	}
+
+	return nil
+}
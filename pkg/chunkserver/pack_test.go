@@ -0,0 +1,213 @@
+package chunkserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/utils"
+)
+
+// withChunkSize set ChunkSize for a test, it returns a function which restores it
+func withChunkSize(size int) func() {
+	old := config.ChunkSize
+	config.ChunkSize = size
+	return func() { config.ChunkSize = old }
+}
+
+// packFile append data into the open pack of s as a new file, and write metadata of the file
+func packFile(t *testing.T, s *ChunkServer, fileUUID string, data string) *pb.Chunk {
+	c, err := s.appendPacked(fileUUID, []byte(data))
+	if err != nil {
+		t.Fatalf("failed to append %s: %s", fileUUID, err)
+	}
+	v, _ := utils.ToJSONString(pb.File{UUID: fileUUID, Size: c.Used, Chunks: []*pb.Chunk{c}})
+	if _, err := s.etcdClient.Put(context.Background(), config.FileBasePath+fileUUID, v); err != nil {
+		t.Fatalf("failed to put metadata of %s: %s", fileUUID, err)
+	}
+	return c
+}
+
+func TestAppendPacked(t *testing.T) {
+	defer withChunkSize(10)()
+	etcdClient, kv := newFakeEtcd()
+	s, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+
+	a := packFile(t, s, "file-a", "aaaa")
+	b := packFile(t, s, "file-b", "bbb")
+	if a.UUID != b.UUID || a.Offset != 0 || b.Offset != 4 || !b.Packed || b.Used != 3 {
+		t.Fatalf("files should be appended to the same pack but got %+v, %+v", a, b)
+	}
+	var entry packEntry
+	if err := json.Unmarshal(kv.value(config.PackBasePath+b.UUID+"/file-b"), &entry); err != nil || entry != (packEntry{Offset: 4, Length: 3}) {
+		t.Fatalf("bad entry of file-b: %+v, err: %v", entry, err)
+	}
+	if kv.value(config.ChunkBasePath+a.UUID) != nil {
+		t.Fatalf("open pack should not be committed")
+	}
+
+	// the pack is sealed once the next file doesn't fit
+	c := packFile(t, s, "file-c", "cccc")
+	if c.UUID == a.UUID || c.Offset != 0 {
+		t.Fatalf("file-c should be in a new pack but got %+v", c)
+	}
+	var sealed pb.Chunk
+	if err := json.Unmarshal(kv.value(config.ChunkBasePath+a.UUID), &sealed); err != nil || sealed.Used != 7 || !sealed.Packed || sealed.Replicas[0] != "node-1" {
+		t.Fatalf("full pack should be committed but got %+v, err: %v", sealed, err)
+	}
+	if kv.value(config.PackBasePath+a.UUID) == nil {
+		t.Fatalf("metadata of sealed pack should be written")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	defer withChunkSize(100)()
+	defer func(garbage int) { config.CompactGarbage = garbage }(config.CompactGarbage)
+	config.CompactGarbage = 30
+	etcdClient, kv := newFakeEtcd()
+	creator, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	leader, cleanup := newTestServer(t, "node-2", etcdClient)
+	defer cleanup()
+	ctx := context.Background()
+
+	old := packFile(t, creator, "file-a", "aaaa").UUID
+	packFile(t, creator, "file-b", "bbbbbb")
+	packFile(t, creator, "file-c", "cc")
+	packFile(t, creator, "file-d", "dddddddd")
+	creator.pack.mu.Lock()
+	creator.sealPack()
+	creator.pack.mu.Unlock()
+
+	// 2 of 20 bytes are garbage, it's not worth compacting
+	etcdClient.Delete(ctx, config.FileBasePath+"file-c")
+	etcdClient.Delete(ctx, config.PackBasePath+old+"/file-c")
+	if err := leader.compact(ctx); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if kv.value(config.ChunkBasePath+old) == nil {
+		t.Fatalf("pack with little garbage should be kept")
+	}
+
+	// the leader doesn't hold the pack, live files are read from the creator
+	etcdClient.Delete(ctx, config.FileBasePath+"file-b")
+	etcdClient.Delete(ctx, config.PackBasePath+old+"/file-b")
+	if err := leader.compact(ctx); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	var newPack string
+	for fileUUID, data := range map[string]string{"file-a": "aaaa", "file-d": "dddddddd"} {
+		file, err := utils.GetFileMeta(etcdClient, fileUUID)
+		if err != nil {
+			t.Fatalf("failed to get metadata of %s: %s", fileUUID, err)
+		}
+		c := file.Chunks[0]
+		if c.UUID == old || (newPack != "" && c.UUID != newPack) || c.Replicas[0] != "node-2" {
+			t.Fatalf("%s should be moved into the new pack but got %+v", fileUUID, c)
+		}
+		newPack = c.UUID
+
+		got, err := leader.ReadChunk(ctx, &pb.ReadChunkRequest{ChunkUUID: c.UUID, Offset: c.Offset, Length: c.Used})
+		if err != nil || string(got.Data) != data {
+			t.Fatalf("should read %s of %s but got %v, err: %v", data, fileUUID, got, err)
+		}
+	}
+	// dead files are dropped, the new pack only has live data
+	disk, err := leader.disks.Locate(newPack)
+	if err != nil {
+		t.Fatalf("failed to locate new pack: %s", err)
+	}
+	if info, err := disk.Store.Stat(newPack); err != nil || info.Size != 12 {
+		t.Fatalf("new pack should only have 12 bytes of live files but got %+v, err: %v", info, err)
+	}
+
+	// the old pack is kept until the new pack is replicated
+	for i := 0; i < 2; i++ {
+		var entry packEntry
+		if err := json.Unmarshal(kv.value(config.PackBasePath+old+"/file-a"), &entry); err != nil || entry.MovedTo != newPack {
+			t.Fatalf("entry of file-a should be moved to %s but got %+v, err: %v", newPack, entry, err)
+		}
+		if kv.value(config.ChunkBasePath+old) == nil {
+			t.Fatalf("old pack should be kept before the new pack is replicated")
+		}
+		if err := leader.compact(ctx); err != nil {
+			t.Fatalf("failed to compact: %s", err)
+		}
+	}
+
+	chunk, err := utils.GetChunkMeta(etcdClient, newPack)
+	if err != nil {
+		t.Fatalf("failed to get metadata of new pack: %s", err)
+	}
+	chunk.Replicas = []string{"node-2", "node-3", "node-4"}
+	v, _ := utils.ToJSONString(chunk)
+	kv.set(config.ChunkBasePath+newPack, v)
+	if err := leader.compact(ctx); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if kv.value(config.ChunkBasePath+old) != nil || kv.value(config.PackBasePath+old) != nil || kv.value(config.PackBasePath+old+"/file-a") != nil {
+		t.Fatalf("old pack should be removed once the new pack is replicated")
+	}
+	if _, err := creator.disks.Locate(old); err == nil {
+		t.Fatalf("replica of old pack should be removed")
+	}
+}
+
+// txnHook is a clientv3.KV which calls hook before the first transaction
+type txnHook struct {
+	clientv3.KV
+	once sync.Once
+	hook func()
+}
+
+func (h *txnHook) Txn(ctx context.Context) clientv3.Txn {
+	h.once.Do(h.hook)
+	return h.KV.Txn(ctx)
+}
+
+func TestCompactConflict(t *testing.T) {
+	defer withChunkSize(100)()
+	etcdClient, kv := newFakeEtcd()
+	creator, cleanup := newTestServer(t, "node-1", etcdClient)
+	defer cleanup()
+	ctx := context.Background()
+
+	old := packFile(t, creator, "file-a", "aaaa").UUID
+	packFile(t, creator, "file-b", "bbbb")
+	creator.pack.mu.Lock()
+	creator.sealPack()
+	creator.pack.mu.Unlock()
+	etcdClient.Delete(ctx, config.FileBasePath+"file-b")
+	etcdClient.Delete(ctx, config.PackBasePath+old+"/file-b")
+
+	// file-a is renamed while it's moved
+	leader, cleanup := newTestServer(t, "node-2", &clientv3.Client{KV: &txnHook{KV: kv, hook: func() {
+		file, _ := utils.GetFileMeta(etcdClient, "file-a")
+		file.FileName = "renamed"
+		v, _ := utils.ToJSONString(file)
+		kv.set(config.FileBasePath+"file-a", v)
+	}}})
+	defer cleanup()
+	if err := leader.compact(ctx); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	file, err := utils.GetFileMeta(etcdClient, "file-a")
+	if err != nil || file.FileName != "renamed" || file.Chunks[0].UUID == old {
+		t.Fatalf("file-a should be moved with the change kept but got %+v, err: %v", file, err)
+	}
+	var entry packEntry
+	if err := json.Unmarshal(kv.value(config.PackBasePath+file.Chunks[0].UUID+"/file-a"), &entry); err != nil || entry.Offset != file.Chunks[0].Offset {
+		t.Fatalf("entry of file-a should be where it's moved but got %+v, err: %v", entry, err)
+	}
+	if kv.value(config.ChunkBasePath+old) == nil {
+		t.Fatalf("old pack should be kept before the new pack is replicated")
+	}
+}
@@ -0,0 +1,269 @@
+package chunkserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/auth"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/logger"
+	"github.com/jiajunhuang/hfs/pkg/utils"
+	"google.golang.org/grpc/codes"
+)
+
+/*
+quota of a user is stored at QuotaBasePath/<owner>, together with how many bytes and files the
+user owns. usage is updated in the same transaction as metadata of files, so it never drifts
+from the files it counts. files without owner, which are created without authentication, are
+not counted.
+
+quotas are per owner only, there're no quotas per namespace or directory: files of hfs are flat,
+they have no directory or namespace to charge. until they do, a team is limited by uploading as
+a user of it's own and setting quota of that user.
+*/
+
+// how many times a transaction is retried if quota is updated by others meanwhile
+const quotaRetries = 5
+
+// limits returns effective limits of quota, 0 means unlimited
+func limits(q *pb.Quota) (int64, int64) {
+	maxBytes, maxFiles := q.MaxBytes, q.MaxFiles
+	if maxBytes == 0 {
+		maxBytes = int64(config.DefaultQuotaBytes)
+	}
+	if maxFiles == 0 {
+		maxFiles = int64(config.DefaultQuotaFiles)
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	if maxFiles < 0 {
+		maxFiles = 0
+	}
+	return maxBytes, maxFiles
+}
+
+// checkQuota returns ResourceExhausted if owner of q can't own bytes and files more
+func checkQuota(q *pb.Quota, bytes int64, files int64) error {
+	maxBytes, maxFiles := limits(q)
+	if maxBytes > 0 && q.UsedBytes+bytes > maxBytes {
+		return newError(codes.ResourceExhausted, "QuotaExceeded", q.Owner, fmt.Sprintf("quota of %s exceeded: %d bytes used, %d bytes more is over limit %d", q.Owner, q.UsedBytes, bytes, maxBytes))
+	}
+	if maxFiles > 0 && q.UsedFiles+files > maxFiles {
+		return newError(codes.ResourceExhausted, "QuotaExceeded", q.Owner, fmt.Sprintf("quota of %s exceeded: %d files used, limit is %d", q.Owner, q.UsedFiles, maxFiles))
+	}
+	return nil
+}
+
+// loadQuota returns quota of owner and revision of it, so that it can be updated in a
+// transaction. revision is 0 if owner has no quota yet
+func (s *ChunkServer) loadQuota(ctx context.Context, owner string) (*pb.Quota, int64, error) {
+	resp, err := s.etcdClient.Get(ctx, config.QuotaBasePath+owner)
+	if err != nil {
+		logger.Sugar.Errorf("failed to get quota of %s: %s", owner, err)
+		return nil, 0, err
+	}
+
+	q := &pb.Quota{Owner: owner}
+	if len(resp.Kvs) == 0 {
+		return q, 0, nil
+	}
+	if err := json.Unmarshal(resp.Kvs[0].Value, q); err != nil {
+		logger.Sugar.Errorf("failed to load quota of %s: %s", owner, err)
+		return nil, 0, err
+	}
+	return q, resp.Kvs[0].ModRevision, nil
+}
+
+// commitFile write metadata of a new file, and charge owner of it
+func (s *ChunkServer) commitFile(ctx context.Context, file *pb.File) error {
+	filePath := config.FileBasePath + file.UUID
+	v, err := utils.ToJSONString(file)
+	if err != nil {
+		logger.Sugar.Errorf("failed to sync metadata of file %s", file.UUID)
+		return ErrFailedWriteMeta
+	}
+	if file.Owner == "" {
+		if _, err := s.etcdClient.Put(ctx, filePath, v); err != nil {
+			logger.Sugar.Errorf("failed to sync metadata of file %s: %s", file.UUID, err)
+			return ErrFailedWriteMeta
+		}
+		return nil
+	}
+
+	quotaPath := config.QuotaBasePath + file.Owner
+	for i := 0; i < quotaRetries; i++ {
+		q, rev, err := s.loadQuota(ctx, file.Owner)
+		if err != nil {
+			return ErrFailedWriteMeta
+		}
+		if err := checkQuota(q, file.Size, 1); err != nil {
+			return err
+		}
+		q.UsedBytes += file.Size
+		q.UsedFiles++
+		qv, err := utils.ToJSONString(q)
+		if err != nil {
+			return ErrFailedWriteMeta
+		}
+
+		resp, err := s.etcdClient.Txn(ctx).If(
+			clientv3.Compare(clientv3.ModRevision(quotaPath), "=", rev),
+		).Then(
+			clientv3.OpPut(filePath, v),
+			clientv3.OpPut(quotaPath, qv),
+		).Commit()
+		if err != nil {
+			logger.Sugar.Errorf("failed to sync metadata of file %s: %s", file.UUID, err)
+			return ErrFailedWriteMeta
+		} else if resp.Succeeded {
+			return nil
+		}
+	}
+
+	logger.Sugar.Errorf("failed to sync metadata of file %s, quota of %s is too busy", file.UUID, file.Owner)
+	return ErrFailedWriteMeta
+}
+
+// deleteFile remove metadata of file, and refund owner of it
+func (s *ChunkServer) deleteFile(ctx context.Context, fileUUID string) error {
+	filePath := config.FileBasePath + fileUUID
+
+	// metadata of file may be rewritten by compaction meanwhile, so it's reread on conflict
+	for i := 0; i < quotaRetries; i++ {
+		resp, err := s.etcdClient.Get(ctx, filePath)
+		if err != nil {
+			return err
+		} else if len(resp.Kvs) == 0 {
+			return nil
+		}
+		var file pb.File
+		if err := json.Unmarshal(resp.Kvs[0].Value, &file); err != nil {
+			return err
+		}
+		if file.Owner == "" {
+			_, err := s.etcdClient.Delete(ctx, filePath)
+			return err
+		}
+
+		quotaPath := config.QuotaBasePath + file.Owner
+		q, rev, err := s.loadQuota(ctx, file.Owner)
+		if err != nil {
+			return err
+		}
+		// files created before quotas are tracked are not counted
+		if q.UsedBytes -= file.Size; q.UsedBytes < 0 {
+			q.UsedBytes = 0
+		}
+		if q.UsedFiles--; q.UsedFiles < 0 {
+			q.UsedFiles = 0
+		}
+		qv, err := utils.ToJSONString(q)
+		if err != nil {
+			return err
+		}
+
+		txn, err := s.etcdClient.Txn(ctx).If(
+			clientv3.Compare(clientv3.ModRevision(filePath), "=", resp.Kvs[0].ModRevision),
+			clientv3.Compare(clientv3.ModRevision(quotaPath), "=", rev),
+		).Then(
+			clientv3.OpDelete(filePath),
+			clientv3.OpPut(quotaPath, qv),
+		).Commit()
+		if err != nil {
+			return err
+		} else if txn.Succeeded {
+			return nil
+		}
+	}
+
+	return ErrFailedWriteMeta
+}
+
+// discardChunks remove chunks of a file which failed to be created
+func (s *ChunkServer) discardChunks(file *pb.File) {
+	for _, c := range file.Chunks {
+		if c.Packed {
+			if _, err := s.etcdClient.Delete(context.Background(), config.PackBasePath+c.UUID+"/"+file.UUID); err != nil {
+				logger.Sugar.Errorf("failed to delete file %s from pack %s: %s", file.UUID, c.UUID, err)
+			}
+			continue
+		}
+		s.removeChunk(c.UUID, c.Replicas)
+	}
+}
+
+// GetQuota returns quota and usage of a user, limits in it are effective ones, negative is
+// unlimited. users can only see their own quotas, admins can see everyone's
+func (s *ChunkServer) GetQuota(ctx context.Context, req *pb.QuotaRequest) (*pb.Quota, error) {
+	id := auth.FromContext(ctx)
+	owner := req.Owner
+	if owner == "" {
+		owner = id.Name
+	}
+	if owner == "" {
+		return nil, ErrBadRequest
+	}
+	if owner != id.Name && !s.auth.IsAdmin(id) {
+		return nil, auth.ErrPermissionDenied
+	}
+
+	q, _, err := s.loadQuota(ctx, owner)
+	if err != nil {
+		return nil, ErrFailedGetFile
+	}
+	q.MaxBytes, q.MaxFiles = limits(q)
+	if q.MaxBytes == 0 {
+		q.MaxBytes = -1
+	}
+	if q.MaxFiles == 0 {
+		q.MaxFiles = -1
+	}
+	return q, nil
+}
+
+// SetQuota set limits of a user, usage is kept as is. only admins can do it
+func (s *ChunkServer) SetQuota(ctx context.Context, req *pb.Quota) (*pb.GenericResponse, error) {
+	if req.Owner == "" {
+		return nil, ErrBadRequest
+	}
+	if id := auth.FromContext(ctx); !s.auth.IsAdmin(id) {
+		return nil, auth.ErrPermissionDenied
+	}
+
+	quotaPath := config.QuotaBasePath + req.Owner
+	for i := 0; i < quotaRetries; i++ {
+		q, rev, err := s.loadQuota(ctx, req.Owner)
+		if err != nil {
+			return nil, ErrFailedGetFile
+		}
+		if !req.KeepMaxBytes {
+			q.MaxBytes = req.MaxBytes
+		}
+		if !req.KeepMaxFiles {
+			q.MaxFiles = req.MaxFiles
+		}
+		v, err := utils.ToJSONString(q)
+		if err != nil {
+			return nil, ErrFailedWriteMeta
+		}
+
+		resp, err := s.etcdClient.Txn(ctx).If(
+			clientv3.Compare(clientv3.ModRevision(quotaPath), "=", rev),
+		).Then(
+			clientv3.OpPut(quotaPath, v),
+		).Commit()
+		if err != nil {
+			logger.Sugar.Errorf("failed to save quota of %s: %s", req.Owner, err)
+			return nil, ErrFailedWriteMeta
+		} else if resp.Succeeded {
+			logger.Sugar.Infof("quota of %s set to %d bytes and %d files", req.Owner, q.MaxBytes, q.MaxFiles)
+			return &pb.GenericResponse{Code: 0, Msg: "success"}, nil
+		}
+	}
+
+	return nil, ErrFailedWriteMeta
+}
@@ -0,0 +1,197 @@
+package chunkserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/jiajunhuang/hfs/pkg/logger"
+)
+
+/*
+liveness of the chunkserver is a concurrency.Session of etcd, whose lease is kept alive as long
+as the chunkserver is. keys which should go away with the chunkserver are attached to it, like
+the worker key and candidacy of leader election.
+
+a session can't be revived once it's lease expires, e.g. etcd is unreachable for longer than
+WorkerTTL, so a new one is created with backoff, and keys are put again by the callbacks given
+to OnGrant. subsystems which hold keys under the lease watch Done() of the session to know when
+they're gone.
+*/
+
+// error definitions
+var (
+	ErrSessionClosed = errors.New("session is closed")
+)
+
+// Session keeps a concurrency.Session alive in background, and replaces it once it's lost
+type Session struct {
+	client *clientv3.Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	session *concurrency.Session // nil if there's no live session
+	ready   chan struct{}        // closed once a new session is created
+	closed  bool
+	onGrant []func(ctx context.Context, lease clientv3.LeaseID) error
+}
+
+// NewSession returns a session of leases which live for ttl without renewal, it's started by Run
+func NewSession(client *clientv3.Client, ttl time.Duration) *Session {
+	return &Session{client: client, ttl: ttl, ready: make(chan struct{})}
+}
+
+// OnGrant add fn which puts keys under lease of a new session, it's called every time a session
+// is created. it should be called before Run
+func (ss *Session) OnGrant(fn func(ctx context.Context, lease clientv3.LeaseID) error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.onGrant = append(ss.onGrant, fn)
+}
+
+// Current returns the live session, Done() of it is closed once it's lost. it waits until
+// there's one, or ctx is done
+func (ss *Session) Current(ctx context.Context) (*concurrency.Session, error) {
+	for {
+		ss.mu.Lock()
+		session, ready, closed := ss.session, ss.ready, ss.closed
+		ss.mu.Unlock()
+
+		switch {
+		case closed:
+			return nil, ErrSessionClosed
+		case session != nil:
+			return session, nil
+		}
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Run keeps the session alive until ctx is done, a new session is created with backoff whenever
+// the current one is lost
+func (ss *Session) Run(ctx context.Context) error {
+	for failures := 0; ; failures++ {
+		startAt := time.Now()
+		err := ss.keep(ctx)
+		if ctx.Err() != nil || ss.isClosed() {
+			return nil
+		}
+		if time.Since(startAt) > ss.ttl {
+			failures = 0
+		}
+
+		d := backoff(failures)
+		logger.Sugar.Errorf("session is lost, register again in %s: %s", d, err)
+		if !sleep(ctx, d) {
+			return nil
+		}
+	}
+}
+
+// keep create a session, put keys under it's lease, and wait until it's lost
+func (ss *Session) keep(ctx context.Context) error {
+	ss.mu.Lock()
+	onGrant := ss.onGrant
+	ss.mu.Unlock()
+
+	// keepalives are sent by the session, so renewals are counted by the lease it's given
+	client := *ss.client
+	client.Lease = countingLease{ss.client.Lease}
+	session, err := concurrency.NewSession(&client, concurrency.WithTTL(int(ss.ttl/time.Second)), concurrency.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to create session: %s", err)
+	}
+	for _, fn := range onGrant {
+		if err := fn(ctx, session.Lease()); err != nil {
+			ss.revoke(session)
+			return err
+		}
+	}
+
+	ss.mu.Lock()
+	if ss.closed {
+		ss.mu.Unlock()
+		ss.revoke(session)
+		return ErrSessionClosed
+	}
+	ss.session = session
+	close(ss.ready)
+	ss.mu.Unlock()
+	logger.Sugar.Infof("session started with lease %x", session.Lease())
+
+	defer func() {
+		ss.mu.Lock()
+		ss.session, ss.ready = nil, make(chan struct{})
+		ss.mu.Unlock()
+	}()
+
+	// it's done once the lease can't be renewed before it expires
+	<-session.Done()
+	if ctx.Err() == nil && !ss.isClosed() {
+		sessionsLost.Inc()
+	}
+	return fmt.Errorf("lease %x expired", session.Lease())
+}
+
+// Close revoke lease of the session, keys under it are removed at once instead of after ttl, and
+// no session will be created anymore
+func (ss *Session) Close() {
+	ss.mu.Lock()
+	session := ss.session
+	if !ss.closed && session == nil {
+		close(ss.ready) // wake up callers of Current
+	}
+	ss.closed = true
+	ss.mu.Unlock()
+
+	if session != nil {
+		ss.revoke(session)
+	}
+}
+
+func (ss *Session) isClosed() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.closed
+}
+
+func (ss *Session) revoke(session *concurrency.Session) {
+	if err := session.Close(); err != nil {
+		logger.Sugar.Errorf("failed to revoke lease %x, it expires in %s: %s", session.Lease(), ss.ttl, err)
+	}
+}
+
+// countingLease counts renewals of leases kept alive by it in leaseRenewals
+type countingLease struct {
+	clientv3.Lease
+}
+
+func (l countingLease) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch, err := l.Lease.KeepAlive(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	counted := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		defer close(counted)
+		for resp := range ch {
+			leaseRenewals.Inc()
+			select {
+			case counted <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return counted, nil
+}
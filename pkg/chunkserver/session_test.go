@@ -0,0 +1,106 @@
+package chunkserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// renewals returns how many leases are renewed by sessions so far
+func renewals() float64 {
+	var m dto.Metric
+	leaseRenewals.Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func TestSession(t *testing.T) {
+	etcdClient, kv := newFakeEtcd()
+	grants := func() int {
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+		return kv.grants
+	}
+	ss := NewSession(etcdClient, time.Second)
+	ss.OnGrant(func(ctx context.Context, lease clientv3.LeaseID) error {
+		_, err := etcdClient.Put(ctx, "/key", "value", clientv3.WithLease(lease))
+		return err
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		ss.Run(ctx)
+		close(stopped)
+	}()
+
+	session, err := ss.Current(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %s", err)
+	}
+	if kv.value("/key") == nil {
+		t.Fatalf("key should be put under lease of session")
+	}
+
+	// the lease is renewed instead of granting new ones
+	before := renewals()
+	time.Sleep(10 * fakeRenewInterval)
+	if n := renewals() - before; n < 5 {
+		t.Fatalf("renewals of lease should be counted but got %v", n)
+	}
+	if grants() != 1 || kv.liveLeases() != 1 {
+		t.Fatalf("only 1 lease should be granted but got %d, %d are live", grants(), kv.liveLeases())
+	}
+	select {
+	case <-session.Done():
+		t.Fatalf("session should be kept alive")
+	default:
+	}
+
+	// etcd is unreachable until the lease expires, it's registered again with backoff once it's back
+	kv.mu.Lock()
+	kv.fail = true
+	kv.mu.Unlock()
+	kv.expire(session.Lease())
+	<-session.Done()
+	if kv.value("/key") != nil {
+		t.Fatalf("key should be gone with the lease")
+	}
+	time.Sleep(4 * minBackoff)
+	kv.mu.Lock()
+	n := kv.grants
+	kv.fail = false
+	kv.mu.Unlock()
+	// after 0, minBackoff and 3*minBackoff
+	if n < 2 || n > 4 {
+		t.Fatalf("session should be created again with backoff but got %d grants", n)
+	}
+
+	renewed, err := ss.Current(ctx)
+	for err == nil && renewed == session {
+		time.Sleep(10 * time.Millisecond)
+		renewed, err = ss.Current(ctx)
+	}
+	if err != nil || renewed.Lease() == session.Lease() {
+		t.Fatalf("a new session should be created but got %v, err: %v", renewed, err)
+	}
+	if kv.value("/key") == nil {
+		t.Fatalf("key should be put again under the new lease")
+	}
+
+	// close revokes the lease at once
+	ss.Close()
+	if kv.value("/key") != nil || kv.liveLeases() != 0 {
+		t.Fatalf("key should be gone once session is closed")
+	}
+	if _, err := ss.Current(ctx); err != ErrSessionClosed {
+		t.Fatalf("closed session should not be current but got %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Run should return once session is closed")
+	}
+}
@@ -0,0 +1,120 @@
+package chunkserver
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/jiajunhuang/hfs/pkg/logger"
+)
+
+/*
+nothing but broken configurations at startup should take the chunkserver down, a bad peer or an
+etcd hiccup fails the request or the background task it happens in, and the task is retried or
+restarted with backoff.
+*/
+
+// bounds of delay between retries, it doubles every time
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// how many times a failed step of request or background task is retried
+const retries = 5
+
+// backoff returns how long to wait before the n-th retry, counts from 0
+func backoff(n int) time.Duration {
+	d := minBackoff
+	for i := 0; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// recovered calls fn, panic of it is logged with stack, and returned as error
+func recovered(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Sugar.Errorf("recovered from panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// retry calls fn until it succeeds, or fails attempts times. the last error is returned
+func retry(attempts int, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff(i - 1))
+		}
+		if err = recovered(fn); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// sleep waits for d, it returns false if ctx is done meanwhile
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// supervise runs background task fn until ctx is done, and restarts it with backoff if it panics
+// or fails. it's done once fn returns nil. backoff is reset if fn has run for a while before it
+// fails
+func (s *ChunkServer) supervise(ctx context.Context, name string, fn func(context.Context) error) {
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+
+		for n := 0; ; n++ {
+			startAt := time.Now()
+			err := recovered(func() error { return fn(ctx) })
+			if err == nil || ctx.Err() != nil {
+				logger.Sugar.Infof("background task %s is done", name)
+				return
+			}
+			if time.Since(startAt) > maxBackoff {
+				n = 0
+			}
+
+			d := backoff(n)
+			logger.Sugar.Errorf("background task %s failed, restart it in %s: %s", name, d, err)
+			taskRestarts.WithLabelValues(name).Inc()
+			if !sleep(ctx, d) {
+				return
+			}
+		}
+	}()
+}
+
+// waitTasks waits for background tasks to finish, it returns false on timeout
+func (s *ChunkServer) waitTasks(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.tasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
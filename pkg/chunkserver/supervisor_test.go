@@ -0,0 +1,137 @@
+package chunkserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errTask = errors.New("task failed")
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{0, minBackoff},
+		{1, 2 * minBackoff},
+		{3, 8 * minBackoff},
+		{8, 256 * minBackoff},
+		{9, maxBackoff},  // 51.2s is capped
+		{64, maxBackoff}, // doesn't overflow
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.n); got != tt.want {
+			t.Errorf("backoff(%d) should be %s but got %s", tt.n, tt.want, got)
+		}
+	}
+}
+
+func TestRecovered(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func() error
+		want string // substring of error, empty if it succeeds
+	}{
+		{"succeed", func() error { return nil }, ""},
+		{"fail", func() error { return errTask }, errTask.Error()},
+		{"panic", func() error { panic("boom") }, "panic: boom"},
+		{"nil map", func() error {
+			var m map[string]int
+			m["a"] = 1
+			return nil
+		}, "panic: assignment to entry in nil map"},
+	}
+	for _, tt := range tests {
+		err := recovered(tt.fn)
+		if tt.want == "" && err != nil {
+			t.Errorf("%s: should succeed but got %s", tt.name, err)
+		} else if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: error should contain %q but got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		failures int // how many calls fail before it succeeds
+		panics   bool
+		calls    int
+		fails    bool
+	}{
+		{"succeed at once", 3, 0, false, 1, false},
+		{"succeed at the last attempt", 3, 2, false, 3, false},
+		{"fail all the attempts", 3, 5, false, 3, true},
+		{"recover from panic", 3, 1, true, 2, false},
+		{"panic every time", 2, 5, true, 2, true},
+	}
+	for _, tt := range tests {
+		calls := 0
+		err := retry(tt.attempts, func() error {
+			calls++
+			if calls <= tt.failures {
+				if tt.panics {
+					panic("boom")
+				}
+				return errTask
+			}
+			return nil
+		})
+		if calls != tt.calls || (err != nil) != tt.fails {
+			t.Errorf("%s: should be called %d times and fail: %v, but got %d times and %v", tt.name, tt.calls, tt.fails, calls, err)
+		}
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(ctx context.Context, runs int32) error
+		runs int32 // how many times fn runs at least
+		once bool  // fn isn't restarted
+	}{
+		{"done", func(ctx context.Context, runs int32) error { return nil }, 1, true},
+		{"restart after failure", func(ctx context.Context, runs int32) error {
+			if runs < 2 {
+				return errTask
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}, 2, false},
+		{"restart after panic", func(ctx context.Context, runs int32) error {
+			if runs < 2 {
+				panic("boom")
+			}
+			<-ctx.Done()
+			return nil
+		}, 2, false},
+		{"stop in backoff", func(ctx context.Context, runs int32) error { return errTask }, 3, false},
+		{"stop while running", func(ctx context.Context, runs int32) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, 1, true},
+	}
+	for _, tt := range tests {
+		s := &ChunkServer{}
+		ctx, cancel := context.WithCancel(context.Background())
+		var runs int32
+		s.supervise(ctx, tt.name, func(ctx context.Context) error {
+			return tt.fn(ctx, atomic.AddInt32(&runs, 1))
+		})
+
+		// the first restart is after minBackoff, the second one is after 2*minBackoff
+		time.Sleep(4 * minBackoff)
+		cancel()
+		if !s.waitTasks(time.Second) {
+			t.Fatalf("%s: task should stop once ctx is canceled", tt.name)
+		}
+		if n := atomic.LoadInt32(&runs); n < tt.runs || (tt.once && n != 1) {
+			t.Errorf("%s: task should run %d times but got %d", tt.name, tt.runs, n)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+)
+
+/*
+package codec provide compression codecs of chunks.
+*/
+
+// codecs
+const (
+	None   = ""       // not compressed
+	Snappy = "snappy" // fast, for data which is read frequently
+	LZ4    = "lz4"    // fast like snappy, and decompresses faster
+	Zstd   = "zstd"   // compresses close to flate, at speed close to snappy
+	Flate  = "flate"  // slower but compresses better, for logs and archives
+)
+
+// zstd encoder and decoder are safe for concurrent EncodeAll and DecodeAll, they're shared
+// because creating them is expensive
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compressed data is kept only if it saves at least 1/minSaving of space
+const minSaving = 8
+
+// error definitions
+var (
+	ErrUnknownCodec = errors.New("unknown compression codec")
+	ErrBadSize      = errors.New("size of decompressed data mismatch")
+)
+
+// Valid returns whether codec is supported
+func Valid(codec string) bool {
+	switch codec {
+	case None, Snappy, LZ4, Zstd, Flate:
+		return true
+	}
+	return false
+}
+
+// Compress compress data with codec. it returns codec None and data itself if data is
+// incompressible, so that reading it doesn't pay for decompression
+func Compress(codec string, data []byte) (string, []byte, error) {
+	var compressed []byte
+	switch codec {
+	case None:
+		return None, data, nil
+	case Snappy:
+		compressed = snappy.Encode(nil, data)
+	case LZ4:
+		compressed = make([]byte, lz4.CompressBlockBound(len(data)))
+		n, err := lz4.CompressBlock(data, compressed, make([]int, 1<<16))
+		if err != nil {
+			return "", nil, err
+		}
+		if n == 0 { // incompressible
+			return None, data, nil
+		}
+		compressed = compressed[:n]
+	case Zstd:
+		compressed = zstdEncoder.EncodeAll(data, nil)
+	case Flate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return "", nil, err
+		}
+		if err := w.Close(); err != nil {
+			return "", nil, err
+		}
+		compressed = buf.Bytes()
+	default:
+		return "", nil, fmt.Errorf("%s: %s", ErrUnknownCodec, codec)
+	}
+
+	if len(compressed) > len(data)-len(data)/minSaving {
+		return None, data, nil
+	}
+	return codec, compressed, nil
+}
+
+// Decompress decompress data which is compressed by codec, size is length of the original data
+func Decompress(codec string, data []byte, size int64) ([]byte, error) {
+	var decompressed []byte
+	switch codec {
+	case None:
+		return data, nil
+	case Snappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if int64(n) != size {
+			return nil, ErrBadSize
+		}
+		if decompressed, err = snappy.Decode(nil, data); err != nil {
+			return nil, err
+		}
+	case LZ4:
+		// lz4 blocks don't record their length, one more byte is kept to find out longer data
+		decompressed = make([]byte, size+1)
+		n, err := lz4.UncompressBlock(data, decompressed)
+		if err != nil {
+			return nil, err
+		}
+		decompressed = decompressed[:n]
+	case Zstd:
+		var err error
+		if decompressed, err = zstdDecoder.DecodeAll(data, make([]byte, 0, size)); err != nil {
+			return nil, err
+		}
+	case Flate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		// one more byte is read to find out longer data
+		decompressed = make([]byte, size+1)
+		n, err := io.ReadFull(r, decompressed)
+		if err != io.ErrUnexpectedEOF && err != io.EOF && err != nil {
+			return nil, err
+		}
+		decompressed = decompressed[:n]
+	default:
+		return nil, fmt.Errorf("%s: %s", ErrUnknownCodec, codec)
+	}
+
+	if int64(len(decompressed)) != size {
+		return nil, ErrBadSize
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	text := bytes.Repeat([]byte(`{"level":"info","msg":"chunk has been created"}`+"\n"), 1000)
+	random := make([]byte, 4096)
+	rand.Read(random)
+
+	for _, codec := range []string{None, Snappy, LZ4, Zstd, Flate} {
+		used, compressed, err := Compress(codec, text)
+		if err != nil {
+			t.Fatalf("failed to compress with %s: %s", codec, err)
+		}
+		if used != codec {
+			t.Fatalf("text should be compressed with %s but got %s", codec, used)
+		}
+		if codec != None && len(compressed) >= len(text)/10 {
+			t.Fatalf("text should compress 10x with %s but got %d bytes", codec, len(compressed))
+		}
+
+		data, err := Decompress(used, compressed, int64(len(text)))
+		if err != nil || !bytes.Equal(data, text) {
+			t.Fatalf("failed to decompress with %s: %v", codec, err)
+		}
+		if _, err := Decompress(used, compressed, int64(len(text)-1)); codec != None && err != ErrBadSize {
+			t.Fatalf("wrong size should be detected with %s but got %v", codec, err)
+		}
+
+		// incompressible data is stored as it is
+		used, compressed, err = Compress(codec, random)
+		if err != nil || used != None || !bytes.Equal(compressed, random) {
+			t.Fatalf("random data should not be compressed with %s but got %s, err: %v", codec, used, err)
+		}
+	}
+
+	if _, _, err := Compress("zip", text); err == nil {
+		t.Fatalf("unknown codec should be rejected")
+	}
+	if Valid("zip") || !Valid(Snappy) || !Valid(LZ4) || !Valid(Zstd) {
+		t.Fatalf("wrong validation of codecs")
+	}
+}
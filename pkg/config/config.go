@@ -1,9 +1,17 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	cli "gopkg.in/urfave/cli.v1"
 )
 
 // configurations
@@ -14,40 +22,455 @@ var (
 	ChunkSize       = 1024 * 1024 * 64 // 64M
 	GRPCMaxMsgSize  = ChunkSize + 4096 // 64M + 4K
 
-	EtcdEndpoints = []string{"127.0.0.1:2379"}
+	EtcdEndpoints   = []string{"127.0.0.1:2379"}
+	EtcdDialTimeout = 2 * time.Second
+
+	MetricsAddr = "" // address /metrics of Prometheus is served at, empty to disable
+
+	TLS           = false // use TLS for gRPC traffic between clients and chunkservers, and among chunkservers
+	TLSCert       = ""    // certificate presented by chunkservers, and by clients for mutual TLS
+	TLSKey        = ""    // private key of TLSCert
+	TLSCA         = ""    // CA to verify certificates of the other side, default to system CAs
+	TLSClientAuth = false // chunkservers require certificates of clients signed by TLSCA
+	TLSServerName = ""    // name in certificates of chunkservers, default to host in their addresses
+	EtcdTLS       = false // use TLS for traffic to etcd
+	EtcdTLSCert   = ""    // client certificate presented to etcd
+	EtcdTLSKey    = ""    // private key of EtcdTLSCert
+	EtcdTLSCA     = ""    // CA to verify certificates of etcd, default to system CAs
+
+	Auth          = false      // require callers to be authenticated, and check permissions of files
+	TokensFile    = ""         // TOML file which maps names of users to their tokens
+	PeerTokenFile = ""         // file of token chunkservers present to each other
+	PeerNames     = []string{} // subjects of certificates of chunkservers under mutual TLS
+	Admins        = []string{} // users who have all permissions of all files
+
+	DataDirs   = []string{"/hfs/chunks/"} // directories to store chunks, one per disk
+	Durability = "full"                   // how hard chunk writes try to survive power loss: none, data or full
+	ChunkStore = "flat"                   // how chunks are stored in DataDirs: flat, hashed, segment or memory
+	Fallocate  = true                     // preallocate space of chunks before writing them
+	DirectIO   = false                    // write chunks with O_DIRECT, bypassing page cache
+
+	DiskKeyFile     = ""               // encrypt chunks at rest with key in it, empty to disable
+	OldDiskKeyFiles = []string{}       // retired keys, chunks encrypted by them are re-encrypted by DiskKeyFile
+	RekeyInterval   = 10 * time.Minute // how often chunks encrypted by old keys are re-encrypted
+
+	ClusterName    = "hfs"            // metadata of cluster is stored under /<ClusterName>/ in etcd
+	FileBasePath   = "/hfs/files/"    // default to /<ClusterName>/files/
+	ChunkBasePath  = "/hfs/chunks/"   // default to /<ClusterName>/chunks/
+	WorkerBasePath = "/hfs/workers/"  // default to /<ClusterName>/workers/
+	PackBasePath   = "/hfs/packs/"    // default to /<ClusterName>/packs/
+	QuotaBasePath  = "/hfs/quotas/"   // default to /<ClusterName>/quotas/
+	LeaderBasePath = "/hfs/leader/"   // default to /<ClusterName>/leader/
+	RepairInterval = 10 * time.Minute // how often the leader replicates chunks which lost replicas, 0 to disable
+
+	DefaultQuotaBytes = 0 // how many bytes of files a user can own if no quota is set for the user, 0 is unlimited
+	DefaultQuotaFiles = 0 // how many files a user can own if no quota is set for the user, 0 is unlimited
+
+	ReplicaNum      = 3
+	WorkerTTL       = 10 * time.Second // chunkserver is considered dead if it doesn't refresh itself in WorkerTTL
+	ShutdownTimeout = 30 * time.Second // how long in-flight requests are waited for at shutdown
+	RPCTimeout      = time.Minute      // timeout of unary RPC made by client
+	KeyFile         = ""               // master key of client side encryption, HFS_KEY in environment is used if it's empty
+	TokenFile       = ""               // token presented by client, HFS_TOKEN in environment is used if it's empty
+
+	PackThreshold    = 1024 * 1024      // files smaller than it are packed into shared chunks, 0 to disable
+	PackSealInterval = time.Minute      // a pack is sealed and replicated if it's not full after it
+	CompactInterval  = 10 * time.Minute // how often packs and segments are compacted, 0 to disable
+	CompactGarbage   = 50               // a pack or segment is compacted once so many percent of it is deleted
+)
 
-	FileBasePath   = "/hfs/files/"
-	ChunkBasePath  = "/hfs/chunks/"
-	WorkerBasePath = "/hfs/workers/"
+// ClusterMetadataKey is the gRPC metadata which carries name of cluster a request is for
+const ClusterMetadataKey = "hfs-cluster"
 
-	ReplicaNum = 3
+// error definitions
+var (
+	ErrUnknownKey = errors.New("unknown configuration")
 )
 
-// Config contains configurations, it will read from process environment, rewrite it with
-// values in process environment
+// setting describe a configuration, name is the key in config file and environment
+type setting struct {
+	name  string
+	flag  string
+	value interface{} // pointer to the variable
+	usage string
+}
+
+var settings = []setting{
+	{"GRPCAddr", "grpc-addr", &GRPCAddr, "address gRPC server listens at"},
+	{"ChunkServerName", "name", &ChunkServerName, "name of chunkserver, must be unique in cluster"},
+	{"ChunkServerAddr", "addr", &ChunkServerAddr, "address of chunkserver which can be reached by others"},
+	{"ChunkSize", "chunk-size", &ChunkSize, "size of chunk in bytes"},
+	{"GRPCMaxMsgSize", "grpc-max-msg-size", &GRPCMaxMsgSize, "max size of gRPC message in bytes, default to ChunkSize + 4096"},
+	{"EtcdEndpoints", "etcd-endpoints", &EtcdEndpoints, "comma separated endpoints of etcd"},
+	{"EtcdDialTimeout", "etcd-dial-timeout", &EtcdDialTimeout, "timeout of connecting to etcd"},
+	{"MetricsAddr", "metrics-addr", &MetricsAddr, "address to serve metrics of Prometheus at /metrics, empty to disable"},
+	{"TLS", "tls", &TLS, "use TLS for gRPC traffic between clients and chunkservers, and among chunkservers, true or false"},
+	{"TLSCert", "tls-cert", &TLSCert, "PEM certificate presented by chunkservers, and by clients for mutual TLS"},
+	{"TLSKey", "tls-key", &TLSKey, "PEM private key of TLSCert"},
+	{"TLSCA", "tls-ca", &TLSCA, "PEM CA to verify certificates of the other side, default to system CAs"},
+	{"TLSClientAuth", "tls-client-auth", &TLSClientAuth, "chunkservers require certificates of clients signed by TLSCA, true or false"},
+	{"TLSServerName", "tls-server-name", &TLSServerName, "name in certificates of chunkservers, default to host in their addresses"},
+	{"EtcdTLS", "etcd-tls", &EtcdTLS, "use TLS for traffic to etcd, true or false"},
+	{"EtcdTLSCert", "etcd-tls-cert", &EtcdTLSCert, "PEM client certificate presented to etcd"},
+	{"EtcdTLSKey", "etcd-tls-key", &EtcdTLSKey, "PEM private key of EtcdTLSCert"},
+	{"EtcdTLSCA", "etcd-tls-ca", &EtcdTLSCA, "PEM CA to verify certificates of etcd, default to system CAs"},
+	{"Auth", "auth", &Auth, "require callers to be authenticated, and check permissions of files, true or false"},
+	{"TokensFile", "tokens-file", &TokensFile, "TOML file which maps names of users to their tokens, like alice = \"secret\""},
+	{"PeerTokenFile", "peer-token-file", &PeerTokenFile, "file of token chunkservers present to each other, callers with it are cluster members"},
+	{"PeerNames", "peer-names", &PeerNames, "comma separated subjects of certificates of chunkservers, they're cluster members under mutual TLS"},
+	{"Admins", "admins", &Admins, "comma separated users who have all permissions of all files"},
+	{"DataDirs", "data-dirs", &DataDirs, "comma separated directories to store chunks, one per disk"},
+	{"Durability", "durability", &Durability, "none: leave chunks in page cache, data: fsync chunks, full: fsync chunks and directories"},
+	{"ChunkStore", "chunk-store", &ChunkStore, "flat: a file per chunk, hashed: a file per chunk in subdirectories, segment: pack chunks into segments, memory: for tests"},
+	{"Fallocate", "fallocate", &Fallocate, "preallocate space of chunks before writing them, true or false"},
+	{"DirectIO", "direct-io", &DirectIO, "write chunks with O_DIRECT, bypassing page cache, true or false"},
+	{"DiskKeyFile", "disk-key-file", &DiskKeyFile, "encrypt chunks at rest with key in it, 32 bytes or 64 hex characters, empty to disable"},
+	{"OldDiskKeyFiles", "old-disk-key-files", &OldDiskKeyFiles, "comma separated files of retired keys, chunks encrypted by them are re-encrypted by DiskKeyFile"},
+	{"RekeyInterval", "rekey-interval", &RekeyInterval, "how often chunks encrypted by old keys or plaintext are re-encrypted"},
+	{"ClusterName", "cluster", &ClusterName, "name of cluster to join or talk to, prefix of all the metadata in etcd"},
+	{"FileBasePath", "file-base-path", &FileBasePath, "prefix of metadata of files in etcd, default to /<ClusterName>/files/"},
+	{"ChunkBasePath", "chunk-base-path", &ChunkBasePath, "prefix of metadata of chunks in etcd, default to /<ClusterName>/chunks/"},
+	{"WorkerBasePath", "worker-base-path", &WorkerBasePath, "prefix of chunkservers in etcd, default to /<ClusterName>/workers/"},
+	{"PackBasePath", "pack-base-path", &PackBasePath, "prefix of metadata of packs in etcd, default to /<ClusterName>/packs/"},
+	{"QuotaBasePath", "quota-base-path", &QuotaBasePath, "prefix of quotas and usage of users in etcd, default to /<ClusterName>/quotas/"},
+	{"LeaderBasePath", "leader-base-path", &LeaderBasePath, "prefix of candidates of leader election in etcd, default to /<ClusterName>/leader/"},
+	{"RepairInterval", "repair-interval", &RepairInterval, "how often the leader replicates chunks which have fewer live replicas than they should, 0 to disable"},
+	{"DefaultQuotaBytes", "default-quota-bytes", &DefaultQuotaBytes, "how many bytes of files a user can own if there's no quota set for the user, 0 is unlimited"},
+	{"DefaultQuotaFiles", "default-quota-files", &DefaultQuotaFiles, "how many files a user can own if there's no quota set for the user, 0 is unlimited"},
+	{"ReplicaNum", "replica-num", &ReplicaNum, "how many replicas does a new file have"},
+	{"WorkerTTL", "worker-ttl", &WorkerTTL, "chunkserver is considered dead if it doesn't refresh itself in it"},
+	{"ShutdownTimeout", "shutdown-timeout", &ShutdownTimeout, "how long chunkserver waits for in-flight requests on SIGTERM before it cancels them"},
+	{"RPCTimeout", "rpc-timeout", &RPCTimeout, "timeout of unary RPC made by client"},
+	{"KeyFile", "key-file", &KeyFile, "file of master key which encrypts files in client, 32 bytes or 64 hex characters. HFS_KEY in environment is used if it's empty"},
+	{"TokenFile", "token-file", &TokenFile, "file of token which identifies client to chunkservers. HFS_TOKEN in environment is used if it's empty"},
+	{"PackThreshold", "pack-threshold", &PackThreshold, "files smaller than it in bytes are packed into shared chunks, 0 to disable"},
+	{"PackSealInterval", "pack-seal-interval", &PackSealInterval, "a pack is sealed and replicated if it's not full after it"},
+	{"CompactInterval", "compact-interval", &CompactInterval, "how often packs and segments are compacted, 0 to disable"},
+	{"CompactGarbage", "compact-garbage", &CompactGarbage, "a pack or segment is compacted once so many percent of it is deleted"},
+}
+
+// names of settings which are set explicitly
+var explicit = map[string]bool{}
+
+// error of parsing environment in init
+var envErr error
+
+// configurations are overridden by, from low to high priority: config file, process environment,
+// command line flags. process environment is loaded at init so that library users get it
+// without calling Setup.
 func init() {
-	if v := os.Getenv("GRPCAddr"); v != "" {
-		GRPCAddr = v
+	envErr = LoadEnv()
+	derive()
+}
+
+// derive set configurations which depend on others, if they're not set explicitly
+func derive() {
+	if !explicit["GRPCMaxMsgSize"] {
+		GRPCMaxMsgSize = ChunkSize + 4096
+	}
+	if !explicit["FileBasePath"] {
+		FileBasePath = "/" + ClusterName + "/files/"
+	}
+	if !explicit["ChunkBasePath"] {
+		ChunkBasePath = "/" + ClusterName + "/chunks/"
+	}
+	if !explicit["WorkerBasePath"] {
+		WorkerBasePath = "/" + ClusterName + "/workers/"
+	}
+	if !explicit["PackBasePath"] {
+		PackBasePath = "/" + ClusterName + "/packs/"
+	}
+	if !explicit["QuotaBasePath"] {
+		QuotaBasePath = "/" + ClusterName + "/quotas/"
+	}
+	if !explicit["LeaderBasePath"] {
+		LeaderBasePath = "/" + ClusterName + "/leader/"
+	}
+}
+
+// Namespace is where metadata of a cluster lives in etcd, clusters sharing one etcd never
+// see keys of each other
+type Namespace struct {
+	Cluster        string
+	FileBasePath   string
+	ChunkBasePath  string
+	WorkerBasePath string
+	PackBasePath   string
+	QuotaBasePath  string
+	LeaderBasePath string
+}
+
+// NamespaceOf returns namespace of cluster, prefixes configured explicitly are used if
+// cluster is ClusterName
+func NamespaceOf(cluster string) Namespace {
+	if cluster == ClusterName {
+		return Namespace{cluster, FileBasePath, ChunkBasePath, WorkerBasePath, PackBasePath, QuotaBasePath, LeaderBasePath}
+	}
+
+	prefix := "/" + cluster + "/"
+	return Namespace{cluster, prefix + "files/", prefix + "chunks/", prefix + "workers/", prefix + "packs/", prefix + "quotas/", prefix + "leader/"}
+}
+
+func find(name string) (*setting, error) {
+	for i := range settings {
+		if settings[i].name == name {
+			return &settings[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: %s", ErrUnknownKey, name)
+}
+
+// set parse raw and assign it to the setting, setting is kept as is if raw is bad
+func (s *setting) set(raw interface{}) error {
+	var err error
+
+	switch v := s.value.(type) {
+	case *string:
+		*v = fmt.Sprint(raw)
+	case *int:
+		switch r := raw.(type) {
+		case int64:
+			*v = int(r)
+		case string:
+			var i int
+			if i, err = strconv.Atoi(r); err == nil {
+				*v = i
+			}
+		default:
+			err = fmt.Errorf("should be an integer but got %v", raw)
+		}
+	case *bool:
+		switch r := raw.(type) {
+		case bool:
+			*v = r
+		case string:
+			var b bool
+			if b, err = strconv.ParseBool(r); err == nil {
+				*v = b
+			}
+		default:
+			err = fmt.Errorf("should be a boolean but got %v", raw)
+		}
+	case *time.Duration:
+		var d time.Duration
+		if d, err = time.ParseDuration(fmt.Sprint(raw)); err == nil {
+			*v = d
+		}
+	case *[]string:
+		switch r := raw.(type) {
+		case string:
+			*v = strings.Split(r, ",")
+		case []interface{}:
+			*v = make([]string, 0, len(r))
+			for _, i := range r {
+				*v = append(*v, fmt.Sprint(i))
+			}
+		default:
+			err = fmt.Errorf("should be a list but got %v", raw)
+		}
 	}
-	if v := os.Getenv("ChunkServerName"); v != "" {
-		ChunkServerName = v
+
+	if err != nil {
+		return fmt.Errorf("bad configuration %s: %s", s.name, err)
 	}
-	if v := os.Getenv("ChunkServerAddr"); v != "" {
-		ChunkServerAddr = v
+	explicit[s.name] = true
+	return nil
+}
+
+func (s *setting) String() string {
+	switch v := s.value.(type) {
+	case *[]string:
+		return strings.Join(*v, ",")
+	case *time.Duration:
+		return v.String()
+	case *string:
+		return *v
+	case *int:
+		return strconv.Itoa(*v)
+	case *bool:
+		return strconv.FormatBool(*v)
 	}
-	if v := os.Getenv("EtcdEndpoints"); v != "" {
-		EtcdEndpoints = strings.Split(v, ",")
+
+	return ""
+}
+
+// LoadFile load configurations in TOML file at path
+func LoadFile(path string) error {
+	values := map[string]interface{}{}
+	if _, err := toml.DecodeFile(path, &values); err != nil {
+		return fmt.Errorf("failed to load config file %s: %s", path, err)
 	}
-	if v := os.Getenv("FileBasePath"); v != "" {
-		FileBasePath = v
+
+	for name, raw := range values {
+		s, err := find(name)
+		if err != nil {
+			return err
+		}
+		if err := s.set(raw); err != nil {
+			return err
+		}
 	}
-	if v := os.Getenv("ChunkBasePath"); v != "" {
-		ChunkBasePath = v
+
+	return nil
+}
+
+// LoadEnv load configurations in process environment
+func LoadEnv() error {
+	for i := range settings {
+		if v := os.Getenv(settings[i].name); v != "" {
+			if err := settings[i].set(v); err != nil {
+				return err
+			}
+		}
 	}
-	if v := os.Getenv("WorkerBasePath"); v != "" {
-		WorkerBasePath = v
+
+	return nil
+}
+
+// Flags returns command line flags of all the configurations, plus `--config`
+func Flags() []cli.Flag {
+	flags := []cli.Flag{cli.StringFlag{Name: "config, c", Usage: "load configurations from TOML file at `PATH`"}}
+	for _, s := range settings {
+		flags = append(flags, cli.StringFlag{Name: s.flag, Usage: fmt.Sprintf("%s (default: %s)", s.usage, s.String())})
 	}
-	if v := os.Getenv("ReplicaNum"); v != "" {
-		ReplicaNum, _ = strconv.Atoi(v)
+
+	return flags
+}
+
+// LoadFlags load configurations which are given in command line
+func LoadFlags(c *cli.Context) error {
+	for i := range settings {
+		if c.GlobalIsSet(settings[i].flag) {
+			if err := settings[i].set(c.GlobalString(settings[i].flag)); err != nil {
+				return err
+			}
+		}
 	}
+
+	return nil
+}
+
+// Setup load configurations from config file, process environment and command line flags in order,
+// and validate them. c should be the context of an app which has Flags()
+func Setup(c *cli.Context) error {
+	if path := c.GlobalString("config"); path != "" {
+		if err := LoadFile(path); err != nil {
+			return err
+		}
+	}
+	if err := LoadEnv(); err != nil {
+		return err
+	}
+	if err := LoadFlags(c); err != nil {
+		return err
+	}
+	envErr = nil
+	derive()
+
+	return Validate()
+}
+
+// Validate check whether configurations are sane
+func Validate() error {
+	if envErr != nil {
+		return envErr
+	}
+
+	switch {
+	case GRPCAddr == "":
+		return errors.New("GRPCAddr should not be empty")
+	case ChunkServerName == "" || strings.Contains(ChunkServerName, "/"):
+		return fmt.Errorf("ChunkServerName %q should not be empty or contain /", ChunkServerName)
+	case ClusterName == "" || strings.Contains(ClusterName, "/"):
+		return fmt.Errorf("ClusterName %q should not be empty or contain /", ClusterName)
+	case ChunkServerAddr == "":
+		return errors.New("ChunkServerAddr should not be empty")
+	case ChunkSize <= 0:
+		return fmt.Errorf("ChunkSize should be positive but got %d", ChunkSize)
+	case GRPCMaxMsgSize <= ChunkSize:
+		return fmt.Errorf("GRPCMaxMsgSize(%d) should be greater than ChunkSize(%d)", GRPCMaxMsgSize, ChunkSize)
+	case len(EtcdEndpoints) == 0:
+		return errors.New("EtcdEndpoints should not be empty")
+	case EtcdDialTimeout <= 0:
+		return fmt.Errorf("EtcdDialTimeout should be positive but got %s", EtcdDialTimeout)
+	case Durability != "none" && Durability != "data" && Durability != "full":
+		return fmt.Errorf("Durability should be none, data or full but got %q", Durability)
+	case ChunkStore != "flat" && ChunkStore != "hashed" && ChunkStore != "segment" && ChunkStore != "memory":
+		return fmt.Errorf("ChunkStore should be flat, hashed, segment or memory but got %q", ChunkStore)
+	case ReplicaNum < 1:
+		return fmt.Errorf("ReplicaNum should be at least 1 but got %d", ReplicaNum)
+	case WorkerTTL < 2*time.Second:
+		return fmt.Errorf("WorkerTTL should be at least 2s but got %s", WorkerTTL)
+	case ShutdownTimeout < 0:
+		return fmt.Errorf("ShutdownTimeout should not be negative but got %s", ShutdownTimeout)
+	case RPCTimeout < 0:
+		return fmt.Errorf("RPCTimeout should not be negative but got %s", RPCTimeout)
+	case PackThreshold < 0:
+		return fmt.Errorf("PackThreshold should not be negative but got %d", PackThreshold)
+	case PackSealInterval <= 0:
+		return fmt.Errorf("PackSealInterval should be positive but got %s", PackSealInterval)
+	case CompactInterval < 0:
+		return fmt.Errorf("CompactInterval should not be negative but got %s", CompactInterval)
+	case DefaultQuotaBytes < 0 || DefaultQuotaFiles < 0:
+		return errors.New("DefaultQuotaBytes and DefaultQuotaFiles should not be negative")
+	case CompactGarbage < 1 || CompactGarbage > 100:
+		return fmt.Errorf("CompactGarbage should be between 1 and 100 but got %d", CompactGarbage)
+	case (TLSCert == "") != (TLSKey == ""):
+		return errors.New("TLSCert and TLSKey should be given together")
+	case TLSClientAuth && (!TLS || TLSCA == ""):
+		return errors.New("TLSClientAuth needs TLS and TLSCA")
+	case (EtcdTLSCert == "") != (EtcdTLSKey == ""):
+		return errors.New("EtcdTLSCert and EtcdTLSKey should be given together")
+	case Auth && TokensFile == "" && !TLSClientAuth:
+		return errors.New("Auth needs TokensFile or TLSClientAuth to identify users")
+	case Auth && PeerTokenFile == "" && len(PeerNames) == 0:
+		return errors.New("Auth needs PeerTokenFile or PeerNames to identify chunkservers")
+	case len(PeerNames) > 0 && !TLSClientAuth:
+		return errors.New("PeerNames are only used with TLSClientAuth")
+	case DiskKeyFile == "" && len(OldDiskKeyFiles) > 0:
+		return errors.New("OldDiskKeyFiles are only used with DiskKeyFile")
+	case RepairInterval < 0:
+		return fmt.Errorf("RepairInterval should not be negative but got %s", RepairInterval)
+	case RekeyInterval <= 0:
+		return fmt.Errorf("RekeyInterval should be positive but got %s", RekeyInterval)
+	}
+
+	for name, path := range map[string]string{"FileBasePath": FileBasePath, "ChunkBasePath": ChunkBasePath, "WorkerBasePath": WorkerBasePath, "PackBasePath": PackBasePath, "QuotaBasePath": QuotaBasePath, "LeaderBasePath": LeaderBasePath} {
+		if !filepath.IsAbs(path) || !strings.HasSuffix(path, "/") {
+			return fmt.Errorf("%s %q should be an absolute path ends with /", name, path)
+		}
+	}
+
+	if len(DataDirs) == 0 {
+		return errors.New("DataDirs should not be empty")
+	}
+	for _, dir := range DataDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("data directory %q should be an absolute path", dir)
+		}
+	}
+
+	return nil
+}
+
+// Dump write current configurations to w in TOML, it can be loaded by LoadFile
+func Dump(w io.Writer) error {
+	values := map[string]interface{}{}
+	for _, s := range settings {
+		switch v := s.value.(type) {
+		case *time.Duration:
+			values[s.name] = v.String()
+		case *string:
+			values[s.name] = *v
+		case *int:
+			values[s.name] = *v
+		case *bool:
+			values[s.name] = *v
+		case *[]string:
+			values[s.name] = *v
+		}
+	}
+
+	return toml.NewEncoder(w).Encode(values)
 }
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -9,3 +14,114 @@ func TestConfig(t *testing.T) {
 		t.Fatalf("default GRPCAddr should be 127.0.0.1:8899")
 	}
 }
+
+func TestLoadFileAndEnv(t *testing.T) {
+	defer func(size, replica int, endpoints []string) {
+		ChunkSize, ReplicaNum, EtcdEndpoints = size, replica, endpoints
+		GRPCMaxMsgSize = ChunkSize + 4096
+		delete(explicit, "ChunkSize")
+		delete(explicit, "ReplicaNum")
+		delete(explicit, "EtcdEndpoints")
+		os.Unsetenv("ReplicaNum")
+	}(ChunkSize, ReplicaNum, EtcdEndpoints)
+
+	f, err := ioutil.TempFile("", "hfs-config")
+	if err != nil {
+		t.Fatalf("failed to create config file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, "ChunkSize = 1024\nReplicaNum = 2\nEtcdEndpoints = [\"10.0.0.1:2379\", \"10.0.0.2:2379\"]\n")
+	f.Close()
+
+	if err := LoadFile(f.Name()); err != nil {
+		t.Fatalf("failed to load config file: %s", err)
+	}
+	os.Setenv("ReplicaNum", "1")
+	if err := LoadEnv(); err != nil {
+		t.Fatalf("failed to load env: %s", err)
+	}
+	derive()
+
+	if ChunkSize != 1024 || GRPCMaxMsgSize != 1024+4096 || len(EtcdEndpoints) != 2 {
+		t.Fatalf("configurations in file should be loaded, but got %d %d %v", ChunkSize, GRPCMaxMsgSize, EtcdEndpoints)
+	}
+	if ReplicaNum != 1 {
+		t.Fatalf("env should override config file, but ReplicaNum is %d", ReplicaNum)
+	}
+	if err := Validate(); err != nil {
+		t.Fatalf("configurations should be valid but got: %s", err)
+	}
+
+	// dump and load it back
+	buf := bytes.Buffer{}
+	if err := Dump(&buf); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+	if !strings.Contains(buf.String(), "ChunkSize = 1024") {
+		t.Fatalf("bad dump: %s", buf.String())
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	defer func(replica int) {
+		ReplicaNum = replica
+		delete(explicit, "ReplicaNum")
+		os.Unsetenv("ReplicaNum")
+	}(ReplicaNum)
+
+	os.Setenv("ReplicaNum", "three")
+	if err := LoadEnv(); err == nil {
+		t.Fatalf("should failed to parse ReplicaNum")
+	}
+
+	ReplicaNum = 0
+	if err := Validate(); err == nil {
+		t.Fatalf("ReplicaNum 0 should be invalid")
+	}
+
+	f, err := ioutil.TempFile("", "hfs-config")
+	if err != nil {
+		t.Fatalf("failed to create config file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, "NoSuchKey = 1\n")
+	f.Close()
+
+	if err := LoadFile(f.Name()); err == nil {
+		t.Fatalf("should failed to load unknown configuration")
+	}
+}
+
+func TestClusterName(t *testing.T) {
+	defer func(name, chunkBasePath string) {
+		ClusterName, ChunkBasePath = name, chunkBasePath
+		delete(explicit, "ClusterName")
+		delete(explicit, "ChunkBasePath")
+		derive()
+	}(ClusterName, ChunkBasePath)
+
+	s, _ := find("ClusterName")
+	s.set("staging")
+	s, _ = find("ChunkBasePath")
+	s.set("/shared/chunks/")
+	derive()
+
+	if FileBasePath != "/staging/files/" || WorkerBasePath != "/staging/workers/" {
+		t.Fatalf("prefixes should be derived from ClusterName but got %s %s", FileBasePath, WorkerBasePath)
+	}
+	if ChunkBasePath != "/shared/chunks/" {
+		t.Fatalf("explicit ChunkBasePath should be kept but got %s", ChunkBasePath)
+	}
+	if DataDirs[0] != "/hfs/chunks/" {
+		t.Fatalf("DataDirs should not be changed by ClusterName but got %v", DataDirs)
+	}
+}
+
+func TestNamespaceOf(t *testing.T) {
+	if ns := NamespaceOf(ClusterName); ns.FileBasePath != FileBasePath || ns.WorkerBasePath != WorkerBasePath {
+		t.Fatalf("namespace of current cluster should use configured prefixes but got %+v", ns)
+	}
+	if ns := NamespaceOf("prod"); ns.FileBasePath != "/prod/files/" || ns.ChunkBasePath != "/prod/chunks/" || ns.WorkerBasePath != "/prod/workers/" {
+		t.Fatalf("bad namespace of prod: %+v", ns)
+	}
+}
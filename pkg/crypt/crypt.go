@@ -0,0 +1,222 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/jiajunhuang/hfs/pb"
+)
+
+/*
+package crypt provide encryption of files in client, and of chunks at rest in chunkservers.
+
+in client, every file has it's own random data key, chunks are encrypted by it with AES-GCM.
+the data key is wrapped by a master key which never leaves client, and stored in metadata of file.
+the last chunk is sealed as the last one, an encrypted file always has at least one chunk.
+*/
+
+// Scheme is the only supported encryption scheme
+const Scheme = "aes-256-gcm"
+
+// KeyEnv is the environment which holds master key in hex, it's used if there's no key file
+const KeyEnv = "HFS_KEY"
+
+const (
+	// KeySize is length of master key and data keys in bytes
+	KeySize = 32
+	// Overhead is how many bytes encrypting a chunk adds
+	Overhead = 16
+
+	prefixSize = 4 // the rest 8 bytes of nonce is index of chunk
+)
+
+// error definitions
+var (
+	ErrNoKey         = errors.New("no encryption key, set KeyFile or " + KeyEnv)
+	ErrBadKey        = errors.New("encryption key should be 32 bytes, or 64 hex characters")
+	ErrWrongKey      = errors.New("file is encrypted by another key")
+	ErrUnknownScheme = errors.New("unknown encryption scheme")
+	ErrCorrupted     = errors.New("failed to decrypt, data is corrupted or tampered")
+)
+
+// Key is a master key
+type Key struct {
+	id    string
+	block cipher.Block
+	aead  cipher.AEAD
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewKey returns a master key of raw, which is 32 bytes, or 64 hex characters
+func NewKey(raw []byte) (*Key, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 2*KeySize {
+		decoded := make([]byte, KeySize)
+		if _, err := hex.Decode(decoded, raw); err != nil {
+			return nil, ErrBadKey
+		}
+		raw = decoded
+	}
+	if len(raw) != KeySize {
+		return nil, ErrBadKey
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &Key{id: hex.EncodeToString(sum[:8]), block: block, aead: aead}, nil
+}
+
+// LoadKey load master key from file at path, or from KeyEnv if path is empty
+func LoadKey(path string) (*Key, error) {
+	if path == "" {
+		raw := os.Getenv(KeyEnv)
+		if raw == "" {
+			return nil, ErrNoKey
+		}
+		return NewKey([]byte(raw))
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, path)
+	}
+	return key, nil
+}
+
+// ID returns fingerprint of key, it tells which key a file is encrypted by
+func (k *Key) ID() string {
+	return k.id
+}
+
+// StreamAt returns AES-CTR key stream of iv which starts at offset off, so that any part of
+// data can be encrypted or decrypted alone. iv should be aes.BlockSize bytes
+func (k *Key) StreamAt(iv []byte, off int64) cipher.Stream {
+	// counter = iv + off / aes.BlockSize
+	counter := append([]byte{}, iv...)
+	carry := uint64(off / aes.BlockSize)
+	for i := len(counter) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + carry&0xff
+		counter[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+
+	stream := cipher.NewCTR(k.block, counter)
+	skip := make([]byte, off%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	return stream
+}
+
+// NewFile generate data key of a new file, it returns metadata to save in file and cipher of chunks
+func (k *Key) NewFile() (*pb.Encryption, *Cipher, error) {
+	dataKey := make([]byte, KeySize+k.aead.NonceSize()+prefixSize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, err
+	}
+	dataKey, nonce, prefix := dataKey[:KeySize], dataKey[KeySize:KeySize+k.aead.NonceSize()], dataKey[KeySize+k.aead.NonceSize():]
+
+	c, err := newCipher(dataKey, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc := &pb.Encryption{
+		Scheme:      Scheme,
+		KeyId:       k.id,
+		WrappedKey:  k.aead.Seal(append([]byte{}, nonce...), nonce, dataKey, []byte(Scheme)),
+		NoncePrefix: append([]byte{}, prefix...),
+	}
+	return enc, c, nil
+}
+
+// Open unwrap data key of file, it returns cipher of chunks
+func (k *Key) Open(enc *pb.Encryption) (*Cipher, error) {
+	if enc.Scheme != Scheme {
+		return nil, fmt.Errorf("%s: %s", ErrUnknownScheme, enc.Scheme)
+	}
+	if enc.KeyId != k.id {
+		return nil, ErrWrongKey
+	}
+
+	nonceSize := k.aead.NonceSize()
+	if len(enc.WrappedKey) < nonceSize || len(enc.NoncePrefix) != prefixSize {
+		return nil, ErrCorrupted
+	}
+	dataKey, err := k.aead.Open(nil, enc.WrappedKey[:nonceSize], enc.WrappedKey[nonceSize:], []byte(Scheme))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+
+	return newCipher(dataKey, enc.NoncePrefix)
+}
+
+// Cipher encrypts and decrypts chunks of a file, it's safe for concurrent use
+type Cipher struct {
+	aead   cipher.AEAD
+	prefix []byte
+}
+
+func newCipher(dataKey []byte, prefix []byte) (*Cipher, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead, prefix: prefix}, nil
+}
+
+// nonce is unique for every chunk, so chunks can't be swapped without being detected
+func (c *Cipher) nonce(i int) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	copy(nonce, c.prefix)
+	binary.BigEndian.PutUint64(nonce[prefixSize:], uint64(i))
+	return nonce
+}
+
+// additional data tells whether a chunk is the last one of file, so that dropping trailing
+// chunks is detected
+func additionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Seal encrypt the i-th chunk, last is whether it's the last chunk of file
+func (c *Cipher) Seal(i int, last bool, plaintext []byte) []byte {
+	return c.aead.Seal(nil, c.nonce(i), plaintext, additionalData(last))
+}
+
+// Open decrypt the i-th chunk, last is whether it's the last chunk of file
+func (c *Cipher) Open(i int, last bool, ciphertext []byte) ([]byte, error) {
+	plaintext, err := c.aead.Open(nil, c.nonce(i), ciphertext, additionalData(last))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return plaintext, nil
+}
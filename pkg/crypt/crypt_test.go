@@ -0,0 +1,100 @@
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCrypt(t *testing.T) {
+	key, err := NewKey([]byte(strings.Repeat("ab", KeySize) + "\n"))
+	if err != nil {
+		t.Fatalf("failed to create key: %s", err)
+	}
+	if _, err := NewKey([]byte("short")); err != ErrBadKey {
+		t.Fatalf("short key should be rejected but got %v", err)
+	}
+
+	enc, c, err := key.NewFile()
+	if err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	data := []byte("secret data of customer")
+	sealed := c.Seal(1, false, data)
+	if len(sealed) != len(data)+Overhead || bytes.Contains(sealed, data) {
+		t.Fatalf("bad ciphertext: %x", sealed)
+	}
+
+	c, err = key.Open(enc)
+	if err != nil {
+		t.Fatalf("failed to open file: %s", err)
+	}
+	if plaintext, err := c.Open(1, false, sealed); err != nil || !bytes.Equal(plaintext, data) {
+		t.Fatalf("should decrypt %s but got %s, err: %v", data, plaintext, err)
+	}
+	// chunks can't be reordered, truncated or tampered
+	if _, err := c.Open(2, false, sealed); err != ErrCorrupted {
+		t.Fatalf("chunk at another index should be rejected but got %v", err)
+	}
+	if _, err := c.Open(1, true, sealed); err != ErrCorrupted {
+		t.Fatalf("chunk in the middle should be rejected as the last one but got %v", err)
+	}
+	if _, err := c.Open(1, false, c.Seal(1, true, data)); err != ErrCorrupted {
+		t.Fatalf("the last chunk should be rejected in the middle but got %v", err)
+	}
+	sealed[0] ^= 1
+	if _, err := c.Open(1, false, sealed); err != ErrCorrupted {
+		t.Fatalf("tampered chunk should be rejected but got %v", err)
+	}
+
+	other, _ := NewKey(bytes.Repeat([]byte{1}, KeySize))
+	if _, err := other.Open(enc); err != ErrWrongKey {
+		t.Fatalf("another key should be rejected but got %v", err)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	f, err := ioutil.TempFile("", "hfs-key")
+	if err != nil {
+		t.Fatalf("failed to create key file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(bytes.Repeat([]byte{7}, KeySize))
+	f.Close()
+
+	key, err := LoadKey(f.Name())
+	if err != nil {
+		t.Fatalf("failed to load key: %s", err)
+	}
+
+	os.Setenv(KeyEnv, strings.Repeat("07", KeySize))
+	defer os.Unsetenv(KeyEnv)
+	envKey, err := LoadKey("")
+	if err != nil || envKey.ID() != key.ID() {
+		t.Fatalf("key in environment should be the same one but got %v, err: %v", envKey, err)
+	}
+
+	os.Unsetenv(KeyEnv)
+	if _, err := LoadKey(""); err != ErrNoKey {
+		t.Fatalf("should have no key but got %v", err)
+	}
+}
+
+func TestStreamAt(t *testing.T) {
+	key, _ := NewKey(bytes.Repeat([]byte{3}, KeySize))
+	// the counter overflows the lowest bytes
+	iv := append(bytes.Repeat([]byte{0}, 14), 0xff, 0xf0)
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	whole := make([]byte, len(data))
+	key.StreamAt(iv, 0).XORKeyStream(whole, data)
+	for _, off := range []int64{1, 15, 16, 17, 256, 4099, int64(len(data) - 1)} {
+		part := make([]byte, int64(len(data))-off)
+		key.StreamAt(iv, off).XORKeyStream(part, data[off:])
+		if !bytes.Equal(part, whole[off:]) {
+			t.Fatalf("key stream at %d mismatch", off)
+		}
+	}
+}
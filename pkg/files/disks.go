@@ -0,0 +1,319 @@
+package files
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/jiajunhuang/hfs/pkg/logger"
+)
+
+// error definitions
+var (
+	ErrNoDisk      = errors.New("no healthy disk available")
+	ErrNoSpace     = errors.New("no disk has enough free space")
+	ErrChunkAbsent = errors.New("chunk not found in any disk")
+)
+
+// a disk is marked failed after maxDiskErrors consecutive IO errors
+var maxDiskErrors = 3
+
+// Disk is a data directory, usually one per physical disk
+type Disk struct {
+	Path  string
+	Store ChunkStore
+
+	mu     sync.Mutex // guards errors and failed, so that a hung disk doesn't block the others
+	errors int
+	failed bool
+}
+
+func (disk *Disk) isFailed() bool {
+	disk.mu.Lock()
+	defer disk.mu.Unlock()
+
+	return disk.failed
+}
+
+// DiskStat describes usage and health of a disk
+type DiskStat struct {
+	Path   string
+	Free   uint64
+	Total  uint64
+	Failed bool
+}
+
+// Disks manages data directories of a chunkserver. chunks are placed on the disk with the
+// most free space, and a disk with too many IO errors is taken out of service so that one
+// dead disk doesn't kill the whole node. IO is never done under a lock shared by disks.
+type Disks struct {
+	disks []*Disk // never changes after NewDisks
+
+	mu     sync.Mutex
+	chunks map[string]int // chunks by path as of the last CountChunks
+}
+
+// NewDisks create all the data directories in paths, clean temporary files left in them, and
+// open a ChunkStore of kind in each of them. a directory which can't be prepared is marked
+// failed. it returns ErrNoDisk if none of them is usable.
+func NewDisks(paths []string, kind string, opts WriteOptions) (*Disks, error) {
+	d := &Disks{}
+	healthy := 0
+
+	for _, path := range paths {
+		disk := &Disk{Path: path}
+		if err := openDisk(disk, kind, opts); err != nil {
+			logger.Sugar.Errorf("failed to open data directory %s, mark it failed: %s", path, err)
+			disk.failed = true
+		} else {
+			healthy++
+		}
+		d.disks = append(d.disks, disk)
+	}
+
+	if healthy == 0 {
+		d.Close()
+		return nil, ErrNoDisk
+	}
+
+	return d, nil
+}
+
+func openDisk(disk *Disk, kind string, opts WriteOptions) error {
+	if err := os.MkdirAll(disk.Path, 0700); err != nil {
+		return err
+	}
+	if err := RemoveTemp(disk.Path); err != nil {
+		return err
+	}
+
+	store, err := NewChunkStore(kind, disk.Path, opts)
+	if err != nil {
+		return err
+	}
+	disk.Store = store
+
+	return nil
+}
+
+func statfs(path string) (free uint64, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
+
+// healthy returns disks which are not failed
+func (d *Disks) healthy() []*Disk {
+	disks := make([]*Disk, 0, len(d.disks))
+	for _, disk := range d.disks {
+		if !disk.isFailed() {
+			disks = append(disks, disk)
+		}
+	}
+	return disks
+}
+
+// Pick returns the healthy disk with the most free space, which can hold at least size bytes
+func (d *Disks) Pick(size int64) (*Disk, error) {
+	disks := d.healthy()
+	if len(disks) == 0 {
+		return nil, ErrNoDisk
+	}
+
+	var picked *Disk
+	var maxFree uint64
+	for _, disk := range disks {
+		free, _, err := statfs(disk.Path)
+		if err != nil {
+			d.Fail(disk, err)
+			continue
+		}
+		if free >= uint64(size) && (picked == nil || free > maxFree) {
+			picked, maxFree = disk, free
+		}
+	}
+
+	if picked == nil {
+		return nil, ErrNoSpace
+	}
+	return picked, nil
+}
+
+// Locate returns the healthy disk which holds the chunk. disks are looked up concurrently, so
+// that a hung disk doesn't delay chunks in the others
+func (d *Disks) Locate(chunkUUID string) (*Disk, error) {
+	disks := d.healthy()
+	found := make(chan *Disk, len(disks))
+	for _, disk := range disks {
+		go func(disk *Disk) {
+			_, err := disk.Store.Stat(chunkUUID)
+			if err == nil {
+				found <- disk
+				return
+			} else if !os.IsNotExist(err) {
+				d.Fail(disk, err)
+			}
+			found <- nil
+		}(disk)
+	}
+
+	for range disks {
+		if disk := <-found; disk != nil {
+			return disk, nil
+		}
+	}
+	return nil, ErrChunkAbsent
+}
+
+// Fail records an IO error of disk
+func (d *Disks) Fail(disk *Disk, err error) {
+	disk.mu.Lock()
+	defer disk.mu.Unlock()
+
+	disk.errors++
+	logger.Sugar.Warnf("IO error %d/%d of disk %s: %s", disk.errors, maxDiskErrors, disk.Path, err)
+
+	if disk.errors >= maxDiskErrors && !disk.failed {
+		disk.failed = true
+		logger.Sugar.Errorf("disk %s is marked failed", disk.Path)
+	}
+}
+
+// Succeed resets error counter of disk after a successful IO
+func (d *Disks) Succeed(disk *Disk) {
+	disk.mu.Lock()
+	defer disk.mu.Unlock()
+
+	disk.errors = 0
+}
+
+// Close close stores of all the disks
+func (d *Disks) Close() error {
+	var err error
+	for _, disk := range d.disks {
+		if disk.Store == nil {
+			continue
+		}
+		if cerr := disk.Store.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Encrypt encrypt chunks at rest in all the disks with keys, it should be called before any
+// chunk is written
+func (d *Disks) Encrypt(keys *Keyring) {
+	for _, disk := range d.disks {
+		if disk.Store != nil {
+			disk.Store = NewEncryptedStore(disk.Store, keys)
+		}
+	}
+}
+
+// Rekey encrypt chunks which are plaintext or encrypted by old keys with the current key, it
+// returns how many chunks are rewritten, and how many failed. a chunk which fails is logged
+// and skipped, it's retried by the next Rekey
+func (d *Disks) Rekey() (int, int) {
+	rekeyed, failed := 0, 0
+	for _, disk := range d.healthy() {
+		store, ok := disk.Store.(*EncryptedStore)
+		if !ok {
+			continue
+		}
+		uuids, err := store.List()
+		if err != nil {
+			logger.Sugar.Errorf("failed to list chunks in %s: %s", disk.Path, err)
+			d.Fail(disk, err)
+			continue
+		}
+
+		for _, uuid := range uuids {
+			ok, err := store.Rekey(uuid)
+			if os.IsNotExist(err) {
+				continue // removed meanwhile
+			} else if err != nil {
+				logger.Sugar.Errorf("failed to re-encrypt chunk %s in %s: %s", uuid, disk.Path, err)
+				failed++
+				continue
+			}
+			if ok {
+				rekeyed++
+			}
+		}
+	}
+
+	return rekeyed, failed
+}
+
+// Compact compact segments with at least garbage percent of garbage in disks of SegmentStore, it
+// returns how many bytes are reclaimed. a disk which fails is logged and skipped
+func (d *Disks) Compact(garbage int) int64 {
+	var reclaimed int64
+	for _, disk := range d.healthy() {
+		store := disk.Store
+		if encrypted, ok := store.(*EncryptedStore); ok {
+			store = encrypted.ChunkStore
+		}
+		segments, ok := store.(*SegmentStore)
+		if !ok {
+			continue
+		}
+
+		n, err := segments.Compact(garbage)
+		reclaimed += n
+		if err != nil {
+			logger.Sugar.Errorf("failed to compact segments in %s: %s", disk.Path, err)
+			d.Fail(disk, err)
+		}
+	}
+
+	return reclaimed
+}
+
+// Chunks returns how many chunks are in each disk which is not failed, by path, as of the last
+// CountChunks. it's empty before the first one
+func (d *Disks) Chunks() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	chunks := make(map[string]int, len(d.chunks))
+	for path, n := range d.chunks {
+		chunks[path] = n
+	}
+	return chunks
+}
+
+// CountChunks count chunks in each disk which is not failed for Chunks. it lists all the
+// chunks, so it's slow
+func (d *Disks) CountChunks() {
+	chunks := map[string]int{}
+	for _, disk := range d.healthy() {
+		if uuids, err := disk.Store.List(); err == nil {
+			chunks[disk.Path] = len(uuids)
+		}
+	}
+
+	d.mu.Lock()
+	d.chunks = chunks
+	d.mu.Unlock()
+}
+
+// Stats returns usage and health of all the disks
+func (d *Disks) Stats() []DiskStat {
+	stats := make([]DiskStat, 0, len(d.disks))
+	for _, disk := range d.disks {
+		stat := DiskStat{Path: disk.Path, Failed: disk.isFailed()}
+		if !stat.Failed {
+			stat.Free, stat.Total, _ = statfs(disk.Path)
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats
+}
@@ -0,0 +1,143 @@
+package files
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDisks(t *testing.T) {
+	root, err := ioutil.TempDir("", "hfs-disks")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	// the last one can't be created since it's under a regular file
+	blocker := filepath.Join(root, "file")
+	if err := ioutil.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	paths := []string{filepath.Join(root, "d1"), filepath.Join(root, "d2"), filepath.Join(blocker, "d3")}
+
+	disks, err := NewDisks(paths, StoreFlat, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to open disks: %s", err)
+	}
+	stats := disks.Stats()
+	if len(stats) != 3 || stats[0].Failed || stats[1].Failed || !stats[2].Failed {
+		t.Fatalf("only the last disk should be failed but got %+v", stats)
+	}
+
+	disk, err := disks.Pick(1)
+	if err != nil || disk.Path == paths[2] {
+		t.Fatalf("should pick a healthy disk but got %v, err: %v", disk, err)
+	}
+	if _, err := disks.Pick(1 << 62); err != ErrNoSpace {
+		t.Fatalf("should have no space but got %v", err)
+	}
+
+	// chunks can be found in any disk
+	for i, uuid := range []string{"chunk-1", "chunk-2"} {
+		if err := ioutil.WriteFile(filepath.Join(paths[i], uuid), []byte(uuid), 0600); err != nil {
+			t.Fatalf("failed to write chunk: %s", err)
+		}
+		if disk, err := disks.Locate(uuid); err != nil || disk.Path != paths[i] {
+			t.Fatalf("chunk %s should be located at %s but got %v, err: %v", uuid, paths[i], disk, err)
+		}
+	}
+	if _, err := disks.Locate("chunk-3"); err != ErrChunkAbsent {
+		t.Fatalf("chunk-3 should be absent but got %v", err)
+	}
+
+	// chunks are counted only by CountChunks
+	if chunks := disks.Chunks(); len(chunks) != 0 {
+		t.Fatalf("chunks should not be counted yet but got %v", chunks)
+	}
+	disks.CountChunks()
+	if chunks := disks.Chunks(); len(chunks) != 2 || chunks[paths[0]] != 1 || chunks[paths[1]] != 1 {
+		t.Fatalf("every healthy disk should have 1 chunk but got %v", chunks)
+	}
+
+	// a disk is taken out of service after too many errors, success resets the counter
+	d1, _ := disks.Locate("chunk-1")
+	for i := 0; i < maxDiskErrors-1; i++ {
+		disks.Fail(d1, errors.New("io error"))
+	}
+	disks.Succeed(d1)
+	for i := 0; i < maxDiskErrors; i++ {
+		disks.Fail(d1, errors.New("io error"))
+	}
+	if _, err := disks.Locate("chunk-1"); err != ErrChunkAbsent {
+		t.Fatalf("chunk in failed disk should be absent but got %v", err)
+	}
+	if disk, err := disks.Pick(1); err != nil || disk.Path != paths[1] {
+		t.Fatalf("should pick the only healthy disk but got %v, err: %v", disk, err)
+	}
+
+	if _, err := NewDisks([]string{filepath.Join(blocker, "d4")}, StoreFlat, WriteOptions{}); err != ErrNoDisk {
+		t.Fatalf("should have no disk but got %v", err)
+	}
+}
+
+// hungStore is a ChunkStore whose Stat blocks until release is closed, like a disk in D state
+type hungStore struct {
+	ChunkStore
+	release chan struct{}
+}
+
+func (s *hungStore) Stat(chunkUUID string) (ChunkInfo, error) {
+	<-s.release
+	return s.ChunkStore.Stat(chunkUUID)
+}
+
+func TestHungDisk(t *testing.T) {
+	root, err := ioutil.TempDir("", "hfs-disks")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	paths := []string{filepath.Join(root, "d1"), filepath.Join(root, "d2")}
+	disks, err := NewDisks(paths, StoreMemory, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to open disks: %s", err)
+	}
+	hung := &hungStore{ChunkStore: disks.disks[0].Store, release: make(chan struct{})}
+	disks.disks[0].Store = hung
+	if err := disks.disks[1].Store.Put("chunk-1", strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("failed to put chunk: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := disks.Locate("chunk-2"); err != ErrChunkAbsent {
+			t.Errorf("chunk-2 should be absent but got %v", err)
+		}
+	}()
+
+	// the other disk keeps working while the first one hangs
+	if disk, err := disks.Locate("chunk-1"); err != nil || disk.Path != paths[1] {
+		t.Fatalf("chunk-1 should be located at %s but got %v, err: %v", paths[1], disk, err)
+	}
+	if _, err := disks.Pick(1); err != nil {
+		t.Fatalf("failed to pick a disk: %s", err)
+	}
+	disks.Fail(disks.disks[1], errors.New("io error"))
+	disks.Succeed(disks.disks[1])
+	if stats := disks.Stats(); len(stats) != 2 {
+		t.Fatalf("should have stats of 2 disks but got %+v", stats)
+	}
+
+	select {
+	case <-done:
+		t.Fatalf("looking up chunk-2 should wait for the hung disk")
+	default:
+	}
+	close(hung.release)
+	<-done
+}
@@ -0,0 +1,279 @@
+package files
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jiajunhuang/hfs/pkg/crypt"
+)
+
+// error definitions
+var (
+	ErrUnknownDiskKey = errors.New("chunk is encrypted by an unknown key")
+	ErrBadHeader      = errors.New("header of encrypted chunk is corrupted")
+)
+
+const (
+	encryptedMagic  = "HFE1"
+	encryptedSuffix = ".enc" // encrypted chunks are named <chunk>.enc in the store underneath
+	// header: magic(4) | ID of key(16) | iv(16)
+	encryptedHeaderSize = 4 + 16 + aes.BlockSize
+)
+
+// Keyring holds the key new chunks are encrypted by, and old keys which existing chunks may
+// still be encrypted by
+type Keyring struct {
+	current *crypt.Key
+	keys    map[string]*crypt.Key
+}
+
+// NewKeyring returns a Keyring which encrypts with current, and decrypts with current or old
+func NewKeyring(current *crypt.Key, old ...*crypt.Key) *Keyring {
+	k := &Keyring{current: current, keys: map[string]*crypt.Key{current.ID(): current}}
+	for _, key := range old {
+		k.keys[key.ID()] = key
+	}
+	return k
+}
+
+// EncryptedStore encrypts chunks in ChunkStore with AES-CTR, so that a stolen disk doesn't
+// leak data. every chunk has it's own random iv, which is stored in a header together with
+// the key it's encrypted by. encrypted chunks are stored as <chunk>.enc, so that a plaintext
+// chunk is never taken as encrypted whatever it's data is. chunks stored by their UUID are
+// plaintext, they're written before encryption is enabled, and will be encrypted by Rekey.
+type EncryptedStore struct {
+	ChunkStore
+	keys *Keyring
+	// Put, Append, Delete and Rekey change chunk under write lock, reads hold read lock so that
+	// they never see a header of one version of chunk and data of another
+	mu sync.RWMutex
+}
+
+// NewEncryptedStore returns an EncryptedStore which stores chunks in store, encrypted by keys
+func NewEncryptedStore(store ChunkStore, keys *Keyring) *EncryptedStore {
+	return &EncryptedStore{ChunkStore: store, keys: keys}
+}
+
+func (s *EncryptedStore) newHeader() ([]byte, error) {
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedMagic)
+	copy(header[4:], s.keys.current.ID())
+	if _, err := io.ReadFull(rand.Reader, header[4+16:]); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// header returns name of chunk in the store underneath, key and iv of it. key is nil if chunk
+// is plaintext
+func (s *EncryptedStore) header(chunkUUID string) (string, *crypt.Key, []byte, error) {
+	name := chunkUUID + encryptedSuffix
+	header := make([]byte, encryptedHeaderSize)
+	n, err := s.ChunkStore.ReadAt(name, header, 0)
+	if os.IsNotExist(err) {
+		return chunkUUID, nil, nil, nil
+	} else if err != nil && err != io.EOF {
+		return "", nil, nil, err
+	}
+	if n < encryptedHeaderSize || string(header[:4]) != encryptedMagic {
+		return "", nil, nil, ErrBadHeader
+	}
+
+	key, ok := s.keys.keys[string(header[4:4+16])]
+	if !ok {
+		return "", nil, nil, ErrUnknownDiskKey
+	}
+	return name, key, header[4+16:], nil
+}
+
+// Put implements ChunkStore
+func (s *EncryptedStore) Put(chunkUUID string, r io.Reader, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.put(chunkUUID, r, size)
+}
+
+// put write chunk encrypted, and remove the plaintext one if it's there
+func (s *EncryptedStore) put(chunkUUID string, r io.Reader, size int64) error {
+	header, err := s.newHeader()
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		size += encryptedHeaderSize
+	}
+
+	stream := s.keys.current.StreamAt(header[4+16:], 0)
+	if err := s.ChunkStore.Put(chunkUUID+encryptedSuffix, io.MultiReader(bytes.NewReader(header), &cipher.StreamReader{S: stream, R: r}), size); err != nil {
+		return err
+	}
+	if err := s.ChunkStore.Delete(chunkUUID); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Append implements ChunkStore
+func (s *EncryptedStore) Append(chunkUUID string, data []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, key, iv, err := s.header(chunkUUID)
+	if err != nil {
+		return 0, err
+	} else if key != nil {
+		info, err := s.ChunkStore.Stat(name)
+		if err != nil {
+			return 0, err
+		}
+		encrypted := make([]byte, len(data))
+		key.StreamAt(iv, info.Size-encryptedHeaderSize).XORKeyStream(encrypted, data)
+		offset, err := s.ChunkStore.Append(name, encrypted)
+		return offset - encryptedHeaderSize, err
+	}
+
+	_, err = s.ChunkStore.Stat(chunkUUID)
+	if err == nil {
+		return s.ChunkStore.Append(chunkUUID, data)
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	header, err := s.newHeader()
+	if err != nil {
+		return 0, err
+	}
+	encrypted := make([]byte, len(header)+len(data))
+	copy(encrypted, header)
+	s.keys.current.StreamAt(header[4+16:], 0).XORKeyStream(encrypted[len(header):], data)
+	_, err = s.ChunkStore.Append(chunkUUID+encryptedSuffix, encrypted)
+	return 0, err
+}
+
+// Get implements ChunkStore
+func (s *EncryptedStore) Get(chunkUUID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(chunkUUID)
+}
+
+func (s *EncryptedStore) get(chunkUUID string) ([]byte, error) {
+	name, key, iv, err := s.header(chunkUUID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.ChunkStore.Get(name)
+	if err != nil || key == nil {
+		return data, err
+	}
+
+	data = data[encryptedHeaderSize:]
+	key.StreamAt(iv, 0).XORKeyStream(data, data)
+	return data, nil
+}
+
+// ReadAt implements ChunkStore, only the part which is read is decrypted
+func (s *EncryptedStore) ReadAt(chunkUUID string, p []byte, off int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, key, iv, err := s.header(chunkUUID)
+	if err != nil {
+		return 0, err
+	} else if key == nil {
+		return s.ChunkStore.ReadAt(name, p, off)
+	}
+
+	n, err := s.ChunkStore.ReadAt(name, p, off+encryptedHeaderSize)
+	key.StreamAt(iv, off).XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+// Stat implements ChunkStore
+func (s *EncryptedStore) Stat(chunkUUID string) (ChunkInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, key, _, err := s.header(chunkUUID)
+	if err != nil {
+		return ChunkInfo{}, err
+	}
+	info, err := s.ChunkStore.Stat(name)
+	if err != nil {
+		return info, err
+	}
+
+	info.UUID = chunkUUID
+	if key != nil {
+		info.Size -= encryptedHeaderSize
+	}
+	return info, nil
+}
+
+// List implements ChunkStore
+func (s *EncryptedStore) List() ([]string, error) {
+	names, err := s.ChunkStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	uuids := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		// both of them are there if it crashed before the plaintext one is removed
+		uuid := strings.TrimSuffix(name, encryptedSuffix)
+		if !seen[uuid] {
+			seen[uuid] = true
+			uuids = append(uuids, uuid)
+		}
+	}
+	return uuids, nil
+}
+
+// Rekey encrypt chunk by the current key if it's plaintext or encrypted by an old key, it
+// returns whether chunk is rewritten
+func (s *EncryptedStore) Rekey(chunkUUID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, key, _, err := s.header(chunkUUID)
+	if err != nil {
+		return false, err
+	} else if key == s.keys.current {
+		return false, nil
+	}
+
+	data, err := s.get(chunkUUID)
+	if err != nil {
+		return false, err
+	}
+	if err := s.put(chunkUUID, bytes.NewReader(data), int64(len(data))); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete implements ChunkStore, a chunk which is being rekeyed is deleted after it, so that it's
+// not written back
+func (s *EncryptedStore) Delete(chunkUUID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.ChunkStore.Delete(chunkUUID + encryptedSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if perr := s.ChunkStore.Delete(chunkUUID); !os.IsNotExist(perr) {
+		return perr
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jiajunhuang/hfs/pkg/crypt"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	oldKey, _ := crypt.NewKey(bytes.Repeat([]byte{1}, crypt.KeySize))
+	newKey, _ := crypt.NewKey(bytes.Repeat([]byte{2}, crypt.KeySize))
+	inner := NewMemoryStore()
+	// it looks like a header of encrypted chunk, but it's plaintext
+	data := []byte(encryptedMagic + strings.Repeat("secret data ", 10))
+
+	// a chunk written before encryption is enabled
+	if err := inner.Put("plain", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("failed to put chunk: %s", err)
+	}
+
+	store := NewEncryptedStore(inner, NewKeyring(oldKey))
+	if err := store.Put("chunk", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("failed to put chunk: %s", err)
+	}
+	if off, err := store.Append("pack", data[:7]); err != nil || off != 0 {
+		t.Fatalf("failed to append: %d, %v", off, err)
+	}
+	if off, err := store.Append("pack", data[7:]); err != nil || off != 7 {
+		t.Fatalf("failed to append: %d, %v", off, err)
+	}
+
+	check := func(store ChunkStore) {
+		for _, uuid := range []string{"plain", "chunk", "pack"} {
+			if got, err := store.Get(uuid); err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("should get data of %s but got %q, err: %v", uuid, got, err)
+			}
+			p := make([]byte, 10)
+			if n, err := store.ReadAt(uuid, p, 13); err != nil || !bytes.Equal(p[:n], data[13:23]) {
+				t.Fatalf("should read %q at 13 of %s but got %q, err: %v", data[13:23], uuid, p[:n], err)
+			}
+			if n, err := store.ReadAt(uuid, p, int64(len(data)-3)); err != io.EOF || !bytes.Equal(p[:n], data[len(data)-3:]) {
+				t.Fatalf("should read the tail of %s with EOF but got %q, err: %v", uuid, p[:n], err)
+			}
+			if info, err := store.Stat(uuid); err != nil || info.Size != int64(len(data)) {
+				t.Fatalf("size of %s should be %d but got %+v, err: %v", uuid, len(data), info, err)
+			}
+		}
+	}
+	check(store)
+	for _, uuid := range []string{"chunk", "pack"} {
+		if raw, err := inner.Get(uuid + encryptedSuffix); err != nil || bytes.Contains(raw, []byte("secret")) {
+			t.Fatalf("chunk %s should be encrypted on disk, err: %v", uuid, err)
+		}
+	}
+	if uuids, err := store.List(); err != nil || len(uuids) != 3 {
+		t.Fatalf("should list 3 chunks but got %v, err: %v", uuids, err)
+	}
+
+	// rotate the key, everything is re-encrypted by the new one
+	store = NewEncryptedStore(inner, NewKeyring(newKey, oldKey))
+	disks := &Disks{disks: []*Disk{{Path: "memory", Store: store}}}
+	if n, failed := disks.Rekey(); failed != 0 || n != 3 {
+		t.Fatalf("3 chunks should be re-encrypted but got %d, %d failed", n, failed)
+	}
+	if n, failed := disks.Rekey(); failed != 0 || n != 0 {
+		t.Fatalf("nothing should be re-encrypted again but got %d, %d failed", n, failed)
+	}
+
+	// the old key can be thrown away
+	store = NewEncryptedStore(inner, NewKeyring(newKey))
+	check(store)
+	if raw, err := inner.Get("plain" + encryptedSuffix); err != nil || bytes.Contains(raw, []byte("secret")) {
+		t.Fatalf("plaintext chunk should be encrypted on disk, err: %v", err)
+	}
+	if _, err := inner.Stat("plain"); !os.IsNotExist(err) {
+		t.Fatalf("plaintext chunk should be removed once it's encrypted but got %v", err)
+	}
+
+	if _, err := NewEncryptedStore(inner, NewKeyring(oldKey)).Get("chunk"); err != ErrUnknownDiskKey {
+		t.Fatalf("chunk encrypted by unknown key should be rejected but got %v", err)
+	}
+	if _, err := store.Stat("absent"); !os.IsNotExist(err) {
+		t.Fatalf("absent chunk should not exist but got %v", err)
+	}
+
+	for _, uuid := range []string{"plain", "chunk", "pack"} {
+		if err := store.Delete(uuid); err != nil {
+			t.Fatalf("failed to delete %s: %s", uuid, err)
+		}
+	}
+	if err := store.Delete("plain"); !os.IsNotExist(err) {
+		t.Fatalf("deleted chunk should not exist but got %v", err)
+	}
+	if uuids, err := inner.List(); err != nil || len(uuids) != 0 {
+		t.Fatalf("nothing should be left on disk but got %v, err: %v", uuids, err)
+	}
+}
+
+func TestRekeyConcurrently(t *testing.T) {
+	oldKey, _ := crypt.NewKey(bytes.Repeat([]byte{1}, crypt.KeySize))
+	newKey, _ := crypt.NewKey(bytes.Repeat([]byte{2}, crypt.KeySize))
+	unknownKey, _ := crypt.NewKey(bytes.Repeat([]byte{3}, crypt.KeySize))
+	dir, err := ioutil.TempDir("", "hfs-rekey")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	inner := NewFlatStore(dir, WriteOptions{})
+	data := []byte(strings.Repeat("secret data ", 100))
+	uuids := []string{}
+	for i := 0; i < 10; i++ {
+		uuids = append(uuids, fmt.Sprintf("chunk-%d", i))
+	}
+
+	// a chunk which can't be re-encrypted doesn't stop the others
+	NewEncryptedStore(inner, NewKeyring(unknownKey)).Put("unknown", bytes.NewReader(data), int64(len(data)))
+	store := NewEncryptedStore(inner, NewKeyring(newKey, oldKey))
+	disks := &Disks{disks: []*Disk{{Path: "memory", Store: store}}}
+
+	for round := 0; round < 20; round++ {
+		old := NewEncryptedStore(inner, NewKeyring(oldKey))
+		for _, uuid := range uuids {
+			old.Put(uuid, bytes.NewReader(data), int64(len(data)))
+		}
+
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		errs := make(chan error, 2*len(uuids))
+		for _, uuid := range uuids {
+			wg.Add(1)
+			go func(uuid string) {
+				defer wg.Done()
+				p := make([]byte, 12)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if got, err := store.Get(uuid); err != nil || !bytes.Equal(got, data) {
+						errs <- fmt.Errorf("should get data of %s but got %q, err: %v", uuid, got, err)
+						return
+					}
+					if n, err := store.ReadAt(uuid, p, 24); err != nil || !bytes.Equal(p[:n], data[24:36]) {
+						errs <- fmt.Errorf("should read %q of %s but got %q, err: %v", data[24:36], uuid, p[:n], err)
+						return
+					}
+				}
+			}(uuid)
+		}
+
+		n, failed := disks.Rekey()
+		close(done)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("round %d: %s", round, err)
+		}
+		if n != len(uuids) || failed != 1 {
+			t.Fatalf("round %d: %d chunks should be re-encrypted and 1 failed but got %d, %d", round, len(uuids), n, failed)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package files
 import (
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync"
 
 	"github.com/jiajunhuang/hfs/pkg/logger"
 )
@@ -14,13 +16,29 @@ var (
 	ErrWriteFailed = errors.New("failed to write same length bytes as read")
 )
 
+// size of buffers used to copy data into files
+const bufSize = 1024 * 1024
+
+// O_DIRECT requires offset, length and address of buffer aligned to logical block size
+const directAlign = 4096
+
+var bufPool = sync.Pool{New: func() interface{} { return make([]byte, bufSize) }}
+
+// copyBuffer works like io.Copy, with a pooled large buffer. it still copies without buffer if
+// r implements io.WriterTo or w implements io.ReaderFrom
+func copyBuffer(w io.Writer, r io.Reader) (int64, error) {
+	buf := bufPool.Get().([]byte)
+	defer bufPool.Put(buf)
+
+	return io.CopyBuffer(w, r, buf)
+}
+
 // Create create a file at path, with all the directory
 // same as mkdir -p && touch
 func Create(path string) (*os.File, error) {
-	paths := strings.Split(path, "/")
-
-	dirPath := strings.Join(paths[:len(paths)-1], "/")
-	os.MkdirAll(dirPath, 0700)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
 
 	logger.Sugar.Debugf("create file: %s", path)
 	return os.Create(path)
@@ -40,20 +58,122 @@ func Append(path string, r io.Reader) error {
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	bufSize := 1024
-	buf := make([]byte, bufSize)
+	if _, err := copyBuffer(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Durability describes how hard a write tries to survive power loss
+type Durability string
+
+// durability levels
+const (
+	DurabilityNone Durability = "none" // leave data in page cache, only rename is atomic
+	DurabilityData Durability = "data" // fsync data before rename
+	DurabilityFull Durability = "full" // fsync data before rename, and fsync directory after it
+)
+
+// prefix of temporary files written by WriteAtomic
+const tempPrefix = ".tmp-"
+
+// WriteOptions controls how WriteAtomic writes a file
+type WriteOptions struct {
+	Durability Durability
+	Fallocate  bool // preallocate space of file before writing it, if size is known
+	DirectIO   bool // write with O_DIRECT, bypassing page cache
+}
+
+// WriteAtomic write everything in r to path, size is the expected length of data or -1 if it's
+// unknown. data is written into a temporary file in the same directory, which will be renamed to
+// path, so readers never see partial data at path
+func WriteAtomic(path string, r io.Reader, size int64, opts WriteOptions) error {
+	return writeAtomic(filepath.Dir(path), path, r, size, opts)
+}
+
+// writeAtomic works like WriteAtomic, but the temporary file is written in tempDir, which
+// should be in the same file system as path
+func writeAtomic(tempDir string, path string, r io.Reader, size int64, opts WriteOptions) error {
+	f, err := ioutil.TempFile(tempDir, tempPrefix+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	tempPath := f.Name()
+
+	if err := writeTemp(f, r, size, opts); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
 
-	for {
-		n, err := r.Read(buf)
-		if err == io.EOF {
-			break
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if opts.Durability == DurabilityFull {
+		return SyncDir(filepath.Dir(path))
+	}
+
+	return nil
+}
+
+// writeTemp fill the newly created temporary file f with data in r
+func writeTemp(f *os.File, r io.Reader, size int64, opts WriteOptions) error {
+	if opts.Fallocate && size > 0 {
+		if err := fallocate(f, size); err != nil {
+			return err
 		}
-		nw, e := f.Write(buf[:n])
-		logger.Sugar.Debugf("Append: read %d bytes, write %d bytes, read err: %s, write err: %s", n, nw, err, e)
-		if e != nil {
-			return e
+	}
+
+	var err error
+	if opts.DirectIO {
+		err = copyDirect(f, r)
+	} else {
+		_, err = copyBuffer(f, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Durability != DurabilityNone {
+		return f.Sync()
+	}
+	return nil
+}
+
+// SyncDir fsync directory at path, so that entries created or renamed in it are persisted
+func SyncDir(path string) error {
+	if path == "" {
+		path = "."
+	}
+
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// RemoveTemp remove temporary files left in dir by interrupted WriteAtomic
+func RemoveTemp(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, tempPrefix+"*"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		logger.Sugar.Infof("remove temporary file %s", path)
+		if err := os.Remove(path); err != nil {
+			return err
 		}
 	}
 
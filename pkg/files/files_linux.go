@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package files
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// FALLOC_FL_KEEP_SIZE, size of file is not changed so that it's still correct if less data is written
+const fallocKeepSize = 0x1
+
+func fallocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		// it's an optimization, and not all the file systems support it
+		return nil
+	}
+
+	return err
+}
+
+// alignedBuffer returns a buffer of size whose address is aligned to align
+func alignedBuffer(size int, align int) []byte {
+	buf := make([]byte, size+align)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & uintptr(align-1)); rem != 0 {
+		off = align - rem
+	}
+
+	return buf[off : off+size]
+}
+
+// copyDirect copy r into f with O_DIRECT, f should be empty. the tail which is not aligned is
+// written without O_DIRECT. it falls back to buffered copy if the file system doesn't support it
+func copyDirect(f *os.File, r io.Reader) error {
+	direct, err := os.OpenFile(f.Name(), os.O_WRONLY|syscall.O_DIRECT, 0)
+	if err != nil {
+		if e, ok := err.(*os.PathError); ok && e.Err == syscall.EINVAL {
+			_, err = copyBuffer(f, r)
+		}
+		return err
+	}
+	defer direct.Close()
+
+	buf := alignedBuffer(bufSize, directAlign)
+	var off int64
+	for {
+		n, rerr := io.ReadFull(r, buf)
+
+		aligned := n - n%directAlign
+		if aligned > 0 {
+			if _, err := direct.WriteAt(buf[:aligned], off); err != nil {
+				return err
+			}
+			off += int64(aligned)
+		}
+		if aligned < n {
+			if _, err := f.WriteAt(buf[aligned:n], off); err != nil {
+				return err
+			}
+			off += int64(n - aligned)
+		}
+
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			return nil
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+}
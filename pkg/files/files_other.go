@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package files
+
+import (
+	"io"
+	"os"
+)
+
+// fallocate is not supported, space is allocated while writing
+func fallocate(f *os.File, size int64) error {
+	return nil
+}
+
+// copyDirect falls back to buffered copy since O_DIRECT is not supported
+func copyDirect(f *os.File, r io.Reader) error {
+	_, err := copyBuffer(f, r)
+	return err
+}
@@ -3,8 +3,10 @@ package files
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestCreate(t *testing.T) {
@@ -73,3 +75,44 @@ func TestAppend(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hfs-files")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chunk")
+
+	for _, durability := range []Durability{DurabilityNone, DurabilityData, DurabilityFull} {
+		data := "hello " + string(durability)
+		if err := WriteAtomic(path, strings.NewReader(data), int64(len(data)), WriteOptions{Durability: durability}); err != nil {
+			t.Fatalf("failed to write with durability %s: %s", durability, err)
+		}
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != data {
+			t.Fatalf("should read %s but got %s, err: %v", data, b, err)
+		}
+	}
+
+	// a failed write leaves nothing behind
+	if err := WriteAtomic(path, iotest.TimeoutReader(strings.NewReader("partial")), -1, WriteOptions{Durability: DurabilityFull}); err == nil {
+		t.Fatalf("write should fail")
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "hello full" {
+		t.Fatalf("failed write should not touch the old file but got %s", b)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("failed write should not leave temporary file, but got %d files", len(entries))
+	}
+
+	// temporary files left by crash are cleaned
+	if err := ioutil.WriteFile(filepath.Join(dir, tempPrefix+"chunk-123"), nil, 0600); err != nil {
+		t.Fatalf("failed to write temporary file: %s", err)
+	}
+	if err := RemoveTemp(dir); err != nil {
+		t.Fatalf("failed to remove temporary files: %s", err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 || entries[0].Name() != "chunk" {
+		t.Fatalf("only chunk should be left, but got %d files", len(entries))
+	}
+}
@@ -0,0 +1,116 @@
+package files
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// MemoryStore keeps chunks in memory, it's useful for tests
+type MemoryStore struct {
+	mu     sync.RWMutex
+	chunks map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{chunks: map[string][]byte{}}
+}
+
+// Put implements ChunkStore
+func (s *MemoryStore) Put(chunkUUID string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chunks[chunkUUID] = data
+	return nil
+}
+
+// Append implements ChunkStore
+func (s *MemoryStore) Append(chunkUUID string, data []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset := int64(len(s.chunks[chunkUUID]))
+	s.chunks[chunkUUID] = append(s.chunks[chunkUUID], data...)
+	return offset, nil
+}
+
+// Get implements ChunkStore
+func (s *MemoryStore) Get(chunkUUID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.chunks[chunkUUID]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte{}, data...), nil
+}
+
+// ReadAt implements ChunkStore
+func (s *MemoryStore) ReadAt(chunkUUID string, p []byte, off int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.chunks[chunkUUID]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Delete implements ChunkStore
+func (s *MemoryStore) Delete(chunkUUID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chunks[chunkUUID]; !ok {
+		return os.ErrNotExist
+	}
+	delete(s.chunks, chunkUUID)
+	return nil
+}
+
+// Stat implements ChunkStore
+func (s *MemoryStore) Stat(chunkUUID string) (ChunkInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.chunks[chunkUUID]
+	if !ok {
+		return ChunkInfo{}, os.ErrNotExist
+	}
+	return ChunkInfo{UUID: chunkUUID, Size: int64(len(data))}, nil
+}
+
+// List implements ChunkStore
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	uuids := make([]string, 0, len(s.chunks))
+	for uuid := range s.chunks {
+		uuids = append(uuids, uuid)
+	}
+	return uuids, nil
+}
+
+// Close implements ChunkStore
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,585 @@
+package files
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jiajunhuang/hfs/pkg/logger"
+)
+
+// error definitions
+var (
+	ErrCorruptSegment = errors.New("segment file is corrupted")
+	ErrUUIDTooLong    = errors.New("UUID of chunk is too long")
+)
+
+// a segment is rolled over once it grows beyond maxSegmentSize
+var maxSegmentSize int64 = 1024 * 1024 * 1024 // 1G
+
+const (
+	segmentMagic  uint32 = 0x48465331 // "HFS1"
+	segmentSuffix        = ".seg"
+
+	// record: magic(4) | kind(1) | length of UUID(2) | length of data(8) | crc32 of data(4) | UUID | data
+	recordHeaderSize = 4 + 1 + 2 + 8 + 4
+)
+
+// kinds of record
+const (
+	recordPut    byte = 0 // data is the whole chunk
+	recordDelete byte = 1 // tombstone of chunk
+	recordAppend byte = 2 // data is appended to the chunk
+)
+
+// a piece of chunk in a segment
+type segmentExtent struct {
+	segment int
+	offset  int64 // offset of data in segment
+	size    int64
+}
+
+// location of a chunk in segments, chunks which are appended to are made of several extents
+type segmentEntry struct {
+	extents []segmentExtent
+	size    int64
+}
+
+// SegmentStore packs chunks into append-only segment files, so that small chunks don't cost a
+// file each. deleting a chunk appends a tombstone, space of it is reclaimed by Compact.
+// appending to a chunk writes only the new data, which is chained to the previous extents of
+// it. index of chunks is kept in memory and rebuilt by scanning segments when it's opened.
+type SegmentStore struct {
+	mu       sync.RWMutex
+	dir      string
+	opts     WriteOptions
+	index    map[string]segmentEntry
+	segments map[int]*os.File
+	live     map[int]int64 // bytes of records in index by segment, the rest are garbage
+	active   int           // id of segment which is appended to
+	size     int64         // size of active segment
+
+	compactMu sync.Mutex // only one Compact runs at a time
+}
+
+func segmentPath(dir string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", id, segmentSuffix))
+}
+
+// OpenSegmentStore open segments in dir and rebuild index of chunks in them. torn record at the
+// end of the last segment, which is left by crash, is truncated
+func OpenSegmentStore(dir string, opts WriteOptions) (*SegmentStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	for _, entry := range entries {
+		var id int
+		if !strings.HasSuffix(entry.Name(), segmentSuffix) {
+			continue
+		}
+		if _, err := fmt.Sscanf(entry.Name(), "%d"+segmentSuffix, &id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	s := &SegmentStore{dir: dir, opts: opts, index: map[string]segmentEntry{}, segments: map[int]*os.File{}, live: map[int]int64{}}
+	for i, id := range ids {
+		if err := s.load(id, i == len(ids)-1); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	if len(ids) == 0 {
+		if err := s.roll(1); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// load scan segment id and add chunks in it to index
+func (s *SegmentStore) load(id int, last bool) error {
+	f, err := os.OpenFile(segmentPath(s.dir, id), os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	s.segments[id] = f
+	s.active = id
+
+	var offset int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		kind, uuid, size, err := s.readRecord(f, offset, header)
+		if err == io.EOF {
+			break
+		} else if err == ErrCorruptSegment && last {
+			logger.Sugar.Warnf("truncate torn record at %d of segment %d", offset, id)
+			if err := f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		} else if err != nil {
+			return fmt.Errorf("%s: segment %d at %d", err, id, offset)
+		}
+
+		dataOffset := offset + recordHeaderSize + int64(len(uuid))
+		s.apply(uuid, kind, segmentExtent{segment: id, offset: dataOffset, size: size})
+		offset = dataOffset + size
+	}
+	s.size = offset
+
+	return nil
+}
+
+// apply a record of kind to index
+func (s *SegmentStore) apply(chunkUUID string, kind byte, extent segmentExtent) {
+	switch kind {
+	case recordDelete:
+		s.drop(chunkUUID)
+	case recordAppend:
+		entry := s.index[chunkUUID]
+		entry.extents = append(entry.extents, extent)
+		entry.size += extent.size
+		s.index[chunkUUID] = entry
+		s.live[extent.segment] += recordSize(chunkUUID, extent.size)
+	default:
+		s.drop(chunkUUID)
+		s.index[chunkUUID] = segmentEntry{extents: []segmentExtent{extent}, size: extent.size}
+		s.live[extent.segment] += recordSize(chunkUUID, extent.size)
+	}
+}
+
+// drop chunk from index, records of it become garbage
+func (s *SegmentStore) drop(chunkUUID string) {
+	for _, extent := range s.index[chunkUUID].extents {
+		s.live[extent.segment] -= recordSize(chunkUUID, extent.size)
+	}
+	delete(s.index, chunkUUID)
+}
+
+func recordSize(chunkUUID string, size int64) int64 {
+	return recordHeaderSize + int64(len(chunkUUID)) + size
+}
+
+// readRecord read the record at offset of f. it returns io.EOF if there's no more records
+func (s *SegmentStore) readRecord(f *os.File, offset int64, header []byte) (byte, string, int64, error) {
+	n, err := f.ReadAt(header, offset)
+	if n == 0 && err == io.EOF {
+		return 0, "", 0, io.EOF
+	} else if n < len(header) || binary.BigEndian.Uint32(header) != segmentMagic || header[4] > recordAppend {
+		return 0, "", 0, ErrCorruptSegment
+	}
+
+	kind := header[4]
+	uuidLen := int64(binary.BigEndian.Uint16(header[5:]))
+	size := int64(binary.BigEndian.Uint64(header[7:]))
+	checksum := binary.BigEndian.Uint32(header[15:])
+
+	// size is checked before allocating, since it comes from a possibly torn record
+	info, err := f.Stat()
+	if err != nil {
+		return 0, "", 0, err
+	}
+	if size < 0 || offset+recordHeaderSize+uuidLen+size > info.Size() {
+		return 0, "", 0, ErrCorruptSegment
+	}
+
+	buf := make([]byte, uuidLen+size)
+	if _, err := f.ReadAt(buf, offset+recordHeaderSize); err != nil {
+		return 0, "", 0, ErrCorruptSegment
+	}
+	if crc32.ChecksumIEEE(buf[uuidLen:]) != checksum {
+		return 0, "", 0, ErrCorruptSegment
+	}
+
+	return kind, string(buf[:uuidLen]), size, nil
+}
+
+// roll create segment id and make it active
+func (s *SegmentStore) roll(id int) error {
+	f, err := os.OpenFile(segmentPath(s.dir, id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if s.opts.Durability == DurabilityFull {
+		if err := SyncDir(s.dir); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	s.segments[id] = f
+	s.active, s.size = id, 0
+	return nil
+}
+
+// append write a record of kind to the end of active segment, and apply it to index
+func (s *SegmentStore) append(chunkUUID string, data []byte, kind byte) error {
+	if len(chunkUUID) > 0xffff {
+		return ErrUUIDTooLong
+	}
+
+	record := make([]byte, recordHeaderSize+len(chunkUUID)+len(data))
+	binary.BigEndian.PutUint32(record, segmentMagic)
+	record[4] = kind
+	binary.BigEndian.PutUint16(record[5:], uint16(len(chunkUUID)))
+	binary.BigEndian.PutUint64(record[7:], uint64(len(data)))
+	binary.BigEndian.PutUint32(record[15:], crc32.ChecksumIEEE(data))
+	copy(record[recordHeaderSize:], chunkUUID)
+	copy(record[recordHeaderSize+len(chunkUUID):], data)
+
+	if s.size > 0 && s.size+int64(len(record)) > maxSegmentSize {
+		if err := s.roll(s.active + 1); err != nil {
+			return err
+		}
+	}
+
+	f := s.segments[s.active]
+	if _, err := f.WriteAt(record, s.size); err != nil {
+		// drop the partial record, it will be overwritten by the next one
+		f.Truncate(s.size)
+		return err
+	}
+	if s.opts.Durability != DurabilityNone {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	offset := s.size + recordHeaderSize + int64(len(chunkUUID))
+	s.size += int64(len(record))
+	s.apply(chunkUUID, kind, segmentExtent{segment: s.active, offset: offset, size: int64(len(data))})
+	return nil
+}
+
+// Put implements ChunkStore, the whole chunk is buffered in memory
+func (s *SegmentStore) Put(chunkUUID string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.append(chunkUUID, data, recordPut)
+}
+
+// Append implements ChunkStore, only data is written as a new extent of chunk
+func (s *SegmentStore) Append(chunkUUID string, data []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset := s.index[chunkUUID].size
+	if err := s.append(chunkUUID, data, recordAppend); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// ReadAt implements ChunkStore
+func (s *SegmentStore) ReadAt(chunkUUID string, p []byte, off int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.index[chunkUUID]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	if off >= entry.size {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if length > entry.size-off {
+		length = entry.size - off
+	}
+	n := int64(0)
+	var start int64 // offset of extent in chunk
+	for _, extent := range entry.extents {
+		if n == length {
+			break
+		}
+		if pos := off + n; pos < start+extent.size {
+			end := n + start + extent.size - pos
+			if end > length {
+				end = length
+			}
+			m, err := s.segments[extent.segment].ReadAt(p[n:end], extent.offset+pos-start)
+			n += int64(m)
+			if err != nil {
+				return int(n), err
+			}
+		}
+		start += extent.size
+	}
+
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// Get implements ChunkStore
+func (s *SegmentStore) Get(chunkUUID string) ([]byte, error) {
+	info, err := s.Stat(chunkUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, info.Size)
+	n, err := s.ReadAt(chunkUUID, data, 0)
+	if err == io.EOF && int64(n) == info.Size {
+		err = nil
+	}
+	return data[:n], err
+}
+
+// Delete implements ChunkStore
+func (s *SegmentStore) Delete(chunkUUID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.index[chunkUUID]; !ok {
+		return os.ErrNotExist
+	}
+	return s.append(chunkUUID, nil, recordDelete)
+}
+
+// Stat implements ChunkStore
+func (s *SegmentStore) Stat(chunkUUID string) (ChunkInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.index[chunkUUID]
+	if !ok {
+		return ChunkInfo{}, os.ErrNotExist
+	}
+	return ChunkInfo{UUID: chunkUUID, Size: entry.size}, nil
+}
+
+// List implements ChunkStore
+func (s *SegmentStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	uuids := make([]string, 0, len(s.index))
+	for uuid := range s.index {
+		uuids = append(uuids, uuid)
+	}
+	return uuids, nil
+}
+
+// Compact rewrite chunks in segments which have at least garbage percent of records deleted or
+// overwritten into the active segment, and remove those segments. it returns how many bytes are
+// reclaimed
+func (s *SegmentStore) Compact(garbage int) (int64, error) {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	var reclaimed int64
+	for _, id := range s.garbageSegments(garbage) {
+		n, err := s.compactSegment(id)
+		if err != nil {
+			return reclaimed, fmt.Errorf("%s: segment %d", err, id)
+		}
+		reclaimed += n
+	}
+	return reclaimed, nil
+}
+
+// garbageSegments returns segments which are not active and have at least garbage percent of
+// garbage, by age
+func (s *SegmentStore) garbageSegments(garbage int) []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []int{}
+	for id, f := range s.segments {
+		if id == s.active {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			logger.Sugar.Errorf("failed to stat segment %d: %s", id, err)
+			continue
+		}
+		if (info.Size()-s.live[id])*100 >= int64(garbage)*info.Size() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// compactSegment move chunks in segment id to the active segment and remove it. chunks are moved
+// one at a time, so that reads and writes are not blocked for the whole segment. a tombstone is
+// moved too if an older segment has records of the chunk, otherwise the chunk would come back
+// when segments are loaded again
+func (s *SegmentStore) compactSegment(id int) (int64, error) {
+	s.mu.RLock()
+	f := s.segments[id]
+	moving := []string{}
+	for uuid, entry := range s.index {
+		if entry.in(id) {
+			moving = append(moving, uuid)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, uuid := range moving {
+		if err := s.move(uuid, id); err != nil {
+			return 0, err
+		}
+	}
+
+	// the segment is sealed, so it's read without lock
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	tombstones := map[string]bool{}
+	header := make([]byte, recordHeaderSize)
+	for offset := int64(0); offset < info.Size(); {
+		kind, uuid, size, err := s.readRecord(f, offset, header)
+		if err != nil {
+			return 0, err
+		}
+		if kind == recordDelete {
+			tombstones[uuid] = true
+		}
+		offset += recordSize(uuid, size)
+	}
+	if len(tombstones) > 0 {
+		if tombstones, err = s.olderRecords(id, tombstones); err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for uuid := range tombstones {
+		if _, ok := s.index[uuid]; ok {
+			continue // put again after it's deleted
+		}
+		if err := s.append(uuid, nil, recordDelete); err != nil {
+			return 0, err
+		}
+	}
+	if s.live[id] != 0 {
+		return 0, fmt.Errorf("%d bytes of chunks are left", s.live[id])
+	}
+	// moved chunks should survive crash before the segment is gone
+	if err := s.segments[s.active].Sync(); err != nil {
+		return 0, err
+	}
+
+	f.Close()
+	delete(s.segments, id)
+	delete(s.live, id)
+	if err := os.Remove(segmentPath(s.dir, id)); err != nil {
+		return 0, err
+	}
+	if s.opts.Durability == DurabilityFull {
+		if err := SyncDir(s.dir); err != nil {
+			return 0, err
+		}
+	}
+	return info.Size(), nil
+}
+
+// move rewrite chunk into the active segment if it still has extents in segment id
+func (s *SegmentStore) move(chunkUUID string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.index[chunkUUID]
+	if !ok || !entry.in(id) {
+		return nil // deleted or overwritten meanwhile
+	}
+
+	data := make([]byte, entry.size)
+	var n int64
+	for _, extent := range entry.extents {
+		if _, err := s.segments[extent.segment].ReadAt(data[n:n+extent.size], extent.offset); err != nil {
+			return err
+		}
+		n += extent.size
+	}
+	return s.append(chunkUUID, data, recordPut)
+}
+
+// olderRecords returns chunks in uuids which have records in segments older than segment id
+func (s *SegmentStore) olderRecords(id int, uuids map[string]bool) (map[string]bool, error) {
+	s.mu.RLock()
+	older := map[int]*os.File{}
+	for i, f := range s.segments {
+		if i < id {
+			older[i] = f
+		}
+	}
+	s.mu.RUnlock()
+
+	found := map[string]bool{}
+	header := make([]byte, recordHeaderSize)
+	for _, f := range older {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		for offset := int64(0); offset < info.Size(); {
+			_, uuid, size, err := s.readRecord(f, offset, header)
+			if err != nil {
+				return nil, err
+			}
+			if uuids[uuid] {
+				found[uuid] = true
+			}
+			offset += recordSize(uuid, size)
+		}
+	}
+	return found, nil
+}
+
+// in returns whether chunk has extents in segment id
+func (e segmentEntry) in(id int) bool {
+	for _, extent := range e.extents {
+		if extent.segment == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Close implements ChunkStore
+func (s *SegmentStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for id, f := range s.segments {
+		if cerr := f.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(s.segments, id)
+	}
+	return err
+}
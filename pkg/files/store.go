@@ -0,0 +1,233 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChunkStore stores data of chunks. errors of chunks which don't exist satisfy os.IsNotExist
+type ChunkStore interface {
+	// Put write chunk atomically, size is length of data or -1 if it's unknown
+	Put(chunkUUID string, r io.Reader, size int64) error
+	// Append write data to the end of chunk, chunk is created if it doesn't exist. it returns
+	// offset of data in chunk
+	Append(chunkUUID string, data []byte) (int64, error)
+	// Get returns all the data of chunk
+	Get(chunkUUID string) ([]byte, error)
+	// ReadAt read len(p) bytes of chunk starts at off, it works like io.ReaderAt
+	ReadAt(chunkUUID string, p []byte, off int64) (int, error)
+	Delete(chunkUUID string) error
+	Stat(chunkUUID string) (ChunkInfo, error)
+	// List returns UUID of all the chunks
+	List() ([]string, error)
+	Close() error
+}
+
+// ChunkInfo describes a chunk in ChunkStore
+type ChunkInfo struct {
+	UUID string
+	Size int64
+}
+
+// kinds of ChunkStore
+const (
+	StoreFlat    = "flat"    // a file per chunk, all in one directory
+	StoreHashed  = "hashed"  // a file per chunk, in two levels of subdirectories by hash of UUID
+	StoreSegment = "segment" // chunks are packed into append-only segment files
+	StoreMemory  = "memory"  // chunks are kept in memory, for tests
+)
+
+// error definitions
+var (
+	ErrUnknownStore = errors.New("unknown kind of chunk store")
+)
+
+// NewChunkStore returns a ChunkStore of kind which stores chunks in dir
+func NewChunkStore(kind string, dir string, opts WriteOptions) (ChunkStore, error) {
+	switch kind {
+	case StoreFlat:
+		return NewFlatStore(dir, opts), nil
+	case StoreHashed:
+		return NewHashedStore(dir, opts), nil
+	case StoreSegment:
+		return OpenSegmentStore(dir, opts)
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	}
+
+	return nil, fmt.Errorf("%s: %s", ErrUnknownStore, kind)
+}
+
+// FileStore stores chunks as plain files in a directory, or in subdirectories of it so that
+// there are not too many files in one directory
+type FileStore struct {
+	dir    string
+	hashed bool
+	opts   WriteOptions
+}
+
+// NewFlatStore returns a FileStore which stores chunks in dir
+func NewFlatStore(dir string, opts WriteOptions) *FileStore {
+	return &FileStore{dir: filepath.Clean(dir), opts: opts}
+}
+
+// NewHashedStore returns a FileStore which stores chunks in dir/xx/yy/, xx and yy come from
+// hash of UUID of chunk
+func NewHashedStore(dir string, opts WriteOptions) *FileStore {
+	return &FileStore{dir: filepath.Clean(dir), hashed: true, opts: opts}
+}
+
+// Path returns path of chunk
+func (s *FileStore) Path(chunkUUID string) string {
+	if !s.hashed {
+		return filepath.Join(s.dir, chunkUUID)
+	}
+
+	h := crc32.ChecksumIEEE([]byte(chunkUUID))
+	return filepath.Join(s.dir, fmt.Sprintf("%02x", h>>24), fmt.Sprintf("%02x", h>>16&0xff), chunkUUID)
+}
+
+// mkdir create subdirectories of chunk for hashed layout
+func (s *FileStore) mkdir(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if s.opts.Durability == DurabilityFull {
+		if err := SyncDir(filepath.Dir(dir)); err != nil {
+			return err
+		}
+		return SyncDir(s.dir)
+	}
+
+	return nil
+}
+
+// Put implements ChunkStore, temporary files are always written in the top directory so that
+// they can be found easily after crash
+func (s *FileStore) Put(chunkUUID string, r io.Reader, size int64) error {
+	path := s.Path(chunkUUID)
+	if s.hashed {
+		if err := s.mkdir(path); err != nil {
+			return err
+		}
+	}
+
+	return writeAtomic(s.dir, path, r, size, s.opts)
+}
+
+// Append implements ChunkStore
+func (s *FileStore) Append(chunkUUID string, data []byte) (int64, error) {
+	path := s.Path(chunkUUID)
+	if s.hashed {
+		if err := s.mkdir(path); err != nil {
+			return 0, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	offset := info.Size()
+
+	if _, err := f.WriteAt(data, offset); err != nil {
+		f.Truncate(offset)
+		return 0, err
+	}
+	if s.opts.Durability != DurabilityNone {
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	if offset == 0 && s.opts.Durability == DurabilityFull {
+		if err := SyncDir(filepath.Dir(path)); err != nil {
+			return 0, err
+		}
+	}
+
+	return offset, nil
+}
+
+// ReadAt implements ChunkStore
+func (s *FileStore) ReadAt(chunkUUID string, p []byte, off int64) (int, error) {
+	f, err := os.Open(s.Path(chunkUUID))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return f.ReadAt(p, off)
+}
+
+// Get implements ChunkStore
+func (s *FileStore) Get(chunkUUID string) ([]byte, error) {
+	return ioutil.ReadFile(s.Path(chunkUUID))
+}
+
+// Delete implements ChunkStore
+func (s *FileStore) Delete(chunkUUID string) error {
+	path := s.Path(chunkUUID)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if s.opts.Durability == DurabilityFull {
+		return SyncDir(filepath.Dir(path))
+	}
+
+	return nil
+}
+
+// Stat implements ChunkStore
+func (s *FileStore) Stat(chunkUUID string) (ChunkInfo, error) {
+	info, err := os.Stat(s.Path(chunkUUID))
+	if err != nil {
+		return ChunkInfo{}, err
+	}
+
+	return ChunkInfo{UUID: chunkUUID, Size: info.Size()}, nil
+}
+
+// List implements ChunkStore
+func (s *FileStore) List() ([]string, error) {
+	uuids := []string{}
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// flat layout has no subdirectory, and hashed layout has exactly two levels
+			if path != s.dir && (!s.hashed || strings.Count(path[len(s.dir):], string(filepath.Separator)) > 2) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(info.Name(), tempPrefix) {
+			uuids = append(uuids, info.Name())
+		}
+		return nil
+	})
+
+	return uuids, err
+}
+
+// Close implements ChunkStore
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,393 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func newTestStore(t testing.TB, opts WriteOptions) (*FileStore, func()) {
+	dir, err := ioutil.TempDir("", "hfs-store")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+
+	return NewFlatStore(dir, opts), func() { os.RemoveAll(dir) }
+}
+
+func TestFileStore(t *testing.T) {
+	for _, opts := range []WriteOptions{
+		{},
+		{Durability: DurabilityFull, Fallocate: true},
+		{Durability: DurabilityData, Fallocate: true, DirectIO: true},
+	} {
+		store, cleanup := newTestStore(t, opts)
+		defer cleanup()
+
+		// not aligned, and longer than one buffer
+		data := make([]byte, bufSize+3*directAlign+123)
+		rand.Read(data)
+		if err := store.Put("chunk", bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("failed to put chunk with %+v: %s", opts, err)
+		}
+		if b, err := store.Get("chunk"); err != nil || !bytes.Equal(b, data) {
+			t.Fatalf("should get what was put with %+v, err: %v", opts, err)
+		}
+
+		p := make([]byte, 200)
+		if n, err := store.ReadAt("chunk", p, int64(len(data)-100)); err != io.EOF || !bytes.Equal(p[:n], data[len(data)-100:]) {
+			t.Fatalf("should read the tail with EOF with %+v but got %d bytes, err: %v", opts, n, err)
+		}
+
+		// size is only a hint
+		if err := store.Put("short", bytes.NewReader(data[:10]), int64(len(data))); err != nil {
+			t.Fatalf("failed to put chunk with %+v: %s", opts, err)
+		}
+		if info, err := store.Stat("short"); err != nil || info.Size != 10 {
+			t.Fatalf("chunk shorter than size hint should be kept as is with %+v, err: %v", opts, err)
+		}
+
+		if _, err := store.Get("not-exist"); !os.IsNotExist(err) {
+			t.Fatalf("should not get chunk not exist but got %v", err)
+		}
+	}
+}
+
+func TestChunkStores(t *testing.T) {
+	for _, kind := range []string{StoreFlat, StoreHashed, StoreSegment, StoreMemory} {
+		dir, err := ioutil.TempDir("", "hfs-store")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		store, err := NewChunkStore(kind, dir, WriteOptions{Durability: DurabilityFull})
+		if err != nil {
+			t.Fatalf("failed to open %s store: %s", kind, err)
+		}
+		for _, uuid := range []string{"chunk-1", "chunk-2", "chunk-3"} {
+			if err := store.Put(uuid, bytes.NewReader([]byte(uuid)), -1); err != nil {
+				t.Fatalf("failed to put %s into %s store: %s", uuid, kind, err)
+			}
+		}
+		if err := store.Put("chunk-2", bytes.NewReader([]byte("overwritten")), -1); err != nil {
+			t.Fatalf("failed to overwrite chunk-2 in %s store: %s", kind, err)
+		}
+		for i, part := range []string{"pack", "ed"} {
+			if offset, err := store.Append("chunk-4", []byte(part)); err != nil || offset != int64(i*4) {
+				t.Fatalf("should append %s at %d of %s store but got %d, err: %v", part, i*4, kind, offset, err)
+			}
+		}
+		if b, err := store.Get("chunk-4"); err != nil || string(b) != "packed" {
+			t.Fatalf("should get appended chunk-4 from %s store but got %s, err: %v", kind, b, err)
+		}
+		store.Delete("chunk-4")
+
+		if err := store.Delete("chunk-3"); err != nil {
+			t.Fatalf("failed to delete chunk-3 in %s store: %s", kind, err)
+		}
+		if err := store.Delete("chunk-3"); !os.IsNotExist(err) {
+			t.Fatalf("chunk-3 should not exist in %s store but got %v", kind, err)
+		}
+
+		if b, err := store.Get("chunk-2"); err != nil || string(b) != "overwritten" {
+			t.Fatalf("should get overwritten chunk-2 from %s store but got %s, err: %v", kind, b, err)
+		}
+		p := make([]byte, 5)
+		if n, err := store.ReadAt("chunk-1", p, 3); err != io.EOF || string(p[:n]) != "nk-1" {
+			t.Fatalf("should read nk-1 from %s store but got %s, err: %v", kind, p[:n], err)
+		}
+		if _, err := store.Stat("chunk-3"); !os.IsNotExist(err) {
+			t.Fatalf("chunk-3 should not exist in %s store but got %v", kind, err)
+		}
+		uuids, err := store.List()
+		sort.Strings(uuids)
+		if err != nil || len(uuids) != 2 || uuids[0] != "chunk-1" || uuids[1] != "chunk-2" {
+			t.Fatalf("should list chunk-1 and chunk-2 in %s store but got %v, err: %v", kind, uuids, err)
+		}
+
+		if err := store.Close(); err != nil {
+			t.Fatalf("failed to close %s store: %s", kind, err)
+		}
+	}
+
+	if _, err := NewChunkStore("nfs", "/tmp", WriteOptions{}); err == nil {
+		t.Fatalf("should not open unknown store")
+	}
+}
+
+func TestSegmentStoreReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hfs-store")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(size int64) { maxSegmentSize = size }(maxSegmentSize)
+	maxSegmentSize = 100
+
+	store, err := OpenSegmentStore(dir, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to open segment store: %s", err)
+	}
+	data := bytes.Repeat([]byte("x"), 50)
+	for _, uuid := range []string{"chunk-1", "chunk-2", "chunk-3"} {
+		if err := store.Put(uuid, bytes.NewReader(data), -1); err != nil {
+			t.Fatalf("failed to put %s: %s", uuid, err)
+		}
+	}
+	store.Delete("chunk-1")
+	store.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	// every record is larger than half of segment, the tombstone goes to the fourth one
+	if len(segments) != 4 {
+		t.Fatalf("segments should be rolled over but got %v", segments)
+	}
+
+	// torn record left by crash
+	f, err := os.OpenFile(segments[3], os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("failed to open segment: %s", err)
+	}
+	f.Write([]byte("torn"))
+	f.Close()
+
+	store, err = OpenSegmentStore(dir, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to reopen segment store: %s", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Stat("chunk-1"); !os.IsNotExist(err) {
+		t.Fatalf("deleted chunk should not exist after reopen but got %v", err)
+	}
+	for _, uuid := range []string{"chunk-2", "chunk-3"} {
+		if b, err := store.Get(uuid); err != nil || !bytes.Equal(b, data) {
+			t.Fatalf("should get %s after reopen, err: %v", uuid, err)
+		}
+	}
+	if err := store.Put("chunk-4", bytes.NewReader(data), -1); err != nil {
+		t.Fatalf("failed to put after reopen: %s", err)
+	}
+	if b, err := store.Get("chunk-4"); err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("should get chunk-4, err: %v", err)
+	}
+}
+
+func TestSegmentStoreAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hfs-store")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(size int64) { maxSegmentSize = size }(maxSegmentSize)
+	maxSegmentSize = 100
+
+	store, err := OpenSegmentStore(dir, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to open segment store: %s", err)
+	}
+	data := []byte{}
+	for i := 0; i < 10; i++ {
+		part := bytes.Repeat([]byte{byte('a' + i)}, 10)
+		if offset, err := store.Append("pack", part); err != nil || offset != int64(len(data)) {
+			t.Fatalf("should append at %d but got %d, err: %v", len(data), offset, err)
+		}
+		data = append(data, part...)
+	}
+	store.Close()
+
+	// only the appended data is written, in extents over several segments
+	var written int64
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	for _, path := range segments {
+		info, _ := os.Stat(path)
+		written += info.Size()
+	}
+	if len(segments) < 2 || written != int64(10*(recordHeaderSize+len("pack")+10)) {
+		t.Fatalf("appends should be chained over segments but got %d bytes in %v", written, segments)
+	}
+
+	store, err = OpenSegmentStore(dir, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to reopen segment store: %s", err)
+	}
+	defer store.Close()
+	if b, err := store.Get("pack"); err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("should get %s after reopen but got %s, err: %v", data, b, err)
+	}
+	p := make([]byte, 25)
+	if n, err := store.ReadAt("pack", p, 15); err != nil || !bytes.Equal(p[:n], data[15:40]) {
+		t.Fatalf("should read %s across extents but got %s, err: %v", data[15:40], p[:n], err)
+	}
+	if n, err := store.ReadAt("pack", p, 90); err != io.EOF || !bytes.Equal(p[:n], data[90:]) {
+		t.Fatalf("should read %s with EOF but got %s, err: %v", data[90:], p[:n], err)
+	}
+
+	// put replaces all the extents
+	if err := store.Put("pack", bytes.NewReader([]byte("new")), -1); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if b, err := store.Get("pack"); err != nil || string(b) != "new" {
+		t.Fatalf("should get new but got %s, err: %v", b, err)
+	}
+}
+
+func TestSegmentStoreCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hfs-store")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(size int64) { maxSegmentSize = size }(maxSegmentSize)
+	maxSegmentSize = 100
+	size := func() int64 {
+		var n int64
+		segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+		for _, path := range segments {
+			info, _ := os.Stat(path)
+			n += info.Size()
+		}
+		return n
+	}
+
+	store, err := OpenSegmentStore(dir, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to open segment store: %s", err)
+	}
+	// 2 chunks in a segment: chunk-1 and chunk-2 in the first one, chunk-3, chunk-4 and the
+	// tombstone of chunk-1 in the second one, and the tombstone of chunk-3 in the third one
+	data := bytes.Repeat([]byte("x"), 10)
+	for _, uuid := range []string{"chunk-1", "chunk-2", "chunk-3", "chunk-4"} {
+		if err := store.Put(uuid, bytes.NewReader(data), -1); err != nil {
+			t.Fatalf("failed to put %s: %s", uuid, err)
+		}
+	}
+	store.Delete("chunk-1")
+	store.Delete("chunk-3")
+
+	// only the second segment has enough garbage, the tombstone of chunk-1 in it is kept since
+	// the first segment is kept
+	before := size()
+	if n, err := store.Compact(60); err != nil || n != 2*recordSize("chunk-1", 10)+recordSize("chunk-1", 0) {
+		t.Fatalf("the second segment should be reclaimed but got %d bytes, err: %v", n, err)
+	}
+	if _, err := os.Stat(segmentPath(dir, 2)); !os.IsNotExist(err) {
+		t.Fatalf("the second segment should be removed but got %v", err)
+	}
+	if after := size(); after >= before {
+		t.Fatalf("segments should shrink from %d bytes but got %d", before, after)
+	}
+	store.Close()
+
+	store, err = OpenSegmentStore(dir, WriteOptions{})
+	if err != nil {
+		t.Fatalf("failed to reopen segment store: %s", err)
+	}
+	defer func() { store.Close() }()
+	uuids, _ := store.List()
+	sort.Strings(uuids)
+	if len(uuids) != 2 || uuids[0] != "chunk-2" || uuids[1] != "chunk-4" {
+		t.Fatalf("deleted chunks should not come back after reopen but got %v", uuids)
+	}
+	for _, uuid := range uuids {
+		if b, err := store.Get(uuid); err != nil || !bytes.Equal(b, data) {
+			t.Fatalf("should get %s after compaction, err: %v", uuid, err)
+		}
+	}
+
+	// once all the chunks are deleted, only the active segment is left
+	store.Delete("chunk-2")
+	store.Delete("chunk-4")
+	if _, err := store.Compact(1); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segments) != 1 || size() > maxSegmentSize {
+		t.Fatalf("only the active segment should be left but got %v in %d bytes", segments, size())
+	}
+	store.Close()
+	if store, err = OpenSegmentStore(dir, WriteOptions{}); err != nil {
+		t.Fatalf("failed to reopen segment store: %s", err)
+	}
+	if uuids, _ := store.List(); len(uuids) != 0 {
+		t.Fatalf("deleted chunks should not come back after reopen but got %v", uuids)
+	}
+}
+
+const benchChunkSize = 16 * 1024 * 1024
+
+func benchmarkPut(b *testing.B, opts WriteOptions) {
+	store, cleanup := newTestStore(b, opts)
+	defer cleanup()
+
+	data := make([]byte, benchChunkSize)
+	rand.Read(data)
+	b.SetBytes(benchChunkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// hide bytes.Reader so that data is copied through buffer
+		if err := store.Put("chunk", struct{ io.Reader }{bytes.NewReader(data)}, benchChunkSize); err != nil {
+			b.Fatalf("failed to put chunk: %s", err)
+		}
+	}
+}
+
+func BenchmarkPutBuffered(b *testing.B) {
+	benchmarkPut(b, WriteOptions{Durability: DurabilityNone})
+}
+
+func BenchmarkPutFallocate(b *testing.B) {
+	benchmarkPut(b, WriteOptions{Durability: DurabilityNone, Fallocate: true})
+}
+
+func BenchmarkPutDirectIO(b *testing.B) {
+	benchmarkPut(b, WriteOptions{Durability: DurabilityNone, Fallocate: true, DirectIO: true})
+}
+
+func BenchmarkPutFsync(b *testing.B) {
+	benchmarkPut(b, WriteOptions{Durability: DurabilityFull, Fallocate: true})
+}
+
+func BenchmarkAppend(b *testing.B) {
+	store, cleanup := newTestStore(b, WriteOptions{})
+	defer cleanup()
+
+	data := make([]byte, benchChunkSize)
+	b.SetBytes(benchChunkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := Append(store.Path("chunk"), bytes.NewReader(data)); err != nil {
+			b.Fatalf("failed to append: %s", err)
+		}
+	}
+}
+
+func BenchmarkReadAt(b *testing.B) {
+	store, cleanup := newTestStore(b, WriteOptions{})
+	defer cleanup()
+
+	data := make([]byte, benchChunkSize)
+	if err := store.Put("chunk", bytes.NewReader(data), benchChunkSize); err != nil {
+		b.Fatalf("failed to put chunk: %s", err)
+	}
+	p := make([]byte, benchChunkSize)
+	b.SetBytes(benchChunkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := store.ReadAt("chunk", p, 0); err != nil {
+			b.Fatalf("failed to read chunk: %s", err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package hfsclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/jiajunhuang/hfs/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// endpoint is a connection to one chunkserver
+type endpoint struct {
+	addr      string
+	conn      *grpc.ClientConn
+	client    pb.ChunkServerClient
+	downUntil time.Time // endpoint will not be picked before it unless all the others are down too
+}
+
+func (e *endpoint) healthy(now time.Time) bool {
+	return now.After(e.downUntil) && e.conn.GetState() != connectivity.TransientFailure
+}
+
+// pool holds endpoints of chunkservers, it load balances requests in round robin, and skips
+// endpoints which are down
+type pool struct {
+	mu          sync.Mutex
+	endpoints   map[string]*endpoint // addr -> endpoint
+	workers     map[string]string    // worker name -> addr, only used by discovery
+	order       []*endpoint
+	next        int
+	cooldown    time.Duration
+	rediscover  time.Duration // workers are listed and watched again after it once the watch is closed
+	dialOptions []grpc.DialOption
+}
+
+func newPool(cooldown time.Duration, dialOptions []grpc.DialOption) *pool {
+	return &pool{
+		endpoints:   map[string]*endpoint{},
+		workers:     map[string]string{},
+		cooldown:    cooldown,
+		rediscover:  rediscoverInterval,
+		dialOptions: dialOptions,
+	}
+}
+
+// set replace addresses in pool with addrs, connections to addresses which still exist are kept
+func (p *pool) set(addrs []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	endpoints := map[string]*endpoint{}
+	order := []*endpoint{}
+	for _, addr := range addrs {
+		if _, ok := endpoints[addr]; ok {
+			continue
+		}
+
+		e, ok := p.endpoints[addr]
+		if !ok {
+			conn, err := grpc.Dial(addr, p.dialOptions...)
+			if err != nil {
+				return err
+			}
+			e = &endpoint{addr: addr, conn: conn, client: pb.NewChunkServerClient(conn)}
+		}
+		endpoints[addr] = e
+		order = append(order, e)
+	}
+
+	for addr, e := range p.endpoints {
+		if _, ok := endpoints[addr]; !ok {
+			e.conn.Close()
+		}
+	}
+	p.endpoints, p.order = endpoints, order
+
+	return nil
+}
+
+// pick returns the next healthy endpoint, or the next one if all of them are down
+func (p *pool) pick() (*endpoint, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.order) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	now := time.Now()
+	for i := 0; i < len(p.order); i++ {
+		e := p.order[(p.next+i)%len(p.order)]
+		if e.healthy(now) {
+			p.next = (p.next + i + 1) % len(p.order)
+			return e, nil
+		}
+	}
+
+	e := p.order[p.next%len(p.order)]
+	p.next = (p.next + 1) % len(p.order)
+	return e, nil
+}
+
+// markDown stop picking e for a while
+func (p *pool) markDown(e *endpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.downUntil = time.Now().Add(p.cooldown)
+}
+
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for _, e := range p.endpoints {
+		if cerr := e.conn.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	p.endpoints, p.order = map[string]*endpoint{}, nil
+
+	return err
+}
+
+// default interval of rediscovering workers after the watch is closed
+var rediscoverInterval = time.Second
+
+// updateWorker apply changes of worker name to pool, addr is empty if the worker is gone
+func (p *pool) updateWorker(name string, addr string) error {
+	p.mu.Lock()
+	if addr == "" {
+		delete(p.workers, name)
+	} else {
+		p.workers[name] = addr
+	}
+	addrs := p.workerAddrs()
+	p.mu.Unlock()
+
+	return p.set(addrs)
+}
+
+// workerAddrs returns addresses of all the workers, p.mu must be held
+func (p *pool) workerAddrs() []string {
+	addrs := make([]string, 0, len(p.workers))
+	for _, addr := range p.workers {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// discover load chunkservers registered under prefix in etcd, and keep watching changes of them
+// until ctx is done
+func (p *pool) discover(ctx context.Context, etcdClient *clientv3.Client, prefix string) error {
+	rev, err := p.list(ctx, etcdClient, prefix)
+	if err != nil {
+		return err
+	}
+
+	go p.watch(ctx, etcdClient, prefix, rev)
+	return nil
+}
+
+// list replace workers in pool with the ones registered under prefix, it returns the revision
+// they're read at
+func (p *pool) list(ctx context.Context, etcdClient *clientv3.Client, prefix string) (int64, error) {
+	getCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	resp, err := etcdClient.Get(getCtx, prefix, clientv3.WithPrefix())
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	workers := map[string]string{}
+	for _, kv := range resp.Kvs {
+		workers[workerName(kv.Key)] = string(kv.Value)
+	}
+	p.mu.Lock()
+	p.workers = workers
+	addrs := p.workerAddrs()
+	p.mu.Unlock()
+
+	return resp.Header.Revision, p.set(addrs)
+}
+
+// watch apply changes of workers under prefix after rev until ctx is done. the watch is closed
+// if the revision is compacted, or etcd is unreachable for a while, then workers are listed and
+// watched again
+func (p *pool) watch(ctx context.Context, etcdClient *clientv3.Client, prefix string, rev int64) {
+	for {
+		watchCtx, cancel := context.WithCancel(ctx)
+		for resp := range etcdClient.Watch(watchCtx, prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1)) {
+			if resp.Err() != nil {
+				break
+			}
+			for _, ev := range resp.Events {
+				addr := ""
+				if ev.Type == mvccpb.PUT {
+					addr = string(ev.Kv.Value)
+				}
+				// dial is non-blocking, so it never fails with our dial options
+				p.updateWorker(workerName(ev.Kv.Key), addr)
+			}
+		}
+		cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.rediscover):
+			}
+
+			var err error
+			if rev, err = p.list(ctx, etcdClient, prefix); err == nil {
+				break
+			}
+		}
+	}
+}
+
+func workerName(key []byte) string {
+	workerFullPath := strings.Split(string(key), "/")
+	return workerFullPath[len(workerFullPath)-1]
+}
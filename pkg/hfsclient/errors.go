@@ -0,0 +1,98 @@
+package hfsclient
+
+import (
+	"fmt"
+
+	"github.com/jiajunhuang/hfs/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is an error of RPC, returned by a chunkserver, or by gRPC if no chunkserver can be
+// reached. it can be inspected by IsNotFound and friends, or by fields of it
+type Error struct {
+	Code     codes.Code
+	Message  string
+	Reason   string // why chunkserver fails, like QuotaExceeded. empty if it's not from a chunkserver
+	Resource string // file, chunk or user the error is about, may be empty
+	Node     string // name of chunkserver which returns the error
+
+	status *status.Status
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Node == "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s (chunkserver %s)", e.Code, e.Message, e.Node)
+}
+
+// GRPCStatus returns the origin gRPC status, so that status.Code works on Error
+func (e *Error) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// Temporary returns whether the RPC may succeed if it's retried
+func (e *Error) Temporary() bool {
+	return e.Code == codes.Unavailable || e.Code == codes.Aborted
+}
+
+// fromChunkserver returns whether the error is returned by a chunkserver, instead of by gRPC
+// because the chunkserver can't be reached
+func (e *Error) fromChunkserver() bool {
+	return e.Node != ""
+}
+
+// wrapError convert gRPC status into *Error, other errors are returned as is
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	e := &Error{Code: st.Code(), Message: st.Message(), status: st}
+	for _, d := range st.Details() {
+		if d, ok := d.(*pb.ErrorDetail); ok {
+			e.Reason, e.Resource, e.Node = d.Reason, d.Resource, d.Node
+		}
+	}
+	return e
+}
+
+func codeOf(err error) codes.Code {
+	if e, ok := wrapError(err).(*Error); ok {
+		return e.Code
+	}
+	return codes.Unknown
+}
+
+// IsNotFound returns whether err is caused by a file or chunk which doesn't exist
+func IsNotFound(err error) bool {
+	return codeOf(err) == codes.NotFound
+}
+
+// IsPermissionDenied returns whether err is caused by the client isn't authenticated, or isn't
+// allowed to do it
+func IsPermissionDenied(err error) bool {
+	code := codeOf(err)
+	return code == codes.PermissionDenied || code == codes.Unauthenticated
+}
+
+// IsQuotaExceeded returns whether err is caused by owner of file runs out of quota
+func IsQuotaExceeded(err error) bool {
+	e, ok := wrapError(err).(*Error)
+	return ok && e.Code == codes.ResourceExhausted && e.Reason == "QuotaExceeded"
+}
+
+// IsTemporary returns whether err is transient, the request may succeed if it's retried
+func IsTemporary(err error) bool {
+	e, ok := wrapError(err).(*Error)
+	return ok && e.Temporary()
+}
@@ -0,0 +1,398 @@
+package hfsclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/codec"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/crypt"
+)
+
+// error definitions
+var (
+	ErrInvalidWhence  = errors.New("invalid whence")
+	ErrNegativeOffset = errors.New("negative offset")
+)
+
+// Writer writes a new file into hfs, data will be cut into chunks. the file will only be
+// created after Close returns successfully
+type Writer struct {
+	name       string
+	codec      string
+	mode       uint32
+	acl        []*pb.Grant
+	encryption *pb.Encryption // nil if the file is not encrypted
+	cipher     *crypt.Cipher
+	chunks     int // how many chunks are sent
+	stream     pb.ChunkServer_CreateFileClient
+	cancel     context.CancelFunc
+	buf        []byte
+	file       *pb.File
+	err        error
+	closed     bool
+}
+
+// Create returns a Writer which creates a file named name, it's encrypted if the client is
+// created with WithEncryption
+func (c *Client) Create(ctx context.Context, name string) (*Writer, error) {
+	w := &Writer{name: name, codec: c.codec, mode: c.mode, acl: c.acl}
+	if c.encrypt {
+		var err error
+		if w.encryption, w.cipher, err = c.key.NewFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var stream pb.ChunkServer_CreateFileClient
+	err := c.retry(ctx, func(e *endpoint) error {
+		var err error
+		stream, err = e.client.CreateFile(ctx)
+		return err
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	w.stream, w.cancel = stream, cancel
+	return w, nil
+}
+
+// Write implements io.Writer
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.buf == nil {
+		// encrypted chunks should still fit in ChunkSize
+		size := config.ChunkSize
+		if w.cipher != nil {
+			size -= crypt.Overhead
+		}
+		w.buf = make([]byte, 0, size)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is sent once more data comes, so that the last chunk is known when it's sealed
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// flush send buffered data as a chunk, last is whether it's the last chunk of file
+func (w *Writer) flush(last bool) error {
+	data := &pb.FileChunkData{Data: w.buf, Msg: w.name, Codec: w.codec}
+	if w.cipher != nil {
+		data.Data = w.cipher.Seal(w.chunks, last, w.buf)
+	}
+	if w.chunks == 0 {
+		data.Encryption, data.Mode, data.Acl = w.encryption, w.mode, w.acl
+	}
+	if err := w.stream.Send(data); err != nil {
+		// the stream is closed by chunkserver, the real error comes with the response
+		if err == io.EOF {
+			_, err = w.stream.CloseAndRecv()
+		}
+		w.err = wrapError(err)
+		return w.err
+	}
+	uploadedBytes.Add(float64(len(data.Data)))
+	w.buf = w.buf[:0]
+	w.chunks++
+
+	return nil
+}
+
+// Close flush buffered data and commit the file
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	defer w.cancel()
+
+	if w.err != nil {
+		return w.err
+	}
+	// an empty encrypted file still has the last chunk, so that dropping all of it's chunks is detected
+	if len(w.buf) > 0 || (w.cipher != nil && w.chunks == 0) {
+		if err := w.flush(true); err != nil {
+			return err
+		}
+	}
+
+	resp, err := w.stream.CloseAndRecv()
+	if err != nil {
+		w.err = wrapError(err)
+		return w.err
+	}
+	w.file = resp.File
+
+	return nil
+}
+
+// Abort cancel the upload, the file will not be created
+func (w *Writer) Abort() {
+	w.closed = true
+	w.cancel()
+}
+
+// File returns metadata of the created file, it's nil until Close returns successfully
+func (w *Writer) File() *pb.File {
+	return w.file
+}
+
+// Reader reads a file in hfs, it implements io.Reader, io.ReaderAt, io.Seeker, io.WriterTo
+// and io.Closer. it's not safe for concurrent use except ReadAt.
+type Reader struct {
+	ctx     context.Context
+	client  *Client
+	file    *pb.File
+	cipher  *crypt.Cipher // nil if the file is not encrypted
+	size    int64         // size of file, File.Size includes overhead of encryption
+	sizes   []int64       // size of every chunk
+	offsets []int64       // offset of every chunk in file
+
+	pos    int64
+	buf    []byte // cache of chunk data, starts at bufOff of file
+	bufOff int64
+	closed bool
+}
+
+// Open returns a Reader of file with fileUUID
+func (c *Client) Open(ctx context.Context, fileUUID string) (*Reader, error) {
+	file, err := c.Stat(ctx, fileUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{ctx: ctx, client: c, file: file, sizes: make([]int64, len(file.Chunks)), offsets: make([]int64, len(file.Chunks))}
+	var overhead int64
+	if file.Encryption != nil {
+		if c.key == nil {
+			return nil, crypt.ErrNoKey
+		}
+		if r.cipher, err = c.key.Open(file.Encryption); err != nil {
+			return nil, err
+		}
+		overhead = crypt.Overhead
+		// every encrypted file has the last chunk, all of them are dropped otherwise
+		if len(file.Chunks) == 0 {
+			return nil, ErrTruncated
+		}
+	}
+
+	var stored int64
+	for i, chunk := range file.Chunks {
+		if chunk.Used < overhead {
+			return nil, ErrTruncated
+		}
+		r.sizes[i], r.offsets[i] = chunk.Used-overhead, r.size
+		r.size += r.sizes[i]
+		stored += chunk.Used
+	}
+	if stored != file.Size {
+		return nil, ErrTruncated
+	}
+
+	return r, nil
+}
+
+// Stat returns metadata of the file
+func (r *Reader) Stat() *pb.File {
+	return r.file
+}
+
+// Size returns size of the file, it's less than Stat().Size if the file is encrypted
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// chunkAt returns index of chunk which contains offset off of file
+func (r *Reader) chunkAt(off int64) int {
+	return sort.Search(len(r.offsets), func(i int) bool { return r.offsets[i] > off }) - 1
+}
+
+// readChunk read at most length bytes starts at off of the i-th chunk. compressed or encrypted
+// chunks are fetched and decoded as a whole
+func (r *Reader) readChunk(i int, off int64, length int64) ([]byte, error) {
+	chunk := r.file.Chunks[i]
+	if chunk.Codec == codec.None && r.cipher == nil {
+		return r.fetchChunk(chunk, off, length)
+	}
+
+	var data []byte
+	var err error
+	if chunk.Codec == codec.None {
+		data, err = r.fetchChunk(chunk, 0, chunk.Used)
+	} else if data, err = r.fetchChunk(chunk, 0, chunk.CompressedSize); err == nil {
+		data, err = codec.Decompress(chunk.Codec, data, chunk.Used)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.cipher != nil {
+		if data, err = r.cipher.Open(i, i == len(r.file.Chunks)-1, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data[off : off+length], nil
+}
+
+// fetchChunk read length bytes of data stored in chunk starts at off
+func (r *Reader) fetchChunk(chunk *pb.Chunk, off int64, length int64) ([]byte, error) {
+	var data []byte
+	err := r.client.call(r.ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+		// files smaller than PackThreshold share pack chunks, they start at Offset of chunk
+		resp, err := client.ReadChunk(ctx, &pb.ReadChunkRequest{ChunkUUID: chunk.UUID, Offset: chunk.Offset + off, Length: length, FileUUID: r.file.UUID})
+		if err != nil {
+			return err
+		}
+		data = resp.Data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	downloadedBytes.Add(float64(len(data)))
+	if int64(len(data)) != length {
+		return nil, ErrTruncated
+	}
+
+	return data, nil
+}
+
+// ReadAt implements io.ReaderAt
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		i := r.chunkAt(off)
+		chunkOff := off - r.offsets[i]
+		length := r.sizes[i] - chunkOff
+		if remain := int64(len(p) - n); length > remain {
+			length = remain
+		}
+
+		data, err := r.readChunk(i, chunkOff, length)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data)
+		off += length
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read implements io.Reader, the rest of current chunk will be fetched and cached at once
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.pos < r.bufOff || r.pos >= r.bufOff+int64(len(r.buf)) {
+		i := r.chunkAt(r.pos)
+		chunkOff := r.pos - r.offsets[i]
+		data, err := r.readChunk(i, chunkOff, r.sizes[i]-chunkOff)
+		if err != nil {
+			return 0, err
+		}
+		r.buf, r.bufOff = data, r.pos
+	}
+
+	n := copy(p, r.buf[r.pos-r.bufOff:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// WriteTo implements io.WriterTo, it writes chunk by chunk without extra copy
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		if r.pos < r.bufOff || r.pos >= r.bufOff+int64(len(r.buf)) {
+			if r.pos >= r.size {
+				return written, nil
+			}
+			// fill the cache
+			if _, err := r.Read(nil); err != nil {
+				return written, err
+			}
+		}
+
+		n, err := w.Write(r.buf[r.pos-r.bufOff:])
+		written += int64(n)
+		r.pos += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// Seek implements io.Seeker
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, ErrInvalidWhence
+	}
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+	r.pos = offset
+
+	return offset, nil
+}
+
+// Close implements io.Closer
+func (r *Reader) Close() error {
+	if r.closed {
+		return ErrClosed
+	}
+	r.closed = true
+	r.buf = nil
+
+	return nil
+}
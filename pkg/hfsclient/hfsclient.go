@@ -2,112 +2,559 @@ package hfsclient
 
 import (
 	"context"
-	"fmt"
+	"crypto/tls"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/coreos/etcd/clientv3"
 	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/auth"
+	"github.com/jiajunhuang/hfs/pkg/codec"
 	"github.com/jiajunhuang/hfs/pkg/config"
-	"github.com/jiajunhuang/hfs/pkg/logger"
+	"github.com/jiajunhuang/hfs/pkg/crypt"
+	"github.com/jiajunhuang/hfs/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 )
 
-func Upload(client pb.ChunkServerClient, filePath string) error {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return err
+/*
+package hfsclient is the Go SDK of hfs, it never prints or exits the process, all the
+failures are returned as errors.
+*/
+
+// error definitions
+var (
+	ErrNoEndpoint = errors.New("no endpoint of chunkserver")
+	ErrClosed     = errors.New("file already closed")
+	ErrTruncated  = errors.New("file is truncated")
+	ErrBadCluster = errors.New("cluster name should not be empty or contain /")
+	ErrBadCodec   = errors.New("unknown compression codec")
+)
+
+// how many files to ask for in one ListFiles request
+var listPageSize int64 = 1000
+
+// Progress will be called after every chunk was transferred, with bytes transferred so far
+// and total bytes to transfer, total is -1 if it's unknown
+type Progress func(transferred, total int64)
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithEndpoints set static addresses of chunkservers, default to config.GRPCAddr
+func WithEndpoints(endpoints ...string) Option {
+	return func(c *Client) {
+		c.endpoints = endpoints
 	}
+}
 
-	stream, err := client.CreateFile(context.Background())
-	if err != nil {
-		return err
+// WithDiscovery discover live chunkservers registered in etcd instead of a static list,
+// chunkservers joining or leaving the cluster will be picked up automatically
+func WithDiscovery(etcdEndpoints ...string) Option {
+	return func(c *Client) {
+		c.etcdEndpoints = etcdEndpoints
 	}
-	buf := make([]byte, config.ChunkSize)
-	filePaths := strings.Split(filePath, "/")
-	fileName := filePaths[len(filePaths)-1]
+}
 
-	for {
-		n, err := f.Read(buf)
-		if err == io.EOF {
-			break
+// WithCluster set name of cluster to talk to, default to config.ClusterName. chunkservers
+// reject requests for other clusters, and only chunkservers of it will be discovered
+func WithCluster(cluster string) Option {
+	return func(c *Client) {
+		c.cluster = cluster
+	}
+}
+
+// WithCodec set compression codec of files created by the client, chunks are compressed by
+// chunkservers and decompressed transparently when they're read. default to no compression
+func WithCodec(codecName string) Option {
+	return func(c *Client) {
+		c.codec = codecName
+	}
+}
+
+// WithKey set master key to decrypt files encrypted by client
+func WithKey(key *crypt.Key) Option {
+	return func(c *Client) {
+		c.key = key
+	}
+}
+
+// WithEncryption encrypt files created by the client with key, chunkservers and etcd only
+// see ciphertext. it implies WithKey
+func WithEncryption(key *crypt.Key) Option {
+	return func(c *Client) {
+		c.key, c.encrypt = key, true
+	}
+}
+
+// WithToken identify the client to chunkservers by token, it's required if chunkservers
+// enable Auth and don't identify clients by their certificates
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithPermission set permissions of files created by the client, mode is for all the users
+// other than owner, acl grants permissions to specified users. default to private
+func WithPermission(mode uint32, acl ...*pb.Grant) Option {
+	return func(c *Client) {
+		c.mode, c.acl = mode, acl
+	}
+}
+
+// WithTimeout set timeout of every unary RPC, streams are only limited by the context
+// passed by caller. 0 means no timeout, default to config.RPCTimeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries set how many times an idempotent RPC will be retried on the next endpoint
+// if the current one is unavailable
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		c.retries = retries
+	}
+}
+
+// WithCooldown set how long an unavailable endpoint will not be picked again
+func WithCooldown(cooldown time.Duration) Option {
+	return func(c *Client) {
+		c.cooldown = cooldown
+	}
+}
+
+// WithTLS talk to chunkservers with TLS, cfg should have certificate of client if
+// chunkservers require mutual TLS
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tls = cfg
+	}
+}
+
+// WithEtcdTLS talk to etcd with TLS when discovering chunkservers
+func WithEtcdTLS(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.etcdTLS = cfg
+	}
+}
+
+// WithDialOptions append extra options when dialing to chunkservers
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *Client) {
+		c.dialOptions = append(c.dialOptions, opts...)
+	}
+}
+
+// Client talks to chunkservers, requests are load balanced between them in round robin, and
+// it fails over to another chunkserver if one is down. it's safe for concurrent use.
+type Client struct {
+	cluster       string
+	codec         string
+	key           *crypt.Key
+	encrypt       bool
+	token         string
+	mode          uint32
+	acl           []*pb.Grant
+	endpoints     []string
+	etcdEndpoints []string
+	timeout       time.Duration
+	retries       int
+	cooldown      time.Duration
+	dialOptions   []grpc.DialOption
+	tls           *tls.Config
+	etcdTLS       *tls.Config
+
+	pool       *pool
+	etcdClient *clientv3.Client
+	cancel     context.CancelFunc
+}
+
+// New create a Client, connections to chunkservers are established in background, so it will
+// not fail if chunkservers are not ready yet
+func New(opts ...Option) (*Client, error) {
+	c := &Client{
+		cluster:   config.ClusterName,
+		endpoints: []string{config.GRPCAddr},
+		timeout:   config.RPCTimeout,
+		retries:   2,
+		cooldown:  5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.cluster == "" || strings.Contains(c.cluster, "/") {
+		return nil, ErrBadCluster
+	}
+	if !codec.Valid(c.codec) {
+		return nil, ErrBadCodec
+	}
+	if c.encrypt && c.key == nil {
+		return nil, crypt.ErrNoKey
+	}
+
+	creds := grpc.WithInsecure()
+	if c.tls != nil {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(c.tls))
+	}
+	dialOptions := append([]grpc.DialOption{
+		creds,
+		grpc.WithMaxMsgSize(config.GRPCMaxMsgSize),
+		grpc.WithUnaryInterceptor(c.unaryInterceptor),
+		grpc.WithStreamInterceptor(c.streamInterceptor),
+	}, c.dialOptions...)
+	if c.token != "" {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(auth.Token(c.token)))
+	}
+	c.pool = newPool(c.cooldown, dialOptions)
+
+	if len(c.etcdEndpoints) == 0 {
+		if len(c.endpoints) == 0 {
+			return nil, ErrNoEndpoint
 		}
-		if err := stream.Send(&pb.FileChunkData{Data: buf[:n], Msg: fileName}); err != nil {
-			logger.Sugar.Fatalf("failed to send chunk: %s", err)
+		if err := c.pool.set(c.endpoints); err != nil {
+			c.Close()
+			return nil, err
 		}
+		return c, nil
 	}
 
-	createFileResp, err := stream.CloseAndRecv()
+	etcdClient, err := clientv3.New(clientv3.Config{
+		Endpoints:   c.etcdEndpoints,
+		DialTimeout: config.EtcdDialTimeout,
+		TLS:         c.etcdTLS,
+		DialOptions: []grpc.DialOption{grpc.WithUnaryInterceptor(metrics.EtcdRPC.UnaryClientInterceptor())},
+	})
 	if err != nil {
-		return err
+		c.Close()
+		return nil, err
 	}
-	fmt.Printf("file created, uuid is %s\n", createFileResp.File.UUID)
+	c.etcdClient = etcdClient
 
-	return nil
+	var ctx context.Context
+	ctx, c.cancel = context.WithCancel(context.Background())
+	if err := c.pool.discover(ctx, etcdClient, config.NamespaceOf(c.cluster).WorkerBasePath); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
 }
 
-// FIXME: Download should be rewrite because chunks of file may be distributed in
-// diffrent nodes in cluster
-func Download(client pb.ChunkServerClient, fileUUID string) error {
-	fileName := ""
+// Cluster returns name of cluster the client talks to
+func (c *Client) Cluster() string {
+	return c.cluster
+}
 
-	stream, err := client.ReadFile(context.Background(), &pb.ReadFileRequest{FileUUID: fileUUID})
-	if err != nil {
+// unaryInterceptor tells chunkservers which cluster the request is for, and records metrics of
+// RPC. only one interceptor can be installed
+func (c *Client) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, config.ClusterMetadataKey, c.cluster)
+	return metrics.ClientRPC.UnaryClientInterceptor()(ctx, method, req, reply, cc, invoker, opts...)
+}
+
+// streamInterceptor works like unaryInterceptor, but for streams
+func (c *Client) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, config.ClusterMetadataKey, c.cluster)
+	return metrics.ClientRPC.StreamClientInterceptor()(ctx, desc, cc, method, streamer, opts...)
+}
+
+// Close close all the connections
+func (c *Client) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.etcdClient != nil {
+		c.etcdClient.Close()
+	}
+
+	return c.pool.close()
+}
+
+// retry invoke fn with one of the endpoints, and retry with the next one if the error is
+// temporary. fn must be idempotent. errors of RPC are returned as *Error
+func (c *Client) retry(ctx context.Context, fn func(*endpoint) error) error {
+	var err error
+	for i := 0; i <= c.retries; i++ {
+		e, perr := c.pool.pick()
+		if perr != nil {
+			return perr
+		}
+
+		err = wrapError(fn(e))
+		rpcErr, ok := err.(*Error)
+		if !ok || !rpcErr.Temporary() || ctx.Err() != nil {
+			return err
+		}
+		// a chunkserver which fails by itself is still reachable, e.g. etcd is down for a while
+		if !rpcErr.fromChunkserver() {
+			c.pool.markDown(e)
+		}
+	}
+
+	return err
+}
+
+// call works like retry, but with timeout of unary RPC
+func (c *Client) call(ctx context.Context, fn func(context.Context, pb.ChunkServerClient) error) error {
+	return c.retry(ctx, func(e *endpoint) error {
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if c.timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		}
+		defer cancel()
+
+		return fn(callCtx, e.client)
+	})
+}
+
+// Stat returns metadata of file
+func (c *Client) Stat(ctx context.Context, fileUUID string) (*pb.File, error) {
+	var file *pb.File
+	err := c.call(ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+		var err error
+		file, err = client.GetFile(ctx, &pb.ReadFileRequest{FileUUID: fileUUID})
+		return err
+	})
+
+	return file, err
+}
+
+// Remove remove file and all of it's chunks
+func (c *Client) Remove(ctx context.Context, fileUUID string) error {
+	// RemoveFile isn't idempotent, an attempt which fails may have removed the file already
+	attempts := 0
+	return c.call(ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+		attempts++
+		_, err := client.RemoveFile(ctx, &pb.File{UUID: fileUUID})
+		if attempts > 1 && IsNotFound(err) {
+			return nil
+		}
 		return err
+	})
+}
+
+// Chmod replace permissions of file, only owner of file and admins can do it
+func (c *Client) Chmod(ctx context.Context, fileUUID string, mode uint32, acl ...*pb.Grant) error {
+	return c.call(ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+		_, err := client.Chmod(ctx, &pb.ChmodRequest{FileUUID: fileUUID, Mode: mode, Acl: acl})
+		return err
+	})
+}
+
+// Quota returns quota and usage of owner, or of the client itself if owner is empty.
+// negative limits are unlimited
+func (c *Client) Quota(ctx context.Context, owner string) (*pb.Quota, error) {
+	var quota *pb.Quota
+	err := c.call(ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+		var err error
+		quota, err = client.GetQuota(ctx, &pb.QuotaRequest{Owner: owner})
+		return err
+	})
+
+	return quota, err
+}
+
+// SetQuota set how many bytes and files owner can own, 0 follows the default of chunkservers,
+// negative is unlimited, and nil leaves the limit as is. only admins can do it
+func (c *Client) SetQuota(ctx context.Context, owner string, maxBytes *int64, maxFiles *int64) error {
+	req := &pb.Quota{Owner: owner, KeepMaxBytes: maxBytes == nil, KeepMaxFiles: maxFiles == nil}
+	if maxBytes != nil {
+		req.MaxBytes = *maxBytes
 	}
-	f, err := os.OpenFile(fileUUID, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		logger.Sugar.Errorf("failed to open file %s: %s", fileUUID, err)
+	if maxFiles != nil {
+		req.MaxFiles = *maxFiles
+	}
+
+	return c.call(ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+		_, err := client.SetQuota(ctx, req)
 		return err
+	})
+}
+
+// Leader returns the chunkserver which coordinates cluster-wide tasks
+func (c *Client) Leader(ctx context.Context) (*pb.Leader, error) {
+	var leader *pb.Leader
+	err := c.call(ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+		var err error
+		leader, err = client.GetLeader(ctx, &pb.LeaderRequest{})
+		return err
+	})
+
+	return leader, err
+}
+
+// List returns metadata of all files the client can read
+func (c *Client) List(ctx context.Context) ([]*pb.File, error) {
+	files := []*pb.File{}
+	req := pb.ListFilesRequest{Limit: listPageSize}
+
+	for {
+		var resp *pb.ListFilesResponse
+		err := c.call(ctx, func(ctx context.Context, client pb.ChunkServerClient) error {
+			var err error
+			resp, err = client.ListFiles(ctx, &req)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, resp.Files...)
+		// files which can't be read are filtered out, so the page may be empty
+		last := resp.Last
+		if last == "" && len(resp.Files) > 0 {
+			last = resp.Files[len(resp.Files)-1].UUID
+		}
+		if !resp.More || last == "" {
+			return files, nil
+		}
+		req.StartAfter = last
+	}
+}
+
+// UploadFile upload file in filePath, report progress to progress if it's not nil
+func (c *Client) UploadFile(ctx context.Context, filePath string, progress Progress) (*pb.File, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
 	}
 	defer f.Close()
 
+	var total int64 = -1
+	if fi, err := f.Stat(); err == nil {
+		total = fi.Size()
+	}
+
+	filePaths := strings.Split(filePath, "/")
+	fileName := filePaths[len(filePaths)-1]
+
+	return c.Upload(ctx, f, fileName, total, progress)
+}
+
+// Upload read all data from r and save it as a file named fileName, total is size of data in r,
+// it's only used to report progress, pass -1 if it's unknown(e.g. r is a pipe)
+func (c *Client) Upload(ctx context.Context, r io.Reader, fileName string, total int64, progress Progress) (*pb.File, error) {
+	w, err := c.Create(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, config.ChunkSize)
+	var transferred int64
 	for {
-		chunk, err := stream.Recv()
+		// r may be a pipe, fill the whole chunk before send it
+		n, err := io.ReadFull(r, buf)
 		if err == io.EOF {
 			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			w.Abort()
+			return nil, err
 		}
-		if err != nil {
-			logger.Sugar.Debugf("failed to read from stream: %s", err)
-			return err
+		if _, err := w.Write(buf[:n]); err != nil {
+			w.Abort()
+			return nil, err
 		}
 
-		_, err = f.Write(chunk.Data)
-		if err != nil {
-			logger.Sugar.Fatalf("failed to write chunk of file %s: %s", chunk.Msg, err)
+		transferred += int64(n)
+		if progress != nil {
+			progress(transferred, total)
 		}
-
-		fileName = chunk.Msg
 	}
 
-	fmt.Printf("file with UUID %s download successful! origin file name is %s\n", fileUUID, fileName)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return w.File(), nil
 }
 
-func Delete(client pb.ChunkServerClient, fileUUID string) error {
-	file := pb.File{UUID: fileUUID}
-	if _, err := client.RemoveFile(context.Background(), &file); err != nil {
-		fmt.Printf("failed to delete file %s: %s\n", file.UUID, err)
-		return err
+// Download download file with fileUUID to dstPath, if dstPath is a directory, file will be
+// written under it with it's origin name. data will be written to a temporary file first
+// and renamed to dstPath once succeed, so a failed download never leaves a truncated file.
+func (c *Client) Download(ctx context.Context, fileUUID string, dstPath string, progress Progress) (*pb.File, string, error) {
+	r, err := c.Open(ctx, fileUUID)
+	if err != nil {
+		return nil, "", err
 	}
+	defer r.Close()
+	file := r.Stat()
 
-	return nil
+	if fi, err := os.Stat(dstPath); err == nil && fi.IsDir() {
+		// never trust the name in metadata, it may contains path separators
+		name := filepath.Base(filepath.Clean("/" + file.FileName))
+		if name == "/" {
+			name = file.UUID
+		}
+		dstPath = filepath.Join(dstPath, name)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".hfs-")
+	if err != nil {
+		return nil, "", err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath) // no-op after renamed
+	defer f.Close()
+
+	if _, err := io.Copy(&progressWriter{w: f, total: r.Size(), progress: progress}, r); err != nil {
+		return nil, "", err
+	}
+
+	if err := f.Chmod(0644); err != nil {
+		return nil, "", err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, "", err
+	}
+	if err := f.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		return nil, "", err
+	}
+
+	return file, dstPath, nil
 }
 
-func UploadChunk(client pb.ChunkServerClient, chunkUUID string) error {
-	chunkPath := config.ChunkBasePath + chunkUUID
-	data, err := ioutil.ReadFile(chunkPath)
+// Cat write content of file with fileUUID to w
+func (c *Client) Cat(ctx context.Context, fileUUID string, w io.Writer, progress Progress) (*pb.File, error) {
+	r, err := c.Open(ctx, fileUUID)
 	if err != nil {
-		logger.Sugar.Errorf("failed to read chunk %s: %s", chunkPath, err)
-		return err
+		return nil, err
 	}
+	defer r.Close()
 
-	if _, err := client.CreateChunk(context.Background(), &pb.FileChunkData{Data: data, Msg: chunkUUID}); err != nil {
-		logger.Sugar.Errorf("failed to sync chunk %s: %s", chunkUUID, err)
-		return err
+	if _, err := io.Copy(&progressWriter{w: w, total: r.Size(), progress: progress}, r); err != nil {
+		return nil, err
+	}
+
+	return r.Stat(), nil
+}
+
+// progressWriter report progress after every write
+type progressWriter struct {
+	w           io.Writer
+	total       int64
+	transferred int64
+	progress    Progress
+}
 
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.transferred += int64(n)
+	if pw.progress != nil {
+		pw.progress(pw.transferred, pw.total)
 	}
 
-	return nil
+	return n, err
 }
@@ -0,0 +1,710 @@
+package hfsclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/jiajunhuang/hfs/pb"
+	"github.com/jiajunhuang/hfs/pkg/auth"
+	"github.com/jiajunhuang/hfs/pkg/codec"
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"github.com/jiajunhuang/hfs/pkg/crypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServer keeps files and chunks in memory
+type fakeServer struct {
+	mu     sync.Mutex
+	seq    int
+	files  map[string]*pb.File
+	chunks map[string][]byte
+
+	cluster string // cluster of the last ListFiles request
+	token   string // token of the last CreateFile request
+	quota   int64  // how many bytes a file can have at most, 0 is unlimited
+
+	removeFails int // how many RemoveFile fail as unavailable after the file is removed
+}
+
+// fakeError returns error like the ones of chunkservers
+func fakeError(code codes.Code, reason string, msg string) error {
+	st, _ := status.New(code, msg).WithDetails(&pb.ErrorDetail{Reason: reason, Node: "fake"})
+	return st.Err()
+}
+
+func (s *fakeServer) CreateFile(stream pb.ChunkServer_CreateFileServer) error {
+	s.mu.Lock()
+	s.seq++
+	file := pb.File{UUID: fmt.Sprintf("file-%03d", s.seq)}
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok && len(md.Get(auth.MetadataKey)) > 0 {
+		s.token = md.Get(auth.MetadataKey)[0]
+	}
+	s.mu.Unlock()
+
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		c := pb.Chunk{UUID: fmt.Sprintf("%s-%d", file.UUID, len(file.Chunks)), Used: int64(len(data.Data)), FileUUID: file.UUID}
+		codecName, stored, err := codec.Compress(data.Codec, data.Data)
+		if err != nil {
+			return err
+		}
+		if codecName != codec.None {
+			c.Codec, c.CompressedSize = codecName, int64(len(stored))
+		}
+		s.mu.Lock()
+		s.chunks[c.UUID] = append([]byte{}, stored...)
+		s.mu.Unlock()
+
+		file.FileName = data.Msg
+		if data.Encryption != nil {
+			file.Encryption = data.Encryption
+		}
+		if data.Mode != 0 || len(data.Acl) > 0 {
+			file.Mode, file.Acl = data.Mode, data.Acl
+		}
+		file.Size += c.Used
+		file.Chunks = append(file.Chunks, &c)
+		if s.quota > 0 && file.Size > s.quota {
+			return fakeError(codes.ResourceExhausted, "QuotaExceeded", "quota exceeded")
+		}
+	}
+
+	s.mu.Lock()
+	s.files[file.UUID] = &file
+	s.mu.Unlock()
+	return stream.SendAndClose(&pb.CreateFileResponse{File: &file})
+}
+
+func (s *fakeServer) RemoveFile(ctx context.Context, file *pb.File) (*pb.GenericResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[file.UUID]; !ok {
+		return nil, fakeError(codes.NotFound, "NotFound", "file or chunk not exist")
+	}
+	delete(s.files, file.UUID)
+	if s.removeFails > 0 {
+		s.removeFails--
+		return nil, fakeError(codes.Unavailable, "Unavailable", "etcd is unavailable")
+	}
+	return &pb.GenericResponse{}, nil
+}
+
+func (s *fakeServer) ReadFile(req *pb.ReadFileRequest, stream pb.ChunkServer_ReadFileServer) error {
+	return errors.New("not implemented")
+}
+
+func (s *fakeServer) CreateChunk(ctx context.Context, data *pb.FileChunkData) (*pb.GenericResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeServer) GetFile(ctx context.Context, req *pb.ReadFileRequest) (*pb.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[req.FileUUID]
+	if !ok {
+		return nil, fakeError(codes.NotFound, "NotFound", "file or chunk not exist")
+	}
+	return file, nil
+}
+
+func (s *fakeServer) ReadChunk(ctx context.Context, req *pb.ReadChunkRequest) (*pb.FileChunkData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.chunks[req.ChunkUUID]
+	end := req.Offset + req.Length
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return &pb.FileChunkData{Data: data[req.Offset:end]}, nil
+}
+
+func (s *fakeServer) RemoveChunk(ctx context.Context, req *pb.RemoveChunkRequest) (*pb.GenericResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeServer) ReplicateChunk(ctx context.Context, req *pb.ReplicateChunkRequest) (*pb.GenericResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeServer) GetLeader(ctx context.Context, req *pb.LeaderRequest) (*pb.Leader, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeServer) Chmod(ctx context.Context, req *pb.ChmodRequest) (*pb.GenericResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[req.FileUUID]
+	if !ok {
+		return nil, fakeError(codes.NotFound, "NotFound", "file or chunk not exist")
+	}
+	file.Mode, file.Acl = req.Mode, req.Acl
+	return &pb.GenericResponse{}, nil
+}
+
+func (s *fakeServer) GetQuota(ctx context.Context, req *pb.QuotaRequest) (*pb.Quota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &pb.Quota{Owner: req.Owner, MaxBytes: s.quota, MaxFiles: -1}, nil
+}
+
+func (s *fakeServer) SetQuota(ctx context.Context, req *pb.Quota) (*pb.GenericResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !req.KeepMaxBytes {
+		s.quota = req.MaxBytes
+	}
+	return &pb.GenericResponse{}, nil
+}
+
+func (s *fakeServer) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(config.ClusterMetadataKey)) > 0 {
+		s.cluster = md.Get(config.ClusterMetadataKey)[0]
+	}
+
+	uuids := []string{}
+	for uuid := range s.files {
+		if uuid > req.StartAfter {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Strings(uuids)
+
+	resp := pb.ListFilesResponse{}
+	for _, uuid := range uuids {
+		if req.Limit > 0 && int64(len(resp.Files)) == req.Limit {
+			resp.More = true
+			break
+		}
+		resp.Files = append(resp.Files, s.files[uuid])
+	}
+	return &resp, nil
+}
+
+// newTestClient returns a client connected to a fakeServer, and the extra endpoints
+func newTestClient(t *testing.T, endpoints ...string) (*Client, func()) {
+	client, _, cleanup := newTestClientWithServer(t, nil, endpoints...)
+	return client, cleanup
+}
+
+// newTestClientWithServer works like newTestClient, but also returns the fakeServer, and
+// accepts extra options
+func newTestClientWithServer(t *testing.T, opts []Option, endpoints ...string) (*Client, *fakeServer, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	server := grpc.NewServer()
+	fake := &fakeServer{files: map[string]*pb.File{}, chunks: map[string][]byte{}}
+	pb.RegisterChunkServerServer(server, fake)
+	go server.Serve(lis)
+
+	client, err := New(append(opts, WithEndpoints(append(endpoints, lis.Addr().String())...))...)
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+
+	chunkSize := config.ChunkSize
+	config.ChunkSize = 4
+
+	return client, fake, func() {
+		config.ChunkSize = chunkSize
+		client.Close()
+		server.Stop()
+	}
+}
+
+func TestCreateAndOpen(t *testing.T) {
+	client, cleanup := newTestClient(t)
+	defer cleanup()
+	ctx := context.Background()
+	data := "hello, hfs world"
+
+	w, err := client.Create(ctx, "hello.txt")
+	if err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	for _, part := range []string{"hel", "lo, hfs", " world"} {
+		if _, err := io.WriteString(w, part); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+	file := w.File()
+	if file.FileName != "hello.txt" || file.Size != int64(len(data)) || len(file.Chunks) != 4 {
+		t.Fatalf("bad metadata of file: %+v", file)
+	}
+
+	r, err := client.Open(ctx, file.UUID)
+	if err != nil {
+		t.Fatalf("failed to open file: %s", err)
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != data {
+		t.Fatalf("should read %s but got %s, err: %v", data, b, err)
+	}
+
+	p := make([]byte, 7)
+	if n, err := r.ReadAt(p, 3); err != nil || string(p[:n]) != data[3:10] {
+		t.Fatalf("should read %s at 3 but got %s, err: %v", data[3:10], p[:n], err)
+	}
+	if n, err := r.ReadAt(p, 12); err != io.EOF || string(p[:n]) != data[12:] {
+		t.Fatalf("should read %s at 12 with EOF but got %s, err: %v", data[12:], p[:n], err)
+	}
+
+	if _, err := r.Seek(-5, io.SeekEnd); err != nil {
+		t.Fatalf("failed to seek: %s", err)
+	}
+	b, err = ioutil.ReadAll(r)
+	if err != nil || string(b) != data[len(data)-5:] {
+		t.Fatalf("should read %s after seek but got %s, err: %v", data[len(data)-5:], b, err)
+	}
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	client, cleanup := newTestClient(t)
+	defer cleanup()
+	ctx := context.Background()
+	data := "data from a pipe"
+
+	var progress []int64
+	file, err := client.Upload(ctx, strings.NewReader(data), "pipe", -1, func(transferred, total int64) {
+		progress = append(progress, transferred)
+	})
+	if err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+	if len(progress) != 4 || progress[3] != int64(len(data)) {
+		t.Fatalf("bad progress: %v", progress)
+	}
+
+	buf := bytes.Buffer{}
+	if _, err := client.Cat(ctx, file.UUID, &buf, nil); err != nil || buf.String() != data {
+		t.Fatalf("should cat %s but got %s, err: %v", data, buf.String(), err)
+	}
+
+	dir, err := ioutil.TempDir("", "hfsclient")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, path, err := client.Download(ctx, file.UUID, dir, nil)
+	if err != nil {
+		t.Fatalf("failed to download: %s", err)
+	}
+	if path != filepath.Join(dir, "pipe") {
+		t.Fatalf("file should be downloaded to origin name but got %s", path)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != data {
+		t.Fatalf("should download %s but got %s, err: %v", data, b, err)
+	}
+
+	if _, _, err := client.Download(ctx, "not-exist", filepath.Join(dir, "x"), nil); err == nil {
+		t.Fatalf("should failed to download file not exist")
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("failed download should not leave any file, but got %d files", len(entries))
+	}
+}
+
+func TestListAndRemove(t *testing.T) {
+	client, cleanup := newTestClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	pageSize := listPageSize
+	listPageSize = 2
+	defer func() { listPageSize = pageSize }()
+
+	for i := 0; i < 5; i++ {
+		if _, err := client.Upload(ctx, strings.NewReader("hello"), "hello", 5, nil); err != nil {
+			t.Fatalf("failed to upload: %s", err)
+		}
+	}
+
+	files, err := client.List(ctx)
+	if err != nil || len(files) != 5 {
+		t.Fatalf("should list 5 files but got %d, err: %v", len(files), err)
+	}
+
+	if err := client.Remove(ctx, files[0].UUID); err != nil {
+		t.Fatalf("failed to remove file: %s", err)
+	}
+	if _, err := client.Stat(ctx, files[0].UUID); err == nil {
+		t.Fatalf("file should be removed")
+	}
+	if files, _ := client.List(ctx); len(files) != 4 {
+		t.Fatalf("should list 4 files but got %d", len(files))
+	}
+}
+
+func TestRemoveRetried(t *testing.T) {
+	client, fake, cleanup := newTestClientWithServer(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+
+	file, err := client.Upload(ctx, strings.NewReader("hello"), "hello", 5, nil)
+	if err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+
+	// the first attempt removes the file but fails, the retry finds nothing
+	fake.mu.Lock()
+	fake.removeFails = 1
+	fake.mu.Unlock()
+	if err := client.Remove(ctx, file.UUID); err != nil {
+		t.Fatalf("retry of a removed file should succeed but got %s", err)
+	}
+	if err := client.Remove(ctx, file.UUID); !IsNotFound(err) {
+		t.Fatalf("removing a file not exist should be not found but got %v", err)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	// nothing listens on port 1
+	client, cleanup := newTestClient(t, "127.0.0.1:1")
+	defer cleanup()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Upload(ctx, strings.NewReader("hello"), "hello", 5, nil); err != nil {
+			t.Fatalf("should failover to the live endpoint but got: %s", err)
+		}
+		if _, err := client.List(ctx); err != nil {
+			t.Fatalf("should failover to the live endpoint but got: %s", err)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	client, fake, cleanup := newTestClientWithServer(t, []Option{WithCluster("staging")})
+	defer cleanup()
+
+	if _, err := client.List(context.Background()); err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	fake.mu.Lock()
+	cluster := fake.cluster
+	fake.mu.Unlock()
+	if cluster != "staging" {
+		t.Fatalf("request should be for cluster staging but got %q", cluster)
+	}
+
+	if _, err := New(WithCluster("a/b")); err != ErrBadCluster {
+		t.Fatalf("should reject bad cluster name but got %v", err)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	client, _, cleanup := newTestClientWithServer(t, []Option{WithCodec(codec.Flate)})
+	defer cleanup()
+	// chunks should be large enough to be compressed, cleanup restores it
+	config.ChunkSize = 1024
+	ctx := context.Background()
+	data := strings.Repeat("INFO chunk has been created\n", 100)
+
+	file, err := client.Upload(ctx, strings.NewReader(data), "hfs.log", -1, nil)
+	if err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+	if c := file.Chunks[0]; c.Codec != codec.Flate || c.CompressedSize >= c.Used {
+		t.Fatalf("chunk should be compressed but got %+v", c)
+	}
+
+	r, err := client.Open(ctx, file.UUID)
+	if err != nil {
+		t.Fatalf("failed to open file: %s", err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != data {
+		t.Fatalf("should read the origin data but got %d bytes, err: %v", len(b), err)
+	}
+	p := make([]byte, 10)
+	if _, err := r.ReadAt(p, 30); err != nil || string(p) != data[30:40] {
+		t.Fatalf("should read %s at 30 but got %s, err: %v", data[30:40], p, err)
+	}
+
+	if _, err := New(WithCodec("zip")); err != ErrBadCodec {
+		t.Fatalf("should reject unknown codec but got %v", err)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	key, _ := crypt.NewKey(bytes.Repeat([]byte{1}, crypt.KeySize))
+	client, fake, cleanup := newTestClientWithServer(t, []Option{WithEncryption(key)})
+	defer cleanup()
+	config.ChunkSize = crypt.Overhead + 4
+	ctx := context.Background()
+	data := "secret of customer"
+
+	file, err := client.Upload(ctx, strings.NewReader(data), "secret.txt", -1, nil)
+	if err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+	if file.Encryption == nil || len(file.Chunks) != 5 {
+		t.Fatalf("file should be encrypted in 5 chunks but got %+v", file)
+	}
+	fake.mu.Lock()
+	for uuid, chunk := range fake.chunks {
+		if len(chunk) > config.ChunkSize || bytes.Contains(chunk, []byte("cret")) {
+			t.Fatalf("chunk %s should be encrypted but got %q", uuid, chunk)
+		}
+	}
+	fake.mu.Unlock()
+
+	r, err := client.Open(ctx, file.UUID)
+	if err != nil {
+		t.Fatalf("failed to open file: %s", err)
+	}
+	defer r.Close()
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size should be %d but got %d", len(data), r.Size())
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != data {
+		t.Fatalf("should read %s but got %s, err: %v", data, b, err)
+	}
+	p := make([]byte, 6)
+	if _, err := r.ReadAt(p, 7); err != nil || string(p) != data[7:13] {
+		t.Fatalf("should read %s at 7 but got %s, err: %v", data[7:13], p, err)
+	}
+
+	// trailing chunks are dropped
+	fake.mu.Lock()
+	truncated := *fake.files[file.UUID]
+	truncated.Chunks = truncated.Chunks[:3]
+	truncated.Size = 3 * int64(config.ChunkSize)
+	truncated.UUID = "truncated"
+	fake.files[truncated.UUID] = &truncated
+	fake.mu.Unlock()
+	r, err = client.Open(ctx, truncated.UUID)
+	if err != nil {
+		t.Fatalf("failed to open truncated file: %s", err)
+	}
+	if b, err := ioutil.ReadAll(r); err != crypt.ErrCorrupted {
+		t.Fatalf("truncated file should be rejected but got %s, err: %v", b, err)
+	}
+
+	// an empty file still has the last chunk
+	empty, err := client.Upload(ctx, strings.NewReader(""), "empty.txt", -1, nil)
+	if err != nil || len(empty.Chunks) != 1 {
+		t.Fatalf("empty file should have 1 chunk but got %+v, err: %v", empty, err)
+	}
+	if r, err := client.Open(ctx, empty.UUID); err != nil || r.Size() != 0 {
+		t.Fatalf("failed to open empty file: %v", err)
+	}
+	fake.mu.Lock()
+	fake.files[empty.UUID].Chunks, fake.files[empty.UUID].Size = nil, 0
+	fake.mu.Unlock()
+	if _, err := client.Open(ctx, empty.UUID); err != ErrTruncated {
+		t.Fatalf("file without chunks should be truncated but got %v", err)
+	}
+
+	// it can't be read without the key
+	plain, err := New(WithEndpoints(client.endpoints...))
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	defer plain.Close()
+	if _, err := plain.Open(ctx, file.UUID); err != crypt.ErrNoKey {
+		t.Fatalf("should have no key but got %v", err)
+	}
+	other, _ := crypt.NewKey(bytes.Repeat([]byte{2}, crypt.KeySize))
+	plain.key = other
+	if _, err := plain.Open(ctx, file.UUID); err != crypt.ErrWrongKey {
+		t.Fatalf("should be wrong key but got %v", err)
+	}
+}
+
+func TestPermission(t *testing.T) {
+	grant := &pb.Grant{User: "bob", Perm: auth.PermAll}
+	client, fake, cleanup := newTestClientWithServer(t, []Option{WithToken("secret"), WithPermission(auth.PermRead, grant)})
+	defer cleanup()
+	ctx := context.Background()
+
+	file, err := client.Upload(ctx, strings.NewReader("shared data"), "shared", -1, nil)
+	if err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+	if fake.token != "secret" {
+		t.Fatalf("token should be sent but got %q", fake.token)
+	}
+	if file.Mode != auth.PermRead || len(file.Acl) != 1 || file.Acl[0].User != "bob" || file.Acl[0].Perm != auth.PermAll {
+		t.Fatalf("bad permissions of file: %d, %v", file.Mode, file.Acl)
+	}
+
+	if err := client.Chmod(ctx, file.UUID, 0); err != nil {
+		t.Fatalf("failed to chmod: %s", err)
+	}
+	if file, err = client.Stat(ctx, file.UUID); err != nil {
+		t.Fatalf("failed to stat: %s", err)
+	} else if file.Mode != 0 || len(file.Acl) != 0 {
+		t.Fatalf("file should be private but got %d, %v", file.Mode, file.Acl)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	client, _, cleanup := newTestClientWithServer(t, nil)
+	defer cleanup()
+	ctx := context.Background()
+
+	maxBytes, maxFiles := int64(10), int64(-1)
+	if err := client.SetQuota(ctx, "alice", &maxBytes, &maxFiles); err != nil {
+		t.Fatalf("failed to set quota: %s", err)
+	}
+	if q, err := client.Quota(ctx, "alice"); err != nil || q.MaxBytes != 10 || q.MaxFiles != -1 {
+		t.Fatalf("bad quota: %v, err: %v", q, err)
+	}
+	// the limit which is not given is kept
+	if err := client.SetQuota(ctx, "alice", nil, &maxFiles); err != nil {
+		t.Fatalf("failed to set quota: %s", err)
+	}
+	if q, err := client.Quota(ctx, "alice"); err != nil || q.MaxBytes != 10 {
+		t.Fatalf("limit of bytes should be kept but got %v, err: %v", q, err)
+	}
+
+	// chunkserver rejects the upload in the middle of stream
+	_, err := client.Upload(ctx, strings.NewReader("more than ten bytes"), "big", -1, nil)
+	if !IsQuotaExceeded(err) || status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("upload over quota should be rejected but got %v", err)
+	}
+	if _, err := client.Upload(ctx, strings.NewReader("small"), "small", -1, nil); err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	client, cleanup := newTestClient(t)
+	defer cleanup()
+
+	_, err := client.Stat(context.Background(), "no-such-file")
+	e, ok := err.(*Error)
+	if !ok || !IsNotFound(err) || IsTemporary(err) || e.Reason != "NotFound" || e.Node != "fake" {
+		t.Fatalf("should be an error of not found from chunkserver but got %#v", err)
+	}
+
+	if IsNotFound(errors.New("not found")) || IsTemporary(ErrClosed) {
+		t.Fatalf("errors which are not from RPC should not be matched")
+	}
+	if !IsTemporary(wrapError(status.Error(codes.Unavailable, "connection refused"))) {
+		t.Fatalf("unavailable should be temporary")
+	}
+}
+
+// fakeRegistry is chunkservers registered in etcd, only Get and Watch of them work
+type fakeRegistry struct {
+	clientv3.KV
+	clientv3.Watcher
+
+	mu      sync.Mutex
+	workers map[string]string
+	watches chan chan clientv3.WatchResponse // channel of every Watch, it's closed once ctx is done
+}
+
+func (r *fakeRegistry) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: 1}}
+	for name, addr := range r.workers {
+		resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(key + name), Value: []byte(addr)})
+	}
+	return resp, nil
+}
+
+func (r *fakeRegistry) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	ch := make(chan clientv3.WatchResponse)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	r.watches <- ch
+	return ch
+}
+
+func TestDiscover(t *testing.T) {
+	defer func(d time.Duration) { rediscoverInterval = d }(rediscoverInterval)
+	rediscoverInterval = 10 * time.Millisecond
+	registry := &fakeRegistry{workers: map[string]string{"node-1": "127.0.0.1:1"}, watches: make(chan chan clientv3.WatchResponse, 1)}
+	p := newPool(time.Second, []grpc.DialOption{grpc.WithInsecure()})
+	defer p.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := p.discover(ctx, &clientv3.Client{KV: registry, Watcher: registry}, "/hfs/workers/"); err != nil {
+		t.Fatalf("failed to discover: %s", err)
+	}
+	// waitAddrs waits until the pool has addrs
+	waitAddrs := func(addrs ...string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			p.mu.Lock()
+			got := []string{}
+			for addr := range p.endpoints {
+				got = append(got, addr)
+			}
+			p.mu.Unlock()
+			sort.Strings(got)
+			if fmt.Sprint(got) == fmt.Sprint(addrs) {
+				return
+			} else if time.Now().After(deadline) {
+				t.Fatalf("pool should have %v but got %v", addrs, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitAddrs("127.0.0.1:1")
+
+	watch := <-registry.watches
+	watch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/hfs/workers/node-2"), Value: []byte("127.0.0.1:2")}}}}
+	waitAddrs("127.0.0.1:1", "127.0.0.1:2")
+
+	// changes are missed while the revision is compacted, they're listed again
+	registry.mu.Lock()
+	registry.workers = map[string]string{"node-2": "127.0.0.1:2", "node-3": "127.0.0.1:3"}
+	registry.mu.Unlock()
+	watch <- clientv3.WatchResponse{CompactRevision: 2}
+	waitAddrs("127.0.0.1:2", "127.0.0.1:3")
+
+	watch = <-registry.watches
+	watch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte("/hfs/workers/node-2")}}}}
+	waitAddrs("127.0.0.1:3")
+}
@@ -0,0 +1,12 @@
+package hfsclient
+
+import (
+	"github.com/jiajunhuang/hfs/pkg/metrics"
+)
+
+// metrics of client, RPCs and etcd calls are counted by interceptors in package metrics. they're
+// exposed by metrics.Default
+var (
+	uploadedBytes   = metrics.NewCounter("hfs_client_uploaded_bytes_total", "bytes of chunks sent to chunkservers, after encryption")
+	downloadedBytes = metrics.NewCounter("hfs_client_downloaded_bytes_total", "bytes of chunks received from chunkservers as they are stored, before decompression and decryption")
+)
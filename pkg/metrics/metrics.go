@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+package metrics exposes metrics of hfs to Prometheus. metrics are registered in Default when
+they're created, so they're usually package level variables. RPCs are counted by interceptors
+of go-grpc-prometheus, chunkservers handle RPCs from clients and other chunkservers, and both of
+them call etcd.
+
+Default is a registry of it's own instead of the global one of Prometheus, so that programs
+using hfs as a library decide whether and where they're exposed.
+*/
+
+// Default is the registry metrics are created in, it has metrics of Go runtime and the process
+var Default = prometheus.NewRegistry()
+
+// metrics of RPCs, they're named hfs_grpc_server_*, hfs_grpc_client_* and hfs_etcd_grpc_client_*
+var (
+	ServerRPC = grpc_prometheus.NewServerMetrics(withNamespace(""))
+	ClientRPC = grpc_prometheus.NewClientMetrics(withNamespace(""))
+	EtcdRPC   = grpc_prometheus.NewClientMetrics(withNamespace("etcd"))
+)
+
+func init() {
+	ServerRPC.EnableHandlingTimeHistogram(withHistogramNamespace(""))
+	ClientRPC.EnableClientHandlingTimeHistogram(withHistogramNamespace(""))
+	EtcdRPC.EnableClientHandlingTimeHistogram(withHistogramNamespace("etcd"))
+
+	Default.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		ServerRPC, ClientRPC, EtcdRPC,
+	)
+}
+
+func withNamespace(subsystem string) grpc_prometheus.CounterOption {
+	return func(o *prometheus.CounterOpts) {
+		o.Namespace, o.Subsystem = "hfs", subsystem
+	}
+}
+
+func withHistogramNamespace(subsystem string) grpc_prometheus.HistogramOption {
+	return func(o *prometheus.HistogramOpts) {
+		o.Namespace, o.Subsystem = "hfs", subsystem
+	}
+}
+
+// NewCounter returns a counter named name which is registered in Default
+func NewCounter(name, help string) prometheus.Counter {
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: name, Help: help})
+	Default.MustRegister(c)
+	return c
+}
+
+// NewCounterVec returns counters named name by labels, they're registered in Default
+func NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	Default.MustRegister(c)
+	return c
+}
+
+// NewGauge returns a gauge named name which is registered in Default
+func NewGauge(name, help string) prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+	Default.MustRegister(g)
+	return g
+}
+
+// Handler returns http handler which exposes metrics in Default
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{})
+}
+
+// Serve expose metrics in Default at /metrics of addr in background. it returns once addr is
+// listened
+func Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	go http.Serve(lis, mux)
+	return nil
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// value returns value of counter name whose labels contain labels, metrics in Default outlive
+// a test, so tests compare values before and after
+func value(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := Default.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %s", err)
+	}
+
+	sum := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if v, ok := labels[pair.GetName()]; ok && v != pair.GetValue() {
+					continue metrics
+				}
+			}
+			sum += m.GetCounter().GetValue()
+		}
+	}
+	return sum
+}
+
+func TestServerRPC(t *testing.T) {
+	labels := map[string]string{"grpc_service": "pb.ChunkServer", "grpc_method": "Stat", "grpc_code": "NotFound"}
+	before := value(t, "hfs_grpc_server_handled_total", labels)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.ChunkServer/Stat"}
+	_, err := ServerRPC.UnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "chunk not found")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("error of handler should be returned but got %v", err)
+	}
+	if n := value(t, "hfs_grpc_server_handled_total", labels); n != before+1 {
+		t.Fatalf("1 RPC should be counted but got %v", n-before)
+	}
+}
+
+func TestClientRPC(t *testing.T) {
+	labels := map[string]string{"grpc_service": "pb.ChunkServer", "grpc_method": "Stat", "grpc_code": "OK"}
+	before := value(t, "hfs_grpc_client_handled_total", labels)
+	etcdBefore := value(t, "hfs_etcd_grpc_client_handled_total", nil)
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	if err := ClientRPC.UnaryClientInterceptor()(context.Background(), "/pb.ChunkServer/Stat", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("failed to invoke: %s", err)
+	}
+	if n := value(t, "hfs_grpc_client_handled_total", labels); n != before+1 {
+		t.Fatalf("1 RPC should be counted but got %v", n-before)
+	}
+	if n := value(t, "hfs_etcd_grpc_client_handled_total", nil); n != etcdBefore {
+		t.Fatalf("RPCs to chunkservers should not be counted as etcd calls but got %v", n-etcdBefore)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ServerRPC.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pb.ChunkServer/Stat"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+	for _, name := range []string{"# TYPE hfs_grpc_server_handled_total counter", "# TYPE hfs_grpc_server_handling_seconds histogram", "go_goroutines"} {
+		if !strings.Contains(string(body), name) {
+			t.Fatalf("should contain %q, but got:\n%s", name, body)
+		}
+	}
+}
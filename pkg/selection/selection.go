@@ -35,3 +35,29 @@ func Random(avalable []string, itself string, num int32) []string {
 
 	return avalable[:min]
 }
+
+// Pick random select min(num, len(candidates)) elems in avalable which are not in exclude
+func Pick(avalable []string, exclude []string, num int) []string {
+	excluded := map[string]bool{}
+	for _, e := range exclude {
+		excluded[e] = true
+	}
+
+	candidates := []string{}
+	for _, a := range avalable {
+		if !excluded[a] {
+			candidates = append(candidates, a)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	if num < 0 {
+		num = 0
+	}
+	if len(candidates) < num {
+		num = len(candidates)
+	}
+	return candidates[:num]
+}
@@ -48,3 +48,21 @@ func TestRandomSelection(t *testing.T) {
 		}
 	}
 }
+
+func TestPick(t *testing.T) {
+	avalable := []string{"node1", "node2", "node3", "node4"}
+
+	result := Pick(avalable, []string{"node1", "node3"}, 1)
+	if len(result) != 1 || result[0] == "node1" || result[0] == "node3" {
+		t.Fatalf("should select one of node2 and node4, but got: %s", result)
+	}
+
+	result = Pick(avalable, []string{"node1"}, 5)
+	if len(result) != 3 {
+		t.Fatalf("result should be 3 elems, but got: %s", result)
+	}
+
+	if result := Pick(avalable, nil, 0); len(result) != 0 {
+		t.Fatalf("should not get any node return, but got: %s", result)
+	}
+}
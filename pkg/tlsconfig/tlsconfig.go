@@ -0,0 +1,137 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jiajunhuang/hfs/pkg/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+/*
+package tlsconfig build TLS configurations of gRPC and etcd from files given in config.
+*/
+
+// error definitions
+var (
+	ErrNoCert = errors.New("TLSCert and TLSKey are required to serve TLS")
+	ErrNoCA   = errors.New("TLSCA is required to verify certificates of clients")
+	ErrBadCA  = errors.New("no certificate found in CA file")
+)
+
+// Files are paths of certificates and key in PEM
+type Files struct {
+	Cert string
+	Key  string
+	CA   string // system CAs are used if it's empty
+}
+
+// GRPC returns files of gRPC traffic
+func GRPC() Files {
+	return Files{Cert: config.TLSCert, Key: config.TLSKey, CA: config.TLSCA}
+}
+
+// Etcd returns files of traffic to etcd
+func Etcd() Files {
+	return Files{Cert: config.EtcdTLSCert, Key: config.EtcdTLSKey, CA: config.EtcdTLSCA}
+}
+
+func loadCA(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: %s", ErrBadCA, path)
+	}
+	return pool, nil
+}
+
+// Server returns TLS configuration of a server which presents Cert, client certificates are
+// required and verified by CA if clientAuth is true
+func (f Files) Server(clientAuth bool) (*tls.Config, error) {
+	if f.Cert == "" || f.Key == "" {
+		return nil, ErrNoCert
+	}
+	cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if clientAuth {
+		if f.CA == "" {
+			return nil, ErrNoCA
+		}
+		if cfg.ClientCAs, err = loadCA(f.CA); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// Client returns TLS configuration of a client, which verifies servers by CA and presents Cert
+// if it's given. serverName overrides the name in certificates of servers if it's not empty
+func (f Files) Client(serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+
+	if f.CA != "" {
+		pool, err := loadCA(f.CA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if f.Cert != "" || f.Key != "" {
+		cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// ServerOption returns credentials of gRPC server, it's nil if TLS is disabled
+func ServerOption() (grpc.ServerOption, error) {
+	if !config.TLS {
+		return nil, nil
+	}
+
+	cfg, err := GRPC().Server(config.TLSClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Creds(credentials.NewTLS(cfg)), nil
+}
+
+// DialOption returns credentials of gRPC client, it's insecure if TLS is disabled
+func DialOption() (grpc.DialOption, error) {
+	if !config.TLS {
+		return grpc.WithInsecure(), nil
+	}
+
+	cfg, err := GRPC().Client(config.TLSServerName)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(cfg)), nil
+}
+
+// EtcdClient returns TLS configuration of etcd client, it's nil if TLS is disabled
+func EtcdClient() (*tls.Config, error) {
+	if !config.EtcdTLS {
+		return nil, nil
+	}
+
+	return Etcd().Client("")
+}
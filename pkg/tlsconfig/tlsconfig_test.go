@@ -0,0 +1,140 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert create a certificate signed by parent, or a self-signed CA if parent is nil
+func writeCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %s", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// handshake returns errors of server and client side
+func handshake(t *testing.T, server *tls.Config, client *tls.Config) (error, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer lis.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer conn.Close()
+		tlsConn := tls.Server(conn, server)
+		tlsConn.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := tlsConn.Handshake(); err != nil {
+			errc <- err
+			return
+		}
+		// since TLS 1.3, client finishes handshake before server verifies it
+		_, err = tlsConn.Write([]byte{1})
+		errc <- err
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err == nil {
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+	}
+	return <-errc, err
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hfs-tls")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "chunkserver", ca, caKey)
+	writeCert(t, dir, "client", ca, caKey)
+	writeCert(t, dir, "evil", nil, nil)
+	files := func(name string) Files {
+		return Files{Cert: filepath.Join(dir, name+".crt"), Key: filepath.Join(dir, name+".key"), CA: filepath.Join(dir, "ca.crt")}
+	}
+
+	server, err := files("chunkserver").Server(true)
+	if err != nil {
+		t.Fatalf("failed to load server configuration: %s", err)
+	}
+	client, err := files("client").Client("chunkserver")
+	if err != nil {
+		t.Fatalf("failed to load client configuration: %s", err)
+	}
+	if serr, cerr := handshake(t, server, client); serr != nil || cerr != nil {
+		t.Fatalf("handshake should succeed but got %v, %v", serr, cerr)
+	}
+
+	// client without certificate, or with one not signed by CA, is rejected
+	anonymous, _ := Files{CA: filepath.Join(dir, "ca.crt")}.Client("chunkserver")
+	if serr, _ := handshake(t, server, anonymous); serr == nil {
+		t.Fatalf("client without certificate should be rejected")
+	}
+	evil, _ := Files{Cert: filepath.Join(dir, "evil.crt"), Key: filepath.Join(dir, "evil.key"), CA: filepath.Join(dir, "ca.crt")}.Client("chunkserver")
+	if serr, _ := handshake(t, server, evil); serr == nil {
+		t.Fatalf("client with certificate of another CA should be rejected")
+	}
+
+	// server is verified by client too
+	wrongName, _ := files("client").Client("other")
+	if _, cerr := handshake(t, server, wrongName); cerr == nil {
+		t.Fatalf("server with wrong name should be rejected")
+	}
+
+	if _, err := (Files{}).Server(false); err != ErrNoCert {
+		t.Fatalf("server without certificate should be rejected but got %v", err)
+	}
+	if _, err := (Files{Cert: files("client").Cert, Key: files("client").Key}).Server(true); err != ErrNoCA {
+		t.Fatalf("client auth without CA should be rejected but got %v", err)
+	}
+}